@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"joyku/pkg/joycon"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	centerSampleDuration = time.Second     // How long a centered stick is sampled for
+	imuSampleDuration    = 2 * time.Second // How long the IMU is sampled for while the controller lies flat
+)
+
+// joyconAction is run on a single connected Joycon, lines are read from standard input so the user can be prompted
+type joyconAction func(ctx context.Context, jc *joycon.Joycon, lines <-chan string) error
+
+// forEachJoycon connects to every Joycon that is found and runs the action on them one by one
+func forEachJoycon(manual bool, action joyconAction, quit <-chan os.Signal) {
+	search := wirelessConnect
+	if manual {
+		search = manualConnect
+	}
+	joycons := search()
+	if len(joycons) == 0 {
+		fmt.Println("No Joycons were found!")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-quit
+		log.Println("Received SIGINT, shutting down")
+		cancel()
+	}()
+
+	lines := readLines(os.Stdin)
+	for _, jc := range joycons {
+		if err := jc.ConnectContext(ctx); err != nil {
+			fmt.Printf("Failed to connect to %s, skipping: %s\n", jc.Name, err)
+			continue
+		}
+		if err := action(ctx, jc, lines); err != nil {
+			log.Printf("Failed on %s: %s\n", jc.Name, err)
+		}
+		jc.Disconnect()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// backupPath returns the path the original user calibration of the Joycon is backed up to
+func backupPath(jc *joycon.Joycon) string {
+	return joyconFile(jc, "calibration")
+}
+
+// joyconFile returns the name of a file in the working directory that belongs to the Joycon
+func joyconFile(jc *joycon.Joycon, extension string) string {
+	return fmt.Sprintf("joycon-%s.%s", strings.ReplaceAll(jc.Serial, ":", ""), extension)
+}
+
+// calibrateJoycon backs up the current user calibration of the Joycon, then guides the user through calibrating each
+// stick and the IMU. Every new calibration is written once the user confirms it.
+func calibrateJoycon(ctx context.Context, jc *joycon.Joycon, lines <-chan string) error {
+	backup, err := jc.BackupUserCalibration(ctx)
+	if err != nil {
+		return err
+	}
+	// Only the first backup is kept, since it's the one made before joyku changed anything
+	path := backupPath(jc)
+	if _, err := os.Stat(path); err == nil {
+		fmt.Printf("Keeping the existing backup of %s in %s\n", jc.Name, path)
+	} else if err := os.WriteFile(path, backup, 0o644); err != nil {
+		return fmt.Errorf("could not back up the calibration: %w", err)
+	} else {
+		fmt.Printf("Backed up the calibration of %s to %s\n", jc.Name, path)
+	}
+
+	for _, stick := range jc.Sticks() {
+		c := joycon.StickCalibrator{Stick: stick}
+		fmt.Printf("Hold %s upright and slowly rotate its %s around the edge a few times, then press Enter\n", jc.Name, strings.ToLower(stick.String()))
+		// Stop waiting for Enter if sampling fails, so the next line isn't swallowed
+		rotated, stopWaiting := context.WithCancel(ctx)
+		err := sample(ctx, jc, untilEnter(rotated, lines), c.AddEdge)
+		stopWaiting()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Let go of the %s and press Enter\n", strings.ToLower(stick.String()))
+		if err := waitForEnter(ctx, lines); err != nil {
+			return err
+		}
+		if err := sample(ctx, jc, forDuration(centerSampleDuration), c.AddCenter); err != nil {
+			return err
+		}
+
+		deadzone := jc.StickCalibration.Deadzone
+		if stick == joycon.RightStick {
+			deadzone = jc.RightStickCalibration.Deadzone
+		}
+		sc, err := c.Calibration(deadzone)
+		if err != nil {
+			return fmt.Errorf("could not calibrate the %s: %w", strings.ToLower(stick.String()), err)
+		}
+		fmt.Printf("Center (0x%03X, 0x%03X), X range -0x%03X/+0x%03X, Y range -0x%03X/+0x%03X\n", sc.XAxisCenter, sc.YAxisCenter,
+			sc.XAxisMinBelowCenter, sc.XAxisMaxAboveCenter, sc.YAxisMinBelowCenter, sc.YAxisMaxAboveCenter)
+		if confirm(ctx, lines, fmt.Sprintf("Write the new %s calibration to %s?", strings.ToLower(stick.String()), jc.Name)) {
+			if err := jc.WriteStickCalibration(ctx, stick, sc); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote the %s calibration\n", strings.ToLower(stick.String()))
+		}
+	}
+
+	fmt.Printf("Lay %s on a flat surface, let go of it, and press Enter\n", jc.Name)
+	if err := waitForEnter(ctx, lines); err != nil {
+		return err
+	}
+	c := joycon.IMUCalibrator{}
+	if err := sample(ctx, jc, forDuration(imuSampleDuration), c.Add); err != nil {
+		return err
+	}
+	ic, err := c.Calibration(jc.IMUCalibration)
+	if err != nil {
+		return fmt.Errorf("could not calibrate the imu: %w", err)
+	}
+	fmt.Printf("Accelerometer origin %v, gyroscope origin %v\n", ic.AccelOrigin, ic.GyroOrigin)
+	if confirm(ctx, lines, fmt.Sprintf("Write the new IMU calibration to %s?", jc.Name)) {
+		if err := jc.WriteIMUCalibration(ctx, ic); err != nil {
+			return err
+		}
+		fmt.Println("Wrote the IMU calibration")
+	}
+	return nil
+}
+
+// restoreCalibration writes the backup made before the Joycon was first calibrated back to it
+func restoreCalibration(ctx context.Context, jc *joycon.Joycon, _ <-chan string) error {
+	path := backupPath(jc)
+	backup, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read backup: %w", err)
+	}
+	if err := jc.RestoreUserCalibration(ctx, backup); err != nil {
+		return err
+	}
+	fmt.Printf("Restored the calibration of %s from %s\n", jc.Name, path)
+	return nil
+}
+
+// sample passes every status the Joycon reports to add until stop is closed. The returned error is only set if ctx
+// was canceled or the Joycon stopped reporting.
+func sample(ctx context.Context, jc *joycon.Joycon, stop <-chan struct{}, add func(js *joycon.JoyconStatus)) error {
+	start := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-stop:
+			return nil
+		case js, ok := <-jc.Status():
+			if !ok {
+				return errors.New("joycon stopped reporting")
+			}
+			// Statuses from before sampling started were buffered while waiting for the user
+			if js.Timestamp.Before(start) {
+				continue
+			}
+			add(js)
+		}
+	}
+}
+
+// untilEnter returns a channel that is closed once the user presses Enter
+func untilEnter(ctx context.Context, lines <-chan string) <-chan struct{} {
+	stop := make(chan struct{})
+	go func() {
+		defer close(stop)
+		select {
+		case <-lines:
+		case <-ctx.Done():
+		}
+	}()
+	return stop
+}
+
+// forDuration returns a channel that is closed after the given duration
+func forDuration(d time.Duration) <-chan struct{} {
+	stop := make(chan struct{})
+	time.AfterFunc(d, func() {
+		close(stop)
+	})
+	return stop
+}
+
+// waitForEnter waits for the user to press Enter
+func waitForEnter(ctx context.Context, lines <-chan string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case _, ok := <-lines:
+		if !ok {
+			return io.EOF
+		}
+		return nil
+	}
+}
+
+// confirm asks the user a yes or no question, anything other than yes is treated as no
+func confirm(ctx context.Context, lines <-chan string, question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	select {
+	case <-ctx.Done():
+		return false
+	case answer := <-lines:
+		answer = strings.TrimSpace(answer)
+		return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+	}
+}
+
+// readLines sends every line read from r to the returned channel, it's closed once r is exhausted
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return lines
+}
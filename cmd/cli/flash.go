@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"joyku/pkg/joycon"
+	"os"
+)
+
+// dumpFlash dumps the entire SPI flash of the Joycon to a file in the working directory
+func dumpFlash(ctx context.Context, jc *joycon.Joycon, _ <-chan string) error {
+	path := joyconFile(jc, "flash")
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create flash dump: %w", err)
+	}
+	defer f.Close()
+
+	fmt.Printf("Dumping the flash of %s to %s\n", jc.Name, path)
+	err = jc.DumpFlash(ctx, f, func(read int, total int) {
+		fmt.Printf("\r%d%% (%d/%d bytes)", read*100/total, read, total)
+	})
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Dumped and verified the flash of %s\n", jc.Name)
+	return nil
+}
+
+// restoreFlash puts back the user calibration from the flash dump of the Joycon in the working directory
+func restoreFlash(ctx context.Context, jc *joycon.Joycon, _ <-chan string) error {
+	path := joyconFile(jc, "flash")
+	image, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read flash dump: %w", err)
+	}
+	if err := jc.RestoreFlash(ctx, image); err != nil {
+		return err
+	}
+	fmt.Printf("Restored the user calibration of %s from %s\n", jc.Name, path)
+	return nil
+}
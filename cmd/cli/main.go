@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"joyku/internal/bluez"
+	"joyku/pkg/emulator"
 	"joyku/pkg/joycon"
+	"joyku/pkg/mapping"
 	"joyku/pkg/roku"
 	"log"
 	"os"
@@ -39,23 +41,96 @@ func main() {
 	signal.Notify(quit, os.Interrupt, syscall.SIGINT)
 
 	manual := strings.EqualFold(args[1], "true")
-	run(manual, quit)
+
+	// Load mapping profiles if provided, otherwise use the default button layout
+	profiles := mapping.DefaultProfiles()
+	combine := false
+	record := false
+	replay := ""
+	var action joyconAction
+	for i := 2; i < len(args); i++ {
+		switch args[i] {
+		case "--profile", "-p":
+			if i+1 >= len(args) {
+				fmt.Println("Missing profile path")
+				printHelp()
+				os.Exit(1)
+			}
+			i++
+
+			var err error
+			profiles, err = mapping.LoadProfiles(args[i])
+			if err != nil {
+				log.Fatalf("Could not load mapping profiles: %s\n", err)
+			}
+		case "--combine", "-c":
+			combine = true
+		case "--record":
+			record = true
+		case "--replay":
+			if i+1 >= len(args) {
+				fmt.Println("Missing recording path")
+				printHelp()
+				os.Exit(1)
+			}
+			i++
+			replay = args[i]
+		case "--calibrate":
+			action = calibrateJoycon
+		case "--restore-calibration":
+			action = restoreCalibration
+		case "--dump-flash":
+			action = dumpFlash
+		case "--restore-flash":
+			action = restoreFlash
+		default:
+			fmt.Println("Invalid command-line arguments")
+			printHelp()
+			os.Exit(1)
+		}
+	}
+
+	// Use emulated Joycons instead of real ones if requested (e.g. when running in a container)
+	emu, err := emulator.FromEnvironment()
+	if err != nil {
+		log.Fatalf("Could not create Joycon emulator: %s\n", err)
+	}
+	if emu != nil {
+		log.Printf("Using %d emulated Joycons\n", len(emu.Controllers()))
+		joycon.SetBackend(emu)
+		// Emulated Joycons can't be found over bluetooth
+		manual = true
+	}
+	// Maintenance actions are run on each Joycon instead of controlling a roku
+	if action != nil {
+		forEachJoycon(manual, action, quit)
+		return
+	}
+	run(manual, combine, record, replay, profiles, quit)
 }
 
 // printHelp prints example cli usage string to standard output
 func printHelp() {
-	fmt.Println("usage: joyku_cli (--manual | -m) <boolean>")
+	fmt.Println("usage: joyku_cli (--manual | -m) <boolean> [(--profile | -p) <path>] [--combine | -c] [--record] [--replay <path>] [--calibrate | --restore-calibration | --dump-flash | --restore-flash]")
+	fmt.Println("--combine uses a left and right Joycon together as a single controller")
+	fmt.Println("--record records the input of each Joycon to a file, which can be attached to a bug report")
+	fmt.Println("--replay controls the roku with a recording made with --record, as if it were a connected Joycon")
+	fmt.Println("--calibrate guides you through calibrating the sticks and IMU of each Joycon, backing up its calibration first")
+	fmt.Println("--restore-calibration puts back the calibration each Joycon had before it was first calibrated")
+	fmt.Println("--dump-flash backs up the entire SPI flash of each Joycon, --restore-flash puts back its user calibration")
+	fmt.Printf("set %s=left,right to use emulated Joycons and optionally %s=<path> to script their input\n", emulator.EnvControllers, emulator.EnvScript)
 }
 
-func run(manual bool, quit <-chan os.Signal) {
+func run(manual bool, combine bool, record bool, replay string, profiles []*mapping.Profile, quit <-chan os.Signal) {
 	// Setup Roku device connection
 	cfg, err := roku.NewRokuConfig()
 	if err != nil {
 		log.Fatalf("Could not create roku config. %s\n", err.Error())
 	}
 
-	rokuDevice := roku.NewDevice(cfg.Ip, cfg.Port)
-	if err := roku.QueryDevice(rokuDevice); err != nil {
+	// Search the network for a roku device if an ip wasn't configured
+	rokuDevice, err := roku.FindDevice(context.TODO(), cfg)
+	if err != nil {
 		log.Fatalf("Could not connect to roku device: %s\n", err.Error())
 	}
 	log.Printf("Successfully connected to %s!\n", rokuDevice.Name)
@@ -63,34 +138,164 @@ func run(manual bool, quit <-chan os.Signal) {
 	start := func(search func() []*joycon.Joycon) {
 		joycons := search()
 		if len(joycons) == 0 {
-			fmt.Println("No Joycons were found!")
-			return
+			fmt.Println("No Joycons were found yet, waiting for one to be attached")
+		} else {
+			fmt.Printf("Found %d Joycons\n", len(joycons))
 		}
-		fmt.Printf("Found %d Joycons\n", len(joycons))
 
 		mux := joycon.NewMultiplexer()
-		for _, joycon := range joycons {
-			if err := joycon.Connect(); err != nil {
-				fmt.Printf("Failed to connect to %s\n, skipping: %s", joycon.Name, err)
+		// The output must be started before joining, otherwise joining blocks
+		output := mux.Output()
+		// Joycons attached later are joined while keys are being sent, so the controllers are guarded by a lock
+		connected := make(map[string]rumbler)
+		var connectedLock sync.Mutex
+		join := func(c joycon.Controller, serial string, r rumbler) {
+			mux.Join(c)
+			connectedLock.Lock()
+			connected[serial] = r
+			connectedLock.Unlock()
+		}
+		defer func() {
+			for _, jc := range joycon.Connected() {
+				jc.Disconnect()
+			}
+		}()
+		// Recordings are stopped before disconnecting, so they end with the last input that was used
+		var recordings []*recording
+		defer func() {
+			connectedLock.Lock()
+			defer connectedLock.Unlock()
+			for _, rec := range recordings {
+				rec.stop()
+			}
+		}()
+
+		// connect connects to the Joycon and shows which roku it controls on its player lights
+		connect := func(jc *joycon.Joycon) bool {
+			if err := jc.Connect(); err != nil {
+				fmt.Printf("Failed to connect to %s, skipping: %s\n", jc.Name, err)
+				return false
+			}
+			if err := jc.SetPlayerLights(joyconLights(rokuDevice)); err != nil {
+				log.Printf("Could not set player lights on %s: %s\n", jc.Name, err)
+			}
+			go reportStateChanges(jc)
+			if record {
+				rec, err := startRecording(jc)
+				if err != nil {
+					log.Printf("Could not record %s: %s\n", jc.Name, err)
+					return true
+				}
+				connectedLock.Lock()
+				recordings = append(recordings, rec)
+				connectedLock.Unlock()
+			}
+			return true
+		}
+		// The halves of a combined controller use the stick settings of the combined profile, but are always held vertically
+		configureHalf := func(jc *joycon.Joycon) {
+			if profile := mapping.SelectProfile(profiles, joycon.CombinedProductID); profile != nil {
+				if err := jc.SetStickResponse(profile.Stick); err != nil {
+					log.Printf("Could not set the stick response of %s: %s\n", jc.Name, err)
+				}
+			}
+		}
+
+		pair := joycon.Pair{}
+		for _, jc := range joycons {
+			if !connect(jc) {
 				continue
 			}
-			mux.Join(joycon)
-			defer joycon.Disconnect()
+			// The first left and right Joycon are joined once they've been combined
+			if combine && jc.IsLeft() && pair.Left == nil {
+				pair.Left = jc
+				continue
+			}
+			if combine && jc.IsRight() && pair.Right == nil {
+				pair.Right = jc
+				continue
+			}
+			configureFromProfile(jc, mapping.SelectProfile(profiles, jc.ProductID))
+			join(jc, jc.Serial, jc)
 		}
+		var combined *joycon.CombinedController
+		if combine {
+			var err error
+			combined, err = joycon.NewCombinedController(pair)
+			if err != nil {
+				// Use whichever half was found on its own
+				log.Printf("Could not combine Joycons, using them separately: %s\n", err)
+				for _, jc := range []*joycon.Joycon{pair.Left, pair.Right} {
+					if jc != nil {
+						configureFromProfile(jc, mapping.SelectProfile(profiles, jc.ProductID))
+						join(jc, jc.Serial, jc)
+					}
+				}
+			} else {
+				configureHalf(pair.Left)
+				configureHalf(pair.Right)
+				defer combined.Close()
+				join(combined, combined.Serial, combined)
+			}
+		}
+
+		// A replayed Joycon is used like any other, until its recording ends
+		if replay != "" {
+			jc, err := openReplay(replay)
+			if err != nil {
+				log.Fatalf("Could not replay %s: %s\n", replay, err)
+			}
+			log.Printf("Replaying %s from %s\n", jc.Name, replay)
+			defer jc.Disconnect()
+			configureFromProfile(jc, mapping.SelectProfile(profiles, jc.ProductID))
+			join(jc, jc.Serial, jc)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-quit
+			log.Println("Received SIGINT, shutting down")
+			cancel()
+		}()
+
+		// Connect Joycons that are attached after starting, so they can be used without restarting
+		go func() {
+			for event := range joycon.Watch(ctx) {
+				jc := event.Joycon
+				// Joycons that were connected before being detached reconnect on their own
+				if event.Kind != joycon.DeviceAdded || jc.State() != joycon.StateDisconnected {
+					continue
+				}
+				log.Printf("%s was attached, connecting\n", jc.Name)
+				if !connect(jc) {
+					continue
+				}
 
-		for {
-			select {
-			case js, ok := <-mux.Output():
-				if !ok {
-					log.Println("Joycon status channel closed, shutting down")
-					return
+				// A half that is attached again takes the place of the one that dropped out of the combined controller
+				if combined != nil && ((jc.IsLeft() && !combined.Left().IsConnected()) || (jc.IsRight() && !combined.Right().IsConnected())) {
+					if err := combined.Attach(jc); err == nil {
+						configureHalf(jc)
+						continue
+					}
 				}
-				log.Println(js.String())
-			case <-quit:
-				log.Println("Received SIGINT, shutting down")
-				return
+				configureFromProfile(jc, mapping.SelectProfile(profiles, jc.ProductID))
+				join(jc, jc.Serial, jc)
+			}
+		}()
+
+		// Translate Joycon input into roku keys until we're told to quit
+		mapper := mapping.NewMapper(profiles)
+		// Tick the Joycon that sent keys so the user can feel each key press
+		mapper.Feedback = func(serial string) {
+			connectedLock.Lock()
+			jc, ok := connected[serial]
+			connectedLock.Unlock()
+			if ok {
+				go jc.Rumble(ctx, joycon.RumbleTick)
 			}
 		}
+		mapper.Run(ctx, output, rokuDevice)
 	}
 
 	// Find and connect to Joycons
@@ -105,6 +310,45 @@ func run(manual bool, quit <-chan os.Signal) {
 	}
 }
 
+// rumbler is a controller that can be rumbled for feedback
+type rumbler interface {
+	Rumble(ctx context.Context, pattern joycon.RumblePattern) error
+}
+
+// configureFromProfile sets how the Joycon is held and how its sticks respond to match the given profile
+func configureFromProfile(jc *joycon.Joycon, profile *mapping.Profile) {
+	if profile == nil {
+		return
+	}
+	if err := jc.SetStickResponse(profile.Stick); err != nil {
+		log.Printf("Could not set the stick response of %s: %s\n", jc.Name, err)
+	}
+	if profile.Hold == joycon.HoldVertical {
+		return
+	}
+	if err := jc.SetHoldMode(profile.Hold); err != nil {
+		log.Printf("Could not set the hold mode of %s: %s\n", jc.Name, err)
+		return
+	}
+	log.Printf("Holding %s %s\n", jc.Name, strings.ToLower(profile.Hold.String()))
+}
+
+// reportStateChanges logs the connection state changes of the Joycon until it's closed, and rumbles it once it
+// reconnects so the user can feel it's back
+func reportStateChanges(jc *joycon.Joycon) {
+	for change := range jc.StateChanges() {
+		log.Printf("%s is %s\n", jc.Name, strings.ToLower(change.To.String()))
+		if change.From == joycon.StateReconnecting && change.To == joycon.StateConnected {
+			go jc.Rumble(context.Background(), joycon.RumbleTick)
+		}
+	}
+}
+
+// joyconLights returns the player lights shown on Joycons controlling the given roku device
+func joyconLights(device *roku.RokuDevice) joycon.PlayerLights {
+	return joycon.PlayerLightsFor(device.PlayerNumber())
+}
+
 func manualConnect() []*joycon.Joycon {
 	return joycon.FindAll()
 }
@@ -132,100 +376,10 @@ func wirelessConnect() []*joycon.Joycon {
 	}
 
 	for device := range scanC {
-		joycon := joycon.Find(device.Address)
+		joycon := joycon.FindContext(ctx, device.Address)
 		if joycon != nil {
 			joycons = append(joycons, joycon)
 		}
 	}
 	return joycons
 }
-
-// TODO: Cleanup below
-
-type DirectionAggregator struct {
-	directions   map[joycon.StickDirection]int
-	max          int
-	maxDirection joycon.StickDirection
-	lock         sync.Mutex
-}
-
-func NewDirectionAggregator() *DirectionAggregator {
-	return &DirectionAggregator{
-		directions: make(map[joycon.StickDirection]int, 60),
-		max:        0,
-	}
-}
-
-func (d *DirectionAggregator) Add(dir joycon.StickDirection) {
-	d.lock.Lock()
-	defer d.lock.Unlock()
-
-	dirCount := 1
-	if count, ok := d.directions[dir]; ok {
-		d.directions[dir] = count + 1
-		dirCount = count + 1
-	} else {
-		d.directions[dir] = 1
-	}
-
-	if dirCount > d.max {
-		d.max = dirCount
-		d.maxDirection = dir
-	}
-}
-
-func (d *DirectionAggregator) Count() int {
-	d.lock.Lock()
-	defer d.lock.Unlock()
-
-	total := 0
-	for _, c := range d.directions {
-		total += c
-	}
-	return total
-}
-
-func (d *DirectionAggregator) Clear() {
-	d.lock.Lock()
-	defer d.lock.Unlock()
-
-	d.directions = make(map[joycon.StickDirection]int, 60)
-	d.max = 0
-}
-
-// Check stick direction and send corresponding keypress
-func TranslateJoyconStatus(js *joycon.JoyconStatus, da *DirectionAggregator, rd *roku.RokuDevice) {
-	if SupportedDirection(js.JoystickData.Direction) {
-		da.Add(js.JoystickData.Direction)
-	}
-
-	if da.Count() == 11 {
-		switch da.maxDirection {
-		case joycon.StickUp:
-			rd.SendKeypress(roku.KeyUp)
-		case joycon.StickRight:
-			rd.SendKeypress(roku.KeyRight)
-		case joycon.StickDown:
-			rd.SendKeypress(roku.KeyDown)
-		case joycon.StickLeft:
-			rd.SendKeypress(roku.KeyLeft)
-		default:
-			log.Printf("warn - unsupported direction value: %s\n", da.maxDirection.String())
-		}
-		da.Clear()
-	}
-
-	if js.ButtonA {
-		rd.SendKeypress(roku.KeySelect)
-	} else if js.ButtonB {
-		rd.SendKeypress(roku.KeyBack)
-	} else if js.ButtonHome {
-		rd.SendKeypress(roku.KeyHome)
-	} else {
-		rd.SendKeypress(roku.None)
-	}
-}
-
-func SupportedDirection(dir joycon.StickDirection) bool {
-	return dir == joycon.StickUp || dir == joycon.StickRight || dir == joycon.StickDown || dir == joycon.StickLeft
-}
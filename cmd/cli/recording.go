@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"joyku/pkg/joycon"
+	"log"
+	"os"
+)
+
+// recording is the input of a Joycon being recorded to a file, so it can be attached to a bug report
+type recording struct {
+	recorder *joycon.Recorder
+	file     *os.File
+}
+
+// startRecording records the input of the Joycon to a file in the working directory until the recording is stopped
+func startRecording(jc *joycon.Joycon) (*recording, error) {
+	path := joyconFile(jc, "rec")
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not create recording: %w", err)
+	}
+	rec, err := jc.Record(f)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	log.Printf("Recording %s to %s\n", jc.Name, path)
+	return &recording{recorder: rec, file: f}, nil
+}
+
+// stop stops recording and closes the file
+func (r *recording) stop() {
+	if err := r.recorder.Stop(); err != nil {
+		log.Printf("Could not finish recording %s: %s\n", r.file.Name(), err)
+	}
+	if err := r.file.Close(); err != nil {
+		log.Printf("Could not close recording %s: %s\n", r.file.Name(), err)
+	}
+}
+
+// openReplay returns a Joycon that replays the recording at the given path
+func openReplay(path string) (*joycon.Joycon, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open recording: %w", err)
+	}
+	// The reports are read while they're being replayed, so the file is closed once the Joycon is
+	jc, err := joycon.Replay(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	go func() {
+		for range jc.StateChanges() {
+		}
+		f.Close()
+	}()
+	return jc, nil
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"joyku/internal/bluez"
+	"joyku/pkg/emulator"
 	"joyku/pkg/handlers"
 	"joyku/pkg/joycon"
+	"joyku/pkg/roku"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 )
 
@@ -17,22 +21,60 @@ func main() {
 
 	signal.Notify(quit, os.Interrupt, syscall.SIGINT)
 
-	conn, err := bluez.Init()
+	// Use emulated Joycons instead of real ones if requested (e.g. when running in a container)
+	emu, err := emulator.FromEnvironment()
 	if err != nil {
-		log.Fatalf("Could not initialize connection to Bluetooth adapter, err: %s\n", err)
+		log.Fatalf("Could not create Joycon emulator, err: %s\n", err)
+	}
+
+	// Bluetooth is not needed for emulated Joycons, so the adapter is left nil when emulating
+	var conn *bluez.Conn
+	var adpt *bluez.Adapter
+	registry := joycon.DefaultRegistry
+	if emu != nil {
+		log.Printf("Using %d emulated Joycons\n", len(emu.Controllers()))
+		registry = joycon.NewRegistry(emu)
+	} else {
+		conn, err = bluez.Init()
+		if err != nil {
+			log.Fatalf("Could not initialize connection to Bluetooth adapter, err: %s\n", err)
+		}
+		adpt = conn.Adapter()
+	}
+
+	// Search the network for a roku device if an ip wasn't configured. The web server is still usable without one.
+	var rokuDevice *roku.RokuDevice
+	cfg, err := roku.NewRokuConfig()
+	if err != nil {
+		log.Printf("Could not create roku config, err: %s\n", err)
+	} else if rokuDevice, err = roku.FindDevice(context.TODO(), cfg); err != nil {
+		log.Printf("Could not connect to roku device, err: %s\n", err)
+	} else {
+		log.Printf("Successfully connected to %s!\n", rokuDevice.Name)
 	}
-	adpt := conn.Adapter()
 
 	mux := joycon.NewMultiplexer()
 
 	http.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("assets"))))
 
-	http.HandleFunc("/", handlers.Home)
-	http.HandleFunc("/search", handlers.Search(adpt))
-	http.HandleFunc("/connect", handlers.Connect(mux))
-	http.HandleFunc("/disconnect", handlers.Disconnect(adpt))
+	http.HandleFunc("/", handlers.Home(registry, rokuDevice))
+	http.HandleFunc("/search", handlers.Search(registry, adpt))
+	http.HandleFunc("/connect", handlers.Connect(registry, mux, rokuDevice))
+	http.HandleFunc("/disconnect", handlers.Disconnect(registry, adpt))
 	http.HandleFunc("/events", handlers.Events(mux))
 
+	// Connect Joycons as soon as they're attached, so they don't have to be connected from the dashboard. The output
+	// must be started before joining, otherwise joining blocks until the dashboard subscribes to events.
+	mux.Output()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go autoConnect(ctx, registry, mux, rokuDevice)
+
+	// Log connection state changes, so Joycons that drop out and reconnect can be followed
+	events, unsubscribe := registry.Subscribe()
+	defer unsubscribe()
+	go logRegistryEvents(events)
+
 	go func() {
 		log.Println("Running server on localhost:3000")
 		http.ListenAndServe(":3000", nil)
@@ -40,11 +82,53 @@ func main() {
 
 	<-quit
 	log.Println("Received SIGTERM, shutting down")
+	cancel()
 	// cleanup
-	joycon.DisconnectAll(func(jc *joycon.Joycon) {
+	registry.DisconnectAll(func(jc *joycon.Joycon) {
 		log.Printf("Disconnecting: %s\n", jc.Name)
-		adpt.RemoveDeviceWithSerial(jc.Serial)
+		if adpt != nil {
+			adpt.RemoveDeviceWithSerial(jc.Serial)
+		}
 	})
-	conn.Close()
+	if conn != nil {
+		conn.Close()
+	}
 	mux.Close()
 }
+
+// logRegistryEvents logs the connection state changes of every Joycon in the registry until events is closed
+func logRegistryEvents(events <-chan joycon.RegistryEvent) {
+	for event := range events {
+		if event.Kind == joycon.JoyconStateChanged {
+			log.Printf("%s is %s\n", event.Joycon.Name, strings.ToLower(event.State.String()))
+		}
+	}
+}
+
+// autoConnect connects every Joycon that is attached to the system and adds it to the multiplexer until ctx is done.
+// The roku device may be nil, otherwise the Joycon's player lights show which roku it controls.
+func autoConnect(ctx context.Context, registry *joycon.Registry, mux *joycon.FOFIMultiplexer, device *roku.RokuDevice) {
+	for event := range registry.Watch(ctx) {
+		jc := event.Joycon
+		if event.Kind == joycon.DeviceRemoved {
+			log.Printf("%s was detached\n", jc.Name)
+			continue
+		}
+		// Joycons that were connected before being detached reconnect on their own
+		if jc.State() != joycon.StateDisconnected {
+			continue
+		}
+
+		if err := jc.ConnectContext(ctx); err != nil {
+			log.Printf("Could not connect to %s after it was attached: %s\n", jc.Name, err)
+			continue
+		}
+		if device != nil {
+			if err := jc.SetPlayerLights(joycon.PlayerLightsFor(device.PlayerNumber())); err != nil {
+				log.Printf("Could not set player lights on %s: %s\n", jc.Name, err)
+			}
+		}
+		mux.Join(jc)
+		log.Printf("Connected to %s after it was attached\n", jc.Name)
+	}
+}
@@ -1,32 +1,48 @@
 package spi
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"joyku/internal/report"
 	"joyku/internal/subcommand"
-	"log"
-	"time"
-
-	"github.com/sstallion/go-hid"
 )
 
 const (
-	MaxFlashReadInBytes byte = 29
+	MaxFlashReadInBytes  byte   = 29
+	MaxFlashWriteInBytes byte   = 29
+	FlashSize            uint32 = 0x80000 // Size of the SPI flash memory of a Joycon (512KB)
+	maxReadAttempts             = 3       // Number of times each chunk is requested by ReadRange before giving up
 
 	LeftStickFactoryCalibrationSection        uint32 = 0x603D
 	AxisMotionSensorFactoryCalibrationSection uint32 = 0x6020
 	RightStickFactoryCalibrationSection       uint32 = 0x6046
 	BodyColorSection                          uint32 = 0x6050
 	ButtonColorSection                        uint32 = 0x6053
+	ProSensorAndStickDeviceParameters         uint32 = 0x6080 // 6-axis horizontal offsets followed by LeftStickDeviceParameters
 	LeftStickDeviceParameters                 uint32 = 0x6086
 	RightStickDeviceParameters                uint32 = 0x6098
+	LeftStickUserCalibrationMagic             uint32 = 0x8010 // UserCalibrationMagic when LeftStickUserCalibrationSection is set
 	LeftStickUserCalibrationSection           uint32 = 0x8012
+	RightStickUserCalibrationMagic            uint32 = 0x801B // UserCalibrationMagic when RightStickUserCalibrationSection is set
 	RightStickUserCalibrationSection          uint32 = 0x801D
+	AxisMotionSensorUserCalibrationMagic      uint32 = 0x8026 // UserCalibrationMagic when AxisMotionSensorUserCalibrationSection is set
 	AxisMotionSensorUserCalibrationSection    uint32 = 0x8028
+
+	// User calibration is the only part of SPI flash that Write allows, everything else holds factory data that
+	// can't be recovered if it's overwritten
+	UserCalibrationStart uint32 = 0x8010
+	UserCalibrationEnd   uint32 = 0x8040
 )
 
+// UserCalibrationMagic is written in front of a user calibration section to mark it as set, the section is ignored
+// by the Switch without it
+var UserCalibrationMagic = []byte{0xB2, 0xA1}
+
+// ErrWriteProtected is returned when a Joycon refuses to write to its SPI flash
+var ErrWriteProtected = errors.New("[spi flash] write protected")
+
 type SPIFlashReadCommand struct {
 	Address uint32 // Address of subsection in SPI flash memory
 	Size    uint8  // Size of SPI flash read request in bytes - Max size is 29 bytes
@@ -39,52 +55,86 @@ func (s SPIFlashReadCommand) Data() []byte {
 	return data
 }
 
-// Read reads from joycon SPI flash memory and returns the data or an error if one occurred during reading.
-func Read(ctx context.Context, d *hid.Device, sfr SPIFlashReadCommand) ([]byte, error) {
+// Read reads from joycon SPI flash memory and returns the data or an error if one occurred during reading. Only up to
+// MaxFlashReadInBytes can be read at once, use ReadRange for anything larger.
+func Read(ctx context.Context, r subcommand.Requester, sfr SPIFlashReadCommand) ([]byte, error) {
 	if sfr.Size > MaxFlashReadInBytes {
-		sfr.Size = MaxFlashReadInBytes
-	}
-
-	err := subcommand.Send(d, subcommand.SPIFlashRead, sfr.Data())
-	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("[spi flash] can not read %d bytes at once, the max is %d", sfr.Size, MaxFlashReadInBytes)
 	}
 
-	ctx, cancelCtx := context.WithTimeout(ctx, time.Second)
-	defer cancelCtx()
-
-	resp, err := awaitResponse(ctx, d)
+	reply, err := r.Request(ctx, subcommand.SPIFlashRead, sfr.Data())
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("[spi flash] could not read 0x%X: %w", sfr.Address, err)
 	}
 
-	ack := (resp[13] >> 7) == 1
-	if !ack {
-		return nil, fmt.Errorf("[spi flash] received nack after reading")
+	// The reply starts with the address and size that were read, followed by the data
+	header := sfr.Data()
+	if len(reply.Data) < len(header)+int(sfr.Size) || !bytes.Equal(reply.Data[:len(header)], header) {
+		return nil, fmt.Errorf("[spi flash] received reply for a different read than 0x%X", sfr.Address)
 	}
 	// Return only the data portion of the report and nothing else
-	return resp[20:], nil
+	return reply.Data[len(header):], nil
 }
 
-// awaitResponse reads from device until it finds the expected input report or it times out.
-//
-// Reports that do not match the expected response are essentially ignored
-func awaitResponse(ctx context.Context, d *hid.Device) ([]byte, error) {
-	buffer := make([]byte, report.ReportLengthBytes)
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("received unexpected input report -- report %d, subcommand: %d", buffer[0], buffer[14])
-		default:
-			_, err := d.Read(buffer)
-			if err != nil {
-				return nil, err
-			}
+// ReadRange reads size bytes starting at address, split into as many reads as needed. Each read is retried a few
+// times before giving up, since a single lost reply shouldn't fail a long read.
+func ReadRange(ctx context.Context, r subcommand.Requester, address uint32, size int) ([]byte, error) {
+	if size < 0 || uint64(address)+uint64(size) > uint64(FlashSize) {
+		return nil, fmt.Errorf("[spi flash] range 0x%X-0x%X is out of bounds", address, uint64(address)+uint64(size))
+	}
 
-			if buffer[0] == report.StandardInputReportWithReplies.Byte() && buffer[14] == subcommand.SPIFlashRead.Byte() {
-				log.Printf("received expected input report")
-				return buffer, nil
+	data := make([]byte, 0, size)
+	for len(data) < size {
+		sfr := SPIFlashReadCommand{
+			Address: address + uint32(len(data)),
+			Size:    byte(min(size-len(data), int(MaxFlashReadInBytes))),
+		}
+
+		var chunk []byte
+		var err error
+		for attempt := 0; attempt < maxReadAttempts; attempt++ {
+			chunk, err = Read(ctx, r, sfr)
+			if err == nil || ctx.Err() != nil {
+				break
 			}
 		}
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:sfr.Size]...)
+	}
+	return data, nil
+}
+
+type SPIFlashWriteCommand struct {
+	Address  uint32 // Address of subsection in SPI flash memory
+	Contents []byte // Data to write - Max size is 29 bytes
+}
+
+func (s SPIFlashWriteCommand) Data() []byte {
+	data := []byte{}
+	data = binary.LittleEndian.AppendUint32(data, s.Address)
+	data = append(data, byte(len(s.Contents)))
+	return append(data, s.Contents...)
+}
+
+// Write writes to joycon SPI flash memory. Only the user calibration sections can be written to, writes anywhere
+// else return an error without being sent.
+func Write(ctx context.Context, r subcommand.Requester, sfw SPIFlashWriteCommand) error {
+	if len(sfw.Contents) == 0 || len(sfw.Contents) > int(MaxFlashWriteInBytes) {
+		return fmt.Errorf("[spi flash] can not write %d bytes at once, the max is %d", len(sfw.Contents), MaxFlashWriteInBytes)
+	}
+	if sfw.Address < UserCalibrationStart || sfw.Address+uint32(len(sfw.Contents)) > UserCalibrationEnd {
+		return fmt.Errorf("[spi flash] refusing to write outside of user calibration (0x%X-0x%X)", sfw.Address, sfw.Address+uint32(len(sfw.Contents)))
+	}
+
+	reply, err := r.Request(ctx, subcommand.SPIFlashWrite, sfw.Data())
+	if err != nil {
+		return fmt.Errorf("[spi flash] could not write 0x%X: %w", sfw.Address, err)
+	}
+	// The reply is a single status byte, anything other than zero means the write failed
+	if len(reply.Data) == 0 || reply.Data[0] != 0x00 {
+		return fmt.Errorf("could not write 0x%X: %w", sfw.Address, ErrWriteProtected)
 	}
+	return nil
 }
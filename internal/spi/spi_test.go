@@ -0,0 +1,106 @@
+package spi
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"joyku/internal/report"
+	"joyku/internal/subcommand"
+	"joyku/internal/transport"
+)
+
+// serveFlash answers every SPI flash read sent to device with the contents of flash and the given ACK byte, until the
+// transport is closed. Reads are never answered if ack is zero.
+func serveFlash(device transport.Transport, flash []byte, ack byte) {
+	for {
+		req := make([]byte, report.ReportLengthBytes)
+		if _, err := device.Read(req); err != nil {
+			return
+		}
+		if req[0] != 0x01 || req[10] != subcommand.SPIFlashRead.Byte() || ack == 0 {
+			continue
+		}
+
+		address := binary.LittleEndian.Uint32(req[11:15])
+		size := uint32(req[15])
+		reply := make([]byte, report.ReportLengthBytes)
+		reply[0] = report.StandardInputReportWithReplies.Byte()
+		reply[13] = ack
+		reply[14] = subcommand.SPIFlashRead.Byte()
+		copy(reply[15:], req[11:16])
+		if ack&0x80 != 0 {
+			copy(reply[20:], flash[address:address+size])
+		}
+		if _, err := device.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// newFlashDispatcher returns a dispatcher talking to a fake device that serves flash with the given ACK byte
+func newFlashDispatcher(t *testing.T, flash []byte, ack byte) *subcommand.Dispatcher {
+	host, device := transport.NewMemoryPair()
+	go serveFlash(device, flash, ack)
+	dp := subcommand.NewDispatcher(host)
+	t.Cleanup(func() { dp.Close() })
+	return dp
+}
+
+func TestRead(t *testing.T) {
+	flash := make([]byte, FlashSize)
+	copy(flash[BodyColorSection:], []byte{0x0A, 0xB9, 0xE6, 0x00, 0x1E, 0x1E})
+	dp := newFlashDispatcher(t, flash, 0x90)
+
+	data, err := Read(context.Background(), dp, SPIFlashReadCommand{Address: BodyColorSection, Size: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := data[:6], flash[BodyColorSection:BodyColorSection+6]; string(got) != string(want) {
+		t.Errorf("got % X, want % X", got, want)
+	}
+}
+
+func TestReadNack(t *testing.T) {
+	dp := newFlashDispatcher(t, make([]byte, FlashSize), 0x10)
+
+	_, err := Read(context.Background(), dp, SPIFlashReadCommand{Address: BodyColorSection, Size: 6})
+	var nack subcommand.NackError
+	if !errors.As(err, &nack) {
+		t.Fatalf("got %v, want a NackError", err)
+	}
+	if nack.ID != subcommand.SPIFlashRead {
+		t.Errorf("got a NACK for subcommand 0x%02X, want 0x%02X", nack.ID.Byte(), subcommand.SPIFlashRead.Byte())
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	dp := newFlashDispatcher(t, make([]byte, FlashSize), 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := Read(ctx, dp, SPIFlashReadCommand{Address: BodyColorSection, Size: 6})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	flash := make([]byte, FlashSize)
+	for i := range flash {
+		flash[i] = byte(i)
+	}
+	dp := newFlashDispatcher(t, flash, 0x90)
+
+	// Large enough to be split into several reads that don't line up with the end of the range
+	size := 3*int(MaxFlashReadInBytes) + 5
+	data, err := ReadRange(context.Background(), dp, UserCalibrationStart, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := flash[UserCalibrationStart : int(UserCalibrationStart)+size]; string(data) != string(want) {
+		t.Errorf("got % X, want % X", data, want)
+	}
+}
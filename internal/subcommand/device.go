@@ -0,0 +1,40 @@
+package subcommand
+
+import (
+	"fmt"
+	"sync"
+
+	"joyku/internal/transport"
+)
+
+// Device is the connection state used to send output reports to a single Joycon. Each device has its own packet
+// number, and writes are serialized so the device can be shared between goroutines.
+type Device struct {
+	transport    transport.Transport
+	packetNumber byte // 4 bit value - loops back to 0 after 0xF
+	lock         sync.Mutex
+}
+
+// NewDevice returns a device that writes output reports to the given transport
+func NewDevice(t transport.Transport) *Device {
+	return &Device{transport: t}
+}
+
+// Transport returns the transport this device writes to
+func (d *Device) Transport() transport.Transport {
+	return d.transport
+}
+
+// write sets the packet number of the given output report, writes it, and advances the packet number
+func (d *Device) write(buf []byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	buf[1] = d.packetNumber
+	_, err := d.transport.Write(buf)
+	if err != nil {
+		return fmt.Errorf("could not write to device: %w", err)
+	}
+	d.packetNumber = (d.packetNumber + 1) & maxPacketNumber
+	return nil
+}
@@ -0,0 +1,61 @@
+package subcommand
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"joyku/internal/transport"
+)
+
+func TestPacketNumbersAreSerializedPerDevice(t *testing.T) {
+	const (
+		goroutines = 8
+		perRoutine = 20
+		total      = goroutines * perRoutine
+	)
+
+	// Two devices written to at the same time, each must count its own packets
+	dispatchers := make([]*Dispatcher, 2)
+	sent := make([]chan []byte, len(dispatchers))
+	for i := range dispatchers {
+		host, device := transport.NewMemoryPair()
+		sent[i] = make(chan []byte, total)
+		go serve(device, ackFlag, sent[i])
+		dispatchers[i] = NewDispatcher(host)
+		defer dispatchers[i].Close()
+	}
+
+	var wg sync.WaitGroup
+	for _, dp := range dispatchers {
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < perRoutine; n++ {
+					// Half of the goroutines wait for replies, the other half only send
+					var err error
+					if g%2 == 0 {
+						_, err = dp.Request(context.Background(), SetPlayerLights, []byte{0x01})
+					} else {
+						err = dp.Send(SetHomeLight, []byte{0x00})
+					}
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for i := range dispatchers {
+		for n := 0; n < total; n++ {
+			buf := <-sent[i]
+			if want := byte(n) & maxPacketNumber; buf[1] != want {
+				t.Fatalf("device %d: packet %d has number 0x%X, want 0x%X", i, n, buf[1], want)
+			}
+		}
+	}
+}
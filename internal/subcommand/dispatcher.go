@@ -0,0 +1,277 @@
+package subcommand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"joyku/internal/report"
+	"joyku/internal/transport"
+)
+
+const (
+	defaultReplyTimeout = time.Second    // How long Request waits for a reply if the context has no deadline
+	readTimeout         = time.Second    // How long each read blocks before checking if the dispatcher was closed
+	maxSilentReads      = 1              // Number of consecutive read timeouts in full mode before the device is lost
+	maxReadRetries      = 5              // Number of consecutive read errors before the dispatcher gives up
+	reportBufferSize    = 8              // Number of reports buffered for Reports before new ones are dropped
+	replyAckOffset      = 13             // Offset of the ACK byte in a reply report
+	replyIDOffset       = 14             // Offset of the subcommand id in a reply report
+	replyDataOffset     = 15             // Offset of the reply data in a reply report
+	ackFlag             = 0x80           // Bit set in the ACK byte when the subcommand was acknowledged
+	ackDataTypeMask     = ^byte(ackFlag) // Bits of the ACK byte that describe the type of reply data
+)
+
+// ErrDispatcherClosed is returned for requests made after the dispatcher was closed or stopped reading
+var ErrDispatcherClosed = errors.New("dispatcher is closed")
+
+// Ack is the ACK byte of a subcommand reply
+type Ack byte
+
+// Acked returns true if the subcommand was acknowledged
+func (a Ack) Acked() bool {
+	return byte(a)&ackFlag != 0
+}
+
+// DataType returns the type of data in the reply (e.g. 0x10 for SPI flash reads), zero if there is no data
+func (a Ack) DataType() byte {
+	return byte(a) & ackDataTypeMask
+}
+
+// Reply is the reply a Joycon sent for a subcommand
+type Reply struct {
+	ID   SubcommandID // Subcommand the reply is for
+	Ack  Ack          // ACK byte of the reply
+	Data []byte       // Reply data that follows the subcommand id
+}
+
+// NackError is returned when a Joycon does not acknowledge a subcommand
+type NackError struct {
+	ID  SubcommandID
+	Ack Ack
+}
+
+func (e NackError) Error() string {
+	return fmt.Sprintf("subcommand 0x%02X was not acknowledged (0x%02X)", e.ID.Byte(), byte(e.Ack))
+}
+
+// Requester sends subcommands and waits for their replies
+type Requester interface {
+	Request(ctx context.Context, id SubcommandID, data []byte) (Reply, error)
+}
+
+// Dispatcher owns the reading side of a Joycon's transport. Subcommand replies (input report 0x21) are routed to the
+// request waiting for them, and every input report (including replies, since they also contain the Joycon's input
+// state) is sent to Reports. This allows subcommands to be sent while the Joycon is streaming input reports.
+type Dispatcher struct {
+	device      *Device
+	reports     chan []byte
+	pending     map[SubcommandID]chan Reply
+	requestLock sync.Mutex // Only one request is in flight at a time, the Joycon handles subcommands one by one
+	lock        sync.Mutex
+	done        chan struct{}
+	closed      bool
+	closeOnce   sync.Once
+	closeErr    error
+	dropped     atomic.Uint64 // Number of reports dropped because Reports was full
+}
+
+// NewDispatcher starts reading from the given transport. Close must be called to stop reading.
+func NewDispatcher(d transport.Transport) *Dispatcher {
+	dp := &Dispatcher{
+		device:  NewDevice(d),
+		reports: make(chan []byte, reportBufferSize),
+		pending: make(map[SubcommandID]chan Reply),
+		done:    make(chan struct{}),
+	}
+	go dp.read()
+	return dp
+}
+
+// Device returns the device that subcommands are sent to
+func (dp *Dispatcher) Device() *Device {
+	return dp.device
+}
+
+// Reports returns a channel that receives every input report. Reports are dropped if the channel is full, so replies
+// are never held up by a slow reader, see Dropped. The channel is closed once the dispatcher stops reading.
+func (dp *Dispatcher) Reports() <-chan []byte {
+	return dp.reports
+}
+
+// Dropped returns the number of input reports that were dropped because Reports wasn't read fast enough
+func (dp *Dispatcher) Dropped() uint64 {
+	return dp.dropped.Load()
+}
+
+// Done returns a channel that is closed once the dispatcher stops reading
+func (dp *Dispatcher) Done() <-chan struct{} {
+	return dp.done
+}
+
+// Send sends a subcommand without waiting for its reply
+func (dp *Dispatcher) Send(id SubcommandID, data []byte) error {
+	if dp.isClosed() {
+		return ErrDispatcherClosed
+	}
+	return Send(dp.device, id, data)
+}
+
+// Request sends a subcommand and waits for its reply. If the context has no deadline, the reply is waited on for one
+// second. A NackError is returned along with the reply if the Joycon did not acknowledge the subcommand.
+func (dp *Dispatcher) Request(ctx context.Context, id SubcommandID, data []byte) (Reply, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultReplyTimeout)
+		defer cancel()
+	}
+
+	dp.requestLock.Lock()
+	defer dp.requestLock.Unlock()
+
+	// The reply must be waited on before the subcommand is sent, otherwise it could arrive before we're listening
+	replyC := make(chan Reply, 1)
+	dp.lock.Lock()
+	if dp.closed {
+		dp.lock.Unlock()
+		return Reply{}, ErrDispatcherClosed
+	}
+	dp.pending[id] = replyC
+	dp.lock.Unlock()
+
+	defer func() {
+		dp.lock.Lock()
+		delete(dp.pending, id)
+		dp.lock.Unlock()
+	}()
+
+	if err := Send(dp.device, id, data); err != nil {
+		return Reply{}, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return Reply{}, fmt.Errorf("no reply to subcommand 0x%02X: %w", id.Byte(), ctx.Err())
+	case <-dp.done:
+		return Reply{}, ErrDispatcherClosed
+	case reply := <-replyC:
+		if !reply.Ack.Acked() {
+			return reply, NackError{ID: id, Ack: reply.Ack}
+		}
+		return reply, nil
+	}
+}
+
+// Close stops reading and closes the transport. Reading is stopped before the transport is closed, since reading
+// from a closed HID device is not safe, so this can block for up to a second.
+func (dp *Dispatcher) Close() error {
+	dp.closeOnce.Do(func() {
+		dp.lock.Lock()
+		dp.closed = true
+		dp.lock.Unlock()
+
+		<-dp.done
+		dp.closeErr = dp.device.transport.Close()
+	})
+	return dp.closeErr
+}
+
+func (dp *Dispatcher) isClosed() bool {
+	dp.lock.Lock()
+	defer dp.lock.Unlock()
+	return dp.closed
+}
+
+// read reads input reports until the dispatcher is closed, reading fails too many times in a row, or the device stops
+// sending full mode reports
+func (dp *Dispatcher) read() {
+	defer func() {
+		dp.lock.Lock()
+		dp.closed = true
+		dp.lock.Unlock()
+		close(dp.done)
+		close(dp.reports)
+	}()
+
+	retries := maxReadRetries
+	silent := 0        // Number of consecutive reads that timed out
+	streaming := false // Set once full mode reports arrive, which are sent at 60hz even when nothing changes
+	dropping := false  // Set while reports are being dropped, so a slow reader is only logged once until it catches up
+	for {
+		buf := make([]byte, report.ReportLengthBytes)
+		_, err := dp.device.transport.ReadWithTimeout(buf, readTimeout)
+		if dp.isClosed() {
+			return
+		}
+		if errors.Is(err, transport.ErrTimeout) {
+			// Joycons only send reports when their input changes until they are put into full mode. After that a
+			// silent Joycon was lost (e.g. it went out of range) even though its device is still open.
+			silent++
+			if streaming && silent >= maxSilentReads {
+				log.Printf("No input reports for %s, stopping reads\n", time.Duration(silent)*readTimeout)
+				return
+			}
+			continue
+		}
+		silent = 0
+		if errors.Is(err, transport.ErrClosed) {
+			// A closed transport never comes back, so there's no point in retrying
+			log.Println("Device was closed, stopping reads")
+			return
+		}
+		if err != nil {
+			if retries <= 0 {
+				log.Printf("Exceeded number of retries while reading from device: %s\n", err)
+				return
+			}
+			retries -= 1
+			log.Printf("An error occurred while reading from device: %s, retrying (%d left)\n", err, retries)
+			continue
+		}
+		// Reset number of retries after each successful read
+		retries = maxReadRetries
+
+		if buf[0] == report.StandardInputReportWithReplies.Byte() {
+			dp.reply(buf)
+		}
+		if buf[0] == report.StandardFullMode.Byte() {
+			streaming = true
+		}
+
+		select {
+		case dp.reports <- buf:
+			dropping = false
+		default:
+			if !dropping {
+				log.Println("Input reports aren't being read fast enough, dropping them")
+			}
+			dropping = true
+			dp.dropped.Add(1)
+		}
+	}
+}
+
+// reply routes a reply report to the request waiting for it, replies that nothing is waiting for are ignored
+func (dp *Dispatcher) reply(buf []byte) {
+	id := SubcommandID(buf[replyIDOffset])
+
+	dp.lock.Lock()
+	replyC, ok := dp.pending[id]
+	if ok {
+		delete(dp.pending, id)
+	}
+	dp.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	replyC <- Reply{
+		ID:   id,
+		Ack:  Ack(buf[replyAckOffset]),
+		Data: append([]byte{}, buf[replyDataOffset:]...),
+	}
+}
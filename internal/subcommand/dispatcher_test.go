@@ -0,0 +1,199 @@
+package subcommand
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"joyku/internal/report"
+	"joyku/internal/transport"
+)
+
+// fullModeReport returns a full mode input report with the given timer
+func fullModeReport(timer byte) []byte {
+	buf := make([]byte, report.ReportLengthBytes)
+	buf[0] = report.StandardFullMode.Byte()
+	buf[1] = timer
+	return buf
+}
+
+// replyReport returns a reply to the given subcommand with the given ACK byte and data
+func replyReport(id SubcommandID, ack byte, data []byte) []byte {
+	buf := make([]byte, report.ReportLengthBytes)
+	buf[0] = report.StandardInputReportWithReplies.Byte()
+	buf[replyAckOffset] = ack
+	buf[replyIDOffset] = id.Byte()
+	copy(buf[replyDataOffset:], data)
+	return buf
+}
+
+// serve sends every output report written to device to sent, and replies to subcommands with the given ACK byte
+// unless it's zero. It stops once the transport is closed.
+func serve(device transport.Transport, ack byte, sent chan<- []byte) {
+	for {
+		req := make([]byte, report.ReportLengthBytes)
+		if _, err := device.Read(req); err != nil {
+			return
+		}
+		if sent != nil {
+			sent <- req
+		}
+		if req[0] != subcommandOutputReport || ack == 0 {
+			continue
+		}
+
+		reply := make([]byte, report.ReportLengthBytes)
+		reply[0] = report.StandardInputReportWithReplies.Byte()
+		reply[replyAckOffset] = ack
+		reply[replyIDOffset] = req[10]
+		if _, err := device.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+func TestDispatcherRoutesRepliesWhileStreaming(t *testing.T) {
+	host, device := transport.NewMemoryPair()
+	dp := NewDispatcher(host)
+	defer dp.Close()
+
+	// Stream full mode reports around a reply to a different subcommand and the reply being waited on
+	go func() {
+		req := make([]byte, report.ReportLengthBytes)
+		if _, err := device.Read(req); err != nil {
+			return
+		}
+		id := SubcommandID(req[10])
+		device.Write(fullModeReport(0))
+		device.Write(replyReport(SetPlayerLights, ackFlag, []byte{0xFF}))
+		device.Write(fullModeReport(1))
+		device.Write(replyReport(id, ackFlag|0x10, []byte{0x01, 0x02}))
+		device.Write(fullModeReport(2))
+	}()
+
+	reply, err := dp.Request(context.Background(), SPIFlashRead, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.ID != SPIFlashRead || reply.Ack.DataType() != 0x10 || reply.Data[0] != 0x01 || reply.Data[1] != 0x02 {
+		t.Errorf("got reply %+v, want the reply to 0x%02X", reply, SPIFlashRead.Byte())
+	}
+
+	// Every report is still sent to Reports, including both replies
+	want := []byte{
+		report.StandardFullMode.Byte(),
+		report.StandardInputReportWithReplies.Byte(),
+		report.StandardFullMode.Byte(),
+		report.StandardInputReportWithReplies.Byte(),
+		report.StandardFullMode.Byte(),
+	}
+	for i, id := range want {
+		select {
+		case buf := <-dp.Reports():
+			if buf[0] != id {
+				t.Errorf("report %d is 0x%02X, want 0x%02X", i, buf[0], id)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("got %d reports, want %d", i, len(want))
+		}
+	}
+}
+
+func TestDispatcherNack(t *testing.T) {
+	host, device := transport.NewMemoryPair()
+	go serve(device, 0x03, nil)
+	dp := NewDispatcher(host)
+	defer dp.Close()
+
+	reply, err := dp.Request(context.Background(), EnableIMU, []byte{0x01})
+	var nack NackError
+	if !errors.As(err, &nack) {
+		t.Fatalf("got %v, want a NackError", err)
+	}
+	if nack.ID != EnableIMU || byte(nack.Ack) != 0x03 {
+		t.Errorf("got %+v, want a NACK for 0x%02X with ACK byte 0x03", nack, EnableIMU.Byte())
+	}
+	// The reply is returned along with the error so the caller can still look at it
+	if reply.ID != EnableIMU {
+		t.Errorf("got reply to 0x%02X, want 0x%02X", reply.ID.Byte(), EnableIMU.Byte())
+	}
+}
+
+func TestDispatcherCloseUnblocksRequests(t *testing.T) {
+	host, device := transport.NewMemoryPair()
+	go serve(device, 0, nil)
+	dp := NewDispatcher(host)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errC := make(chan error, 1)
+	go func() {
+		_, err := dp.Request(ctx, SPIFlashRead, nil)
+		errC <- err
+	}()
+
+	// Give the request time to be sent, it's never answered
+	time.Sleep(50 * time.Millisecond)
+	dp.Close()
+	select {
+	case err := <-errC:
+		if !errors.Is(err, ErrDispatcherClosed) {
+			t.Errorf("got %v, want %v", err, ErrDispatcherClosed)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("request is still waiting after the dispatcher was closed")
+	}
+	if _, err := dp.Request(ctx, SPIFlashRead, nil); !errors.Is(err, ErrDispatcherClosed) {
+		t.Errorf("got %v for a request after closing, want %v", err, ErrDispatcherClosed)
+	}
+}
+
+func TestDispatcherCountsDroppedReports(t *testing.T) {
+	host, device := transport.NewMemoryPair()
+	dp := NewDispatcher(host)
+	defer dp.Close()
+
+	const sent = 20
+	go func() {
+		for i := 0; i < sent; i++ {
+			device.Write(fullModeReport(byte(i)))
+		}
+		// Reports are read in order, so the reply is only seen after every report was sent to Reports or dropped
+		req := make([]byte, report.ReportLengthBytes)
+		if _, err := device.Read(req); err != nil {
+			return
+		}
+		device.Write(replyReport(SubcommandID(req[10]), ackFlag, nil))
+	}()
+
+	// Nothing reads Reports, so everything past its buffer is dropped
+	if _, err := dp.Request(context.Background(), SetInputReportMode, []byte{0x30}); err != nil {
+		t.Fatal(err)
+	}
+	if n := dp.Dropped(); n < sent-reportBufferSize {
+		t.Errorf("dropped %d reports, want at least %d", n, sent-reportBufferSize)
+	}
+}
+
+func TestDispatcherStopsWhenFullModeReportsStop(t *testing.T) {
+	host, device := transport.NewMemoryPair()
+	defer device.Close()
+	dp := NewDispatcher(host)
+	defer dp.Close()
+
+	// Before full mode a Joycon only reports changes, so it can be quiet for as long as it likes
+	select {
+	case <-dp.Done():
+		t.Fatal("dispatcher stopped before full mode reports were sent")
+	case <-time.After(readTimeout + 500*time.Millisecond):
+	}
+
+	device.Write(fullModeReport(0))
+	<-dp.Reports()
+	select {
+	case <-dp.Done():
+	case <-time.After(readTimeout*maxSilentReads + 2*time.Second):
+		t.Fatal("dispatcher is still reading after full mode reports stopped")
+	}
+}
@@ -1,56 +1,83 @@
 package subcommand
 
-import (
-	"math"
+import "math"
 
-	"github.com/sstallion/go-hid"
+// Frequency and amplitude limits supported by the Joycon's linear resonant actuators
+const (
+	MinHighFrequency = 81.75  // Lowest frequency (Hz) of the high band
+	MaxHighFrequency = 1252.0 // Highest frequency (Hz) of the high band
+	MinLowFrequency  = 40.875 // Lowest frequency (Hz) of the low band
+	MaxLowFrequency  = 626.0  // Highest frequency (Hz) of the low band
+	MaxAmplitude     = 1.0    // Highest safe amplitude - larger values can damage the actuators
 )
 
-func NewRumbleCommand(d *hid.Device, freq float64, amp float64) Subcommand {
-	freqHF, freqLF := encodeFreq(freq)
-	ampHF, ampLF := encodeAmp(amp)
+// NewRumbleCommand returns a rumble only command (output report 0x10) that vibrates both bands with the given
+// frequencies (Hz) and amplitudes (0-1)
+func NewRumbleCommand(d *Device, highFreq, highAmp, lowFreq, lowAmp float64) Subcommand {
+	return Subcommand{
+		Rumble:     EncodeRumble(highFreq, highAmp, lowFreq, lowAmp),
+		RumbleOnly: true,
+		device:     d,
+	}
+}
+
+// EncodeRumble encodes the given frequencies (Hz) and amplitudes (0-1) into the 8 bytes of rumble data sent with an
+// output report. The same data is used for the left and right halves so it works for either Joycon.
+// https://github.com/dekuNukem/Nintendo_Switch_Reverse_Engineering/blob/master/rumble_data_table.md
+func EncodeRumble(highFreq, highAmp, lowFreq, lowAmp float64) []byte {
+	hf := encodeHighFreq(highFreq)
+	hfAmp := uint16(encodeAmp(highAmp)) * 2
+	lf := encodeLowFreq(lowFreq)
+	lfAmp := encodeLowAmp(encodeAmp(lowAmp))
 
 	data := make([]byte, 8)
 	//Byte swapping
-	data[0] = byte(freqHF & 0xFF)
-	data[1] = byte(ampHF) + byte((freqHF>>8)&0xFF) //Add amp + 1st byte of frequency to amplitude byte
+	data[0] = byte(hf & 0xFF)
+	data[1] = byte(hfAmp) + byte((hf>>8)&0xFF) //Add amp + 1st byte of frequency to amplitude byte
 
 	//Byte swapping
-	data[2] = freqLF + ((ampLF >> 8) & 0xFF) //Add freq + 1st byte of LF amplitude to the frequency byte
-	data[3] = ampLF & 0xFF
+	data[2] = lf + byte((lfAmp>>8)&0xFF) //Add freq + 1st byte of LF amplitude to the frequency byte
+	data[3] = byte(lfAmp & 0xFF)
 
-	return Subcommand{
-		Data:       make([]byte, 8), // purposely empty since this is rumble only
-		RumbleOnly: true,
-		device:     d,
-	}
+	copy(data[4:], data[:4])
+	return data
+}
+
+// encodeFreq returns the encoded value of the given frequency
+func encodeFreq(freq float64) uint8 {
+	return uint8(math.Round(math.Log2(freq/10.0) * 32.0))
 }
 
-// encodeFreq encodes the given frequency value and returns the high and low values
-func encodeFreq(freq float64) (uint16, uint8) {
-	// Clamp freq to prevent going above safe boundries
-	freq = math.Min(freq, 1252.0)
-	// Encode algorithm for frequency
-	encodedFreq := uint8(math.Round(math.Log2(freq/10) * 32.0))
-	// Convert to Joy-Con HF range. Range in big-endian: 0x0004-0x01FC with +0x0004 steps.
-	hf := uint16((encodedFreq - 0x60) * 4)
-	// Convert to Joy-Con LF range. Range: 0x01-0x7F.
-	lf := uint8(encodedFreq - 0x40)
-	// Return both high and low frequency values
-	return hf, lf
+// encodeHighFreq returns the encoded high band frequency. Range in big-endian: 0x0004-0x01FC with +0x0004 steps.
+func encodeHighFreq(freq float64) uint16 {
+	freq = math.Max(MinHighFrequency, math.Min(freq, MaxHighFrequency))
+	return (uint16(encodeFreq(freq)) - 0x60) * 4
 }
 
-func encodeAmp(amp float64) (uint16, uint8) {
-	// Clamp freq to prevent going above safe boundries
-	amp = math.Min(amp, 1.00)
+// encodeLowFreq returns the encoded low band frequency. Range: 0x01-0x7F.
+func encodeLowFreq(freq float64) uint8 {
+	freq = math.Max(MinLowFrequency, math.Min(freq, MaxLowFrequency))
+	return encodeFreq(freq) - 0x40
+}
+
+// encodeAmp returns the encoded value of the given amplitude, amplitudes too small to be felt are encoded as 0
+func encodeAmp(amp float64) uint8 {
+	// Clamp amp to prevent going above safe boundries
+	amp = math.Min(amp, MaxAmplitude)
 	// Float amplitude to hex conversion
-	var encodedAmp uint8
+	var encodedAmp float64
 	if amp > 0.23 {
-		encodedAmp = uint8(math.Round(math.Log2(amp*8.7) * 32.0))
+		encodedAmp = math.Round(math.Log2(amp*8.7) * 32.0)
 	} else if amp > 0.12 {
-		encodedAmp = uint8(math.Round(math.Log2(amp*17.0) * 16.0))
+		encodedAmp = math.Round(math.Log2(amp*17.0) * 16.0)
+	} else if amp > 0 {
+		encodedAmp = math.Max(0, math.Round(math.Log2(amp*17.0)*16.0))
 	}
-	hf := uint16(encodedAmp * 2) // encoded_hex_amp<<1;
-	lf := encodedAmp/2 + 64      // (encoded_hex_amp>>1)+0x40;
-	return hf, lf
+	return uint8(encodedAmp)
+}
+
+// encodeLowAmp returns the low band amplitude for an encoded amplitude. The lowest bit of the encoded amplitude is
+// stored in the highest bit of the frequency byte.
+func encodeLowAmp(encodedAmp uint8) uint16 {
+	return uint16(encodedAmp>>1) + 0x40 + uint16(encodedAmp&1)<<15
 }
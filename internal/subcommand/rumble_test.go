@@ -0,0 +1,40 @@
+package subcommand
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeRumble(t *testing.T) {
+	tests := []struct {
+		name                               string
+		highFreq, highAmp, lowFreq, lowAmp float64
+		want                               []byte // Left half, the right half is the same
+	}{
+		{"neutral", 320, 0, 160, 0, RumbleDefault[:4]},
+		{"full amplitude", 320, 1, 160, 1, []byte{0x00, 0xC9, 0x40, 0x72}},
+		{"half amplitude", 160, 0.5, 80, 0.5, []byte{0x80, 0x88, 0x20, 0x62}},
+		// The lowest bit of an odd low band amplitude is stored in the frequency byte
+		{"odd amplitude", 640, 0.7, 320, 0.7, []byte{0x80, 0xA7, 0xE0, 0x69}},
+		{"amplitude above the limit", 320, 5, 160, 5, []byte{0x00, 0xC9, 0x40, 0x72}},
+		{"frequencies above the limit", 5000, 0, 10000, 0, []byte{0xFC, 0x01, 0x7F, 0x40}},
+		{"frequencies below the limit", 1, 0, 10, 0, []byte{0x04, 0x00, 0x01, 0x40}},
+		{"highest frequencies", MaxHighFrequency, 0, MaxLowFrequency, 0, []byte{0xFC, 0x01, 0x7F, 0x40}},
+		{"lowest frequencies", MinHighFrequency, 0, MinLowFrequency, 0, []byte{0x04, 0x00, 0x01, 0x40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EncodeRumble(tt.highFreq, tt.highAmp, tt.lowFreq, tt.lowAmp)
+			want := append(append([]byte{}, tt.want...), tt.want...)
+			if !bytes.Equal(got, want) {
+				t.Errorf("got % X, want % X", got, want)
+			}
+		})
+	}
+}
+
+func TestEncodeRumbleDefault(t *testing.T) {
+	if got := EncodeRumble(320, 0, 160, 0); !bytes.Equal(got, RumbleDefault) {
+		t.Errorf("got % X, want RumbleDefault (% X)", got, RumbleDefault)
+	}
+}
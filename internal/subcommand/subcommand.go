@@ -3,12 +3,13 @@ package subcommand
 import (
 	"fmt"
 	"joyku/internal/report"
-
-	"github.com/sstallion/go-hid"
 )
 
 const (
-	maxPacketNumber = 15
+	maxPacketNumber = 0x0F
+
+	subcommandOutputReport byte = 0x01 // Output report with rumble data and a subcommand
+	rumbleOutputReport     byte = 0x10 // Output report with only rumble data
 )
 
 // SubcommandID is an alias for a byte value used to identify subcommands
@@ -16,12 +17,20 @@ type SubcommandID byte
 
 // Group of subcommands and their ids
 const (
+	// Subcommand used to request device info (firmware version, controller type, and MAC address)
+	RequestDeviceInfo SubcommandID = 0x02
 	// Subcommand used to set the type of input mode outputted from the device
 	SetInputReportMode SubcommandID = 0x03
 	// Subcommand used to set state of Host Controller Interface (disconnect/page/pair/turn off)
 	SetHCIState SubcommandID = 0x06
 	// Subcommand used to read from the SPI flash
 	SPIFlashRead SubcommandID = 0x10
+	// Subcommand used to write to the SPI flash
+	SPIFlashWrite SubcommandID = 0x11
+	// Subcommand used to set the player lights
+	SetPlayerLights SubcommandID = 0x30
+	// Subcommand used to set the HOME light
+	SetHomeLight SubcommandID = 0x38
 	// Subcommand used to enable or disable the IMU
 	EnableIMU SubcommandID = 0x40
 	// Subcommand used to enable or disable vibration
@@ -33,9 +42,6 @@ func (s SubcommandID) Byte() byte {
 	return byte(s)
 }
 
-// 4 bit value - will loop back to 0 every 15 packets
-var globalPacketNumber byte = 0
-
 // Default neutral values
 var RumbleDefault = []byte{0x00, 0x01, 0x40, 0x40, 0x00, 0x01, 0x40, 0x40}
 
@@ -44,10 +50,10 @@ type Subcommand struct {
 	RumbleOnly bool
 	Rumble     []byte
 	Data       []byte
-	device     *hid.Device
+	device     *Device
 }
 
-func NewInputReportCommand(d *hid.Device) Subcommand {
+func NewInputReportCommand(d *Device) Subcommand {
 	return Subcommand{
 		ID:     SetInputReportMode,
 		Data:   []byte{0x30},
@@ -55,24 +61,39 @@ func NewInputReportCommand(d *hid.Device) Subcommand {
 	}
 }
 
+// Send sends this subcommand to its device. Rumble only commands are sent with output report 0x10, everything else
+// is sent with output report 0x01.
+func (s Subcommand) Send() error {
+	rumble := s.Rumble
+	if rumble == nil {
+		rumble = RumbleDefault
+	}
+
+	if s.RumbleOnly {
+		buf := make([]byte, report.ReportLengthBytes)
+		buf[0] = rumbleOutputReport
+		bufferCopy(buf, rumble, 2)
+		return s.device.write(buf)
+	}
+	return send(s.device, rumble, s.ID, s.Data)
+}
+
 // Sends a subcommand to joycon with the given subcommand id (sid) and data (sd)
 // https://github.com/dekuNukem/Nintendo_Switch_Reverse_Engineering/blob/master/bluetooth_hid_notes.md
-func Send(d *hid.Device, sid SubcommandID, sd []byte) error {
+func Send(d *Device, sid SubcommandID, sd []byte) error {
+	return send(d, RumbleDefault, sid, sd)
+}
+
+func send(d *Device, rumble []byte, sid SubcommandID, sd []byte) error {
 	buf := make([]byte, report.ReportLengthBytes)
-	buf[0] = 1
-	buf[1] = globalPacketNumber
+	buf[0] = subcommandOutputReport
 
-	bufferCopy(buf, RumbleDefault, 2)
+	bufferCopy(buf, rumble, 2)
 	// Set subcommand id and data
 	buf[10] = sid.Byte()
 	bufferCopy(buf, sd, 11)
 
-	_, err := d.Write(buf)
-	if err != nil {
-		return fmt.Errorf("could not write to device: %s", err.Error())
-	}
-	globalPacketNumber = (globalPacketNumber + 1) % 15
-	return nil
+	return d.write(buf)
 }
 
 // bufferCopy copies all the data from src to dst starting at start (inclusive)
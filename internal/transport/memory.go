@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"sync"
+	"time"
+)
+
+// Number of reports that can be written to a Memory transport before writes block
+const memoryBufferSize = 64
+
+// Memory is an in-memory Transport. Memory transports are created in connected pairs where reports written to one end
+// are read from the other, which makes it possible to talk to a fake Joycon without any hardware.
+type Memory struct {
+	in     <-chan []byte
+	out    chan<- []byte
+	done   chan struct{}
+	closer *sync.Once
+}
+
+// NewMemoryPair returns two connected in-memory transports. Typically the host end is given to a Joycon and the
+// device end is used to answer its requests. Closing either end closes both.
+func NewMemoryPair() (host *Memory, device *Memory) {
+	hostToDevice := make(chan []byte, memoryBufferSize)
+	deviceToHost := make(chan []byte, memoryBufferSize)
+	done := make(chan struct{})
+	closer := new(sync.Once)
+
+	host = &Memory{in: deviceToHost, out: hostToDevice, done: done, closer: closer}
+	device = &Memory{in: hostToDevice, out: deviceToHost, done: done, closer: closer}
+	return host, device
+}
+
+// Read blocks until a report has been written to the other end of the pair or the transport is closed. Reports written
+// before the transport was closed are still read, so nothing sent right before closing is lost.
+func (m *Memory) Read(p []byte) (int, error) {
+	select {
+	case report := <-m.in:
+		return copy(p, report), nil
+	case <-m.done:
+		return m.drain(p)
+	}
+}
+
+// ReadWithTimeout is the same as Read, but returns ErrTimeout if no report is written before the timeout
+func (m *Memory) ReadWithTimeout(p []byte, timeout time.Duration) (int, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case report := <-m.in:
+		return copy(p, report), nil
+	case <-m.done:
+		return m.drain(p)
+	case <-timer.C:
+		return 0, ErrTimeout
+	}
+}
+
+// Write sends a copy of p to the other end of the pair
+func (m *Memory) Write(p []byte) (int, error) {
+	report := make([]byte, len(p))
+	copy(report, p)
+
+	// Check for closure first so writes never succeed after Close
+	select {
+	case <-m.done:
+		return 0, ErrClosed
+	default:
+	}
+
+	select {
+	case m.out <- report:
+		return len(p), nil
+	case <-m.done:
+		return 0, ErrClosed
+	}
+}
+
+// drain reads a report that was written before the transport was closed, ErrClosed is returned once there are none
+func (m *Memory) drain(p []byte) (int, error) {
+	select {
+	case report := <-m.in:
+		return copy(p, report), nil
+	default:
+		return 0, ErrClosed
+	}
+}
+
+// Close closes both ends of the pair
+func (m *Memory) Close() error {
+	m.closer.Do(func() {
+		close(m.done)
+	})
+	return nil
+}
@@ -0,0 +1,26 @@
+package transport
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrClosed  = errors.New("transport is closed")
+	ErrTimeout = errors.New("timed out waiting for report")
+)
+
+// Transport is a packet oriented connection to a Joycon. Each call to Write sends a single output report and each call
+// to Read receives a single input report.
+//
+// Implementations must return ErrTimeout from ReadWithTimeout when no report arrives in time.
+type Transport interface {
+	// Read blocks until an input report is available and copies it into p
+	Read(p []byte) (int, error)
+	// ReadWithTimeout is the same as Read, but gives up after the given timeout
+	ReadWithTimeout(p []byte, timeout time.Duration) (int, error)
+	// Write sends p as a single output report
+	Write(p []byte) (int, error)
+	// Close closes the connection, any blocked reads are released
+	Close() error
+}
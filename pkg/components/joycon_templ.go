@@ -85,51 +85,87 @@ func RenderJoycon(joycon *joycon.Joycon) templ.Component {
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
+		} else if joycon.IsPro() {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "<svg style=\"")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			var templ_7745c5c3_Var4 string
+			templ_7745c5c3_Var4, templ_7745c5c3_Err = templruntime.SanitizeStyleAttributeValues(getJoyconColor(joycon))
+			if templ_7745c5c3_Err != nil {
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `pkg/components/joycon.templ`, Line: 47, Col: 47}
+			}
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var4))
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "\" id=\"pro-controller\" xmlns=\"http://www.w3.org/2000/svg\" width=\"275\" height=\"190\" viewBox=\"0 0 275 190\"><path stroke=\"#fff\" d=\"M60 .5h155c32.861 0 59.5 26.639 59.5 59.5v70c0 32.861-26.639 59.5-59.5 59.5h-20c-16 0-25-20-57.5-20s-41.5 20-57.5 20H60C27.139 189.5.5 162.861.5 130V60C.5 27.139 27.139.5 60 .5Z\"></path> <circle cx=\"60\" cy=\"60\" r=\"22.5\" fill=\"#D9D9D9\"></circle> <circle cx=\"170\" cy=\"115\" r=\"22.5\" fill=\"#D9D9D9\"></circle> <circle cx=\"215\" cy=\"45\" r=\"7.5\" fill=\"#D9D9D9\"></circle> <circle cx=\"215\" cy=\"75\" r=\"7.5\" fill=\"#D9D9D9\"></circle> <circle cx=\"200\" cy=\"60\" r=\"7.5\" fill=\"#D9D9D9\"></circle> <circle cx=\"230\" cy=\"60\" r=\"7.5\" fill=\"#D9D9D9\"></circle> <path fill=\"#D9D9D9\" d=\"M95 107h10v30H95zM85 117h30v10H85z\"></path> <circle cx=\"155\" cy=\"60\" r=\"6.5\" fill=\"#D9D9D9\"></circle> <circle cx=\"155\" cy=\"60\" r=\"4.5\" fill=\"#484848\"></circle> <path fill=\"#D9D9D9\" d=\"M113 55h12v10h-12z\"></path></svg>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "<div class=\"info\" hx-vals=\"js:{&#39;joycon&#39;: document.querySelector(&#39;p &gt; .serial-number&#39;).textContent}\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "<div class=\"info\" hx-vals=\"js:{&#39;joycon&#39;: document.querySelector(&#39;p &gt; .serial-number&#39;).textContent}\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
 		if joycon.IsLeft() {
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "<h3>Left Joycon</h3>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, "<h3>Left Joycon</h3>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 		} else if joycon.IsRight() {
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "<h3>Right Joycon</h3>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 10, "<h3>Right Joycon</h3>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
+		} else if joycon.IsPro() {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 11, "<h3>Pro Controller</h3>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 12, "<p>Serial: <span class=\"serial-number\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var5 string
+		templ_7745c5c3_Var5, templ_7745c5c3_Err = templ.JoinStringErrs(joycon.Serial)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `pkg/components/joycon.templ`, Line: 69, Col: 66}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var5))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, "<p>Serial: <span class=\"serial-number\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 13, "</span></p><p>Battery: Unknown</p><p>Firmware: ")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		var templ_7745c5c3_Var4 string
-		templ_7745c5c3_Var4, templ_7745c5c3_Err = templ.JoinStringErrs(joycon.Serial)
+		var templ_7745c5c3_Var6 string
+		templ_7745c5c3_Var6, templ_7745c5c3_Err = templ.JoinStringErrs(joycon.Firmware.String())
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `pkg/components/joycon.templ`, Line: 53, Col: 66}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `pkg/components/joycon.templ`, Line: 71, Col: 51}
 		}
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var4))
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var6))
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 10, "</span></p><p>Battery: Unknown</p>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 14, "</p>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
 		if !joycon.IsConnected() {
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 11, "<button class=\"btn\" role=\"button\" hx-post=\"/connect\" hx-target=\"closest .joycon\">Connect</button>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 15, "<button class=\"btn\" role=\"button\" hx-post=\"/connect\" hx-target=\"closest .joycon\">Connect</button>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 		} else {
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 12, "<button class=\"btn\" role=\"button\" hx-post=\"/disconnect\" hx-confirm=\"Are you sure you want to disconnect this Joycon?\" hx-target=\"#joycon-container\" sse-connect=\"/events\">Disconnect</button>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 16, "<button class=\"btn\" role=\"button\" hx-post=\"/disconnect\" hx-confirm=\"Are you sure you want to disconnect this Joycon?\" hx-target=\"#joycon-container\" sse-connect=\"/events\">Disconnect</button>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 13, "</div></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 17, "</div></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
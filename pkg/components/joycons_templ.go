@@ -77,6 +77,11 @@ func RenderJoycons(joycons joycon.Pair) templ.Component {
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
+		} else if joycons.Pro != nil {
+			templ_7745c5c3_Err = RenderJoycon(joycons.Pro).Render(ctx, templ_7745c5c3_Buffer)
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
 		} else {
 			if joycons.Left != nil {
 				templ_7745c5c3_Err = RenderJoycon(joycons.Left).Render(ctx, templ_7745c5c3_Buffer)
@@ -0,0 +1,166 @@
+package emulator
+
+import (
+	"fmt"
+	"joyku/internal/transport"
+	"joyku/pkg/joycon"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Environment variables read by FromEnvironment
+const (
+	EnvControllers = "JOYKU_EMULATOR"        // Comma separated list of controllers to emulate (e.g. "left,right" or "pro")
+	EnvScript      = "JOYKU_EMULATOR_SCRIPT" // Optional path to a script used as the input source of every controller
+)
+
+// Backend is a joycon.Backend that discovers emulated controllers instead of HID devices
+type Backend struct {
+	controllers []*Controller
+	open        map[*Controller][]transport.Transport // Connections opened to each controller
+	lock        sync.Mutex
+}
+
+// NewBackend returns a backend that discovers the given controllers
+func NewBackend(controllers ...*Controller) *Backend {
+	return &Backend{controllers: controllers, open: make(map[*Controller][]transport.Transport)}
+}
+
+// FromEnvironment returns a backend with the controllers listed in the JOYKU_EMULATOR environment variable. If the
+// variable is not set, nil is returned.
+func FromEnvironment() (*Backend, error) {
+	spec := os.Getenv(EnvControllers)
+	if spec == "" {
+		return nil, nil
+	}
+
+	var source InputSource
+	if path := os.Getenv(EnvScript); path != "" {
+		script, err := LoadScript(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not load emulator script: %w", err)
+		}
+		source = script
+	}
+
+	b := NewBackend()
+	for i, kind := range strings.Split(spec, ",") {
+		// Locally administered MAC addresses so they never collide with a real controller
+		serial := fmt.Sprintf("02:00:00:00:00:%02X", i+1)
+
+		var c *Controller
+		switch strings.ToLower(strings.TrimSpace(kind)) {
+		case "left":
+			c = NewLeft(serial)
+		case "right":
+			c = NewRight(serial)
+		case "pro":
+			c = NewPro(serial)
+		default:
+			return nil, fmt.Errorf("unknown emulated controller %q, expected left, right, or pro", kind)
+		}
+		if source != nil {
+			c.SetInputSource(source)
+		}
+		b.Add(c)
+	}
+	return b, nil
+}
+
+// Add makes the given controller discoverable
+func (b *Backend) Add(c *Controller) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.controllers = append(b.controllers, c)
+}
+
+// Remove makes the given controller undiscoverable and closes every connection to it, as if it was unplugged
+func (b *Backend) Remove(c *Controller) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for i, other := range b.controllers {
+		if other == c {
+			b.controllers = append(b.controllers[:i], b.controllers[i+1:]...)
+			break
+		}
+	}
+	for _, t := range b.open[c] {
+		t.Close()
+	}
+	delete(b.open, c)
+}
+
+// Controllers returns every controller that can be discovered
+func (b *Backend) Controllers() []*Controller {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return append([]*Controller{}, b.controllers...)
+}
+
+func (b *Backend) Enumerate(fn func(info joycon.DeviceInfo) error) error {
+	for _, c := range b.Controllers() {
+		err := fn(joycon.DeviceInfo{ProductID: c.ProductID, Serial: c.Serial, Name: c.Name})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backend) Open(info joycon.DeviceInfo) (joycon.Transport, error) {
+	for _, c := range b.Controllers() {
+		if !strings.EqualFold(c.Serial, info.Serial) {
+			continue
+		}
+
+		host, device := transport.NewMemoryPair()
+		b.lock.Lock()
+		b.open[c] = append(b.open[c], host)
+		b.lock.Unlock()
+
+		go func() {
+			if err := c.Serve(device); err != nil {
+				log.Printf("Emulated controller %s stopped: %s\n", c, err)
+			}
+			b.forget(c, host)
+		}()
+		return host, nil
+	}
+	return nil, fmt.Errorf("no emulated controller with serial %s", info.Serial)
+}
+
+// forget removes a connection that is no longer served from the connections opened to c
+func (b *Backend) forget(c *Controller, t transport.Transport) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	open := b.open[c]
+	for i, other := range open {
+		if other == t {
+			b.open[c] = append(open[:i], open[i+1:]...)
+			break
+		}
+	}
+	if len(b.open[c]) == 0 {
+		delete(b.open, c)
+	}
+}
+
+// Close closes every connection opened by this backend
+func (b *Backend) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, open := range b.open {
+		for _, t := range open {
+			t.Close()
+		}
+	}
+	b.open = make(map[*Controller][]transport.Transport)
+	return nil
+}
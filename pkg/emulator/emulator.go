@@ -0,0 +1,311 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"joyku/internal/report"
+	"joyku/internal/spi"
+	"joyku/internal/subcommand"
+	"joyku/internal/transport"
+	"joyku/pkg/joycon"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	ReportRate = time.Second / 60 // Rate at which full mode input reports are sent
+
+	ack           byte = 0x80 // ACK byte sent for subcommands without reply data
+	deviceInfoAck byte = 0x82 // ACK byte sent in reply to device info requests
+	spiAck        byte = 0x90 // ACK byte sent in reply to SPI flash reads
+	nack          byte = 0x00 // NACK byte sent for unsupported or invalid subcommands
+	restingAccelZ      = 4096 // Raw accelerometer value for 1G with the factory calibration from NewFlash
+)
+
+// Firmware version reported by emulated controllers
+var defaultFirmware = joycon.FirmwareVersion{Major: 0x04, Minor: 0x33}
+
+// State is the input state of an emulated controller
+type State struct {
+	Buttons         joycon.Button       // Buttons that are currently pressed
+	StickHorizontal uint16              // 12-bit horizontal stick value (the left stick of a Pro Controller)
+	StickVertical   uint16              // 12-bit vertical stick value (the left stick of a Pro Controller)
+	RightHorizontal uint16              // 12-bit horizontal value of the right stick of a Pro Controller
+	RightVertical   uint16              // 12-bit vertical value of the right stick of a Pro Controller
+	Accel           [3]int16            // Raw accelerometer values (X, Y, Z)
+	Gyro            [3]int16            // Raw gyroscope values (X, Y, Z)
+	Battery         joycon.BatteryLevel // Battery level reported by the controller
+}
+
+// NeutralState returns the state of a controller resting flat on a table with nothing pressed
+func NeutralState() State {
+	return State{
+		StickHorizontal: defaultStickCenter,
+		StickVertical:   defaultStickCenter,
+		RightHorizontal: defaultStickCenter,
+		RightVertical:   defaultStickCenter,
+		Accel:           [3]int16{0, 0, restingAccelZ},
+		Battery:         joycon.Full,
+	}
+}
+
+// InputSource provides the input state of an emulated controller over time
+type InputSource interface {
+	// State returns the input state the given amount of time after the controller started streaming
+	State(elapsed time.Duration) State
+}
+
+// Controller is a software Joycon that speaks the same HID protocol as the real thing. It answers the subcommands
+// sent by the joycon package and streams full mode input reports once the host has enabled them.
+type Controller struct {
+	ProductID uint16                 // Either joycon.LeftJoyconProductID or joycon.RightJoyconProductID
+	Serial    string                 // Serial number (MAC address) of the controller
+	Name      string                 // Product name of the controller
+	Flash     []byte                 // Virtual SPI flash memory, guarded by the controller's lock once it's being served
+	Firmware  joycon.FirmwareVersion // Firmware version reported in device info replies
+
+	source InputSource
+	state  State
+	lock   sync.Mutex
+}
+
+// NewLeft returns an emulated left Joycon with the given serial number
+func NewLeft(serial string) *Controller {
+	return &Controller{
+		ProductID: joycon.LeftJoyconProductID,
+		Serial:    serial,
+		Name:      "Joy-Con (L)",
+		Firmware:  defaultFirmware,
+		Flash:     NewFlash(color.RGBA{0x0A, 0xB9, 0xE6, 0xFF}, color.RGBA{0x00, 0x1E, 0x1E, 0xFF}),
+		state:     NeutralState(),
+	}
+}
+
+// NewRight returns an emulated right Joycon with the given serial number
+func NewRight(serial string) *Controller {
+	return &Controller{
+		ProductID: joycon.RightJoyconProductID,
+		Serial:    serial,
+		Name:      "Joy-Con (R)",
+		Firmware:  defaultFirmware,
+		Flash:     NewFlash(color.RGBA{0xFF, 0x3C, 0x28, 0xFF}, color.RGBA{0x1E, 0x0A, 0x0A, 0xFF}),
+		state:     NeutralState(),
+	}
+}
+
+// NewPro returns an emulated Pro Controller with the given serial number
+func NewPro(serial string) *Controller {
+	return &Controller{
+		ProductID: joycon.ProController,
+		Serial:    serial,
+		Name:      "Pro Controller",
+		Firmware:  defaultFirmware,
+		Flash:     NewFlash(color.RGBA{0x32, 0x32, 0x32, 0xFF}, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}),
+		state:     NeutralState(),
+	}
+}
+
+// SetState sets the input state of the controller. This replaces any input source set with SetInputSource.
+func (c *Controller) SetState(s State) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.source = nil
+	c.state = s
+}
+
+// SetInputSource sets the source used to determine the controller input state while streaming
+func (c *Controller) SetInputSource(src InputSource) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.source = src
+}
+
+func (c *Controller) currentState(elapsed time.Duration) State {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.source != nil {
+		return c.source.State(elapsed)
+	}
+	return c.state
+}
+
+// Serve answers requests from the host on the given transport until it is closed or the host powers the
+// controller off. The transport is closed before returning.
+func (c *Controller) Serve(t transport.Transport) error {
+	defer t.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	requests := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(requests)
+		for {
+			buf := make([]byte, report.ReportLengthBytes)
+			_, err := t.Read(buf)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case requests <- buf:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var timer byte
+	var streamStart time.Time
+	ticker := time.NewTicker(ReportRate)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				err := <-readErr
+				if err == transport.ErrClosed {
+					return nil
+				}
+				return err
+			}
+			// Output report 0x01 contains rumble data and a subcommand, all other reports (e.g. rumble only) are ignored
+			if req[0] != 0x01 {
+				continue
+			}
+
+			id := subcommand.SubcommandID(req[10])
+			ackByte, reply := c.handleSubcommand(id, req[11:])
+			if id == subcommand.SetInputReportMode && ackByte == ack && req[11] == report.StandardFullMode.Byte() {
+				streamStart = time.Now()
+			}
+
+			buf := c.inputReport(report.StandardInputReportWithReplies, timer, c.currentState(time.Since(streamStart)))
+			buf[13] = ackByte
+			buf[14] = id.Byte()
+			copy(buf[15:], reply)
+			timer++
+			if _, err := t.Write(buf); err != nil {
+				return err
+			}
+
+			if id == subcommand.SetHCIState && req[11] == subcommand.HCIDisconnect {
+				log.Printf("Emulated controller %s was powered off\n", c.Serial)
+				return nil
+			}
+		case <-ticker.C:
+			if streamStart.IsZero() {
+				continue
+			}
+			buf := c.inputReport(report.StandardFullMode, timer, c.currentState(time.Since(streamStart)))
+			timer++
+			if _, err := t.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleSubcommand returns the ACK byte and reply data for the given subcommand
+func (c *Controller) handleSubcommand(id subcommand.SubcommandID, data []byte) (byte, []byte) {
+	switch id {
+	case subcommand.RequestDeviceInfo:
+		return deviceInfoAck, c.deviceInfo()
+	case subcommand.SPIFlashRead:
+		address := binary.LittleEndian.Uint32(data[0:4])
+		size := uint32(data[4])
+		// Each transport is served by its own goroutine, so flash is locked while it's read or written
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if size > uint32(spi.MaxFlashReadInBytes) || uint64(address)+uint64(size) > uint64(len(c.Flash)) {
+			return nack, nil
+		}
+		reply := append([]byte{}, data[0:5]...)
+		return spiAck, append(reply, c.Flash[address:address+size]...)
+	case subcommand.SPIFlashWrite:
+		address := binary.LittleEndian.Uint32(data[0:4])
+		size := uint32(data[4])
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if size > uint32(spi.MaxFlashWriteInBytes) || uint64(address)+uint64(size) > uint64(len(c.Flash)) {
+			return nack, nil
+		}
+		copy(c.Flash[address:address+size], data[5:5+size])
+		// A status of zero means the write succeeded
+		return ack, []byte{0x00}
+	case subcommand.SetInputReportMode, subcommand.EnableIMU, subcommand.EnableVibration, subcommand.SetHCIState,
+		subcommand.SetPlayerLights, subcommand.SetHomeLight:
+		return ack, nil
+	default:
+		return nack, nil
+	}
+}
+
+// deviceInfo returns the reply to a device info request
+func (c *Controller) deviceInfo() []byte {
+	controllerType := joycon.ControllerTypeRight
+	switch c.ProductID {
+	case joycon.LeftJoyconProductID:
+		controllerType = joycon.ControllerTypeLeft
+	case joycon.ProController:
+		controllerType = joycon.ControllerTypePro
+	}
+
+	// The serial number of a controller is its MAC address
+	mac, err := net.ParseMAC(c.Serial)
+	if err != nil || len(mac) != 6 {
+		mac = make(net.HardwareAddr, 6)
+	}
+
+	info := []byte{c.Firmware.Major, c.Firmware.Minor, byte(controllerType), 0x02}
+	info = append(info, mac...)
+	// The last byte is 0x01 when the colors in SPI flash should be used
+	return append(info, 0x01, 0x01)
+}
+
+// inputReport returns an input report with the given id that contains the given input state
+func (c *Controller) inputReport(id report.InputReport, timer byte, s State) []byte {
+	buf := make([]byte, report.ReportLengthBytes)
+	buf[0] = id.Byte()
+	buf[1] = timer
+	// Battery level in the high nibble, connection info in the low nibble (bluetooth powered Joycon)
+	buf[2] = byte(s.Battery)<<4 | 0x0E
+	buf[3] = byte(s.Buttons)
+	buf[4] = byte(s.Buttons >> 8)
+	buf[5] = byte(s.Buttons >> 16)
+
+	stick := packStickValues(s.StickHorizontal, s.StickVertical)
+	switch c.ProductID {
+	case joycon.LeftJoyconProductID:
+		copy(buf[6:9], stick)
+	case joycon.ProController:
+		copy(buf[6:9], stick)
+		copy(buf[9:12], packStickValues(s.RightHorizontal, s.RightVertical))
+	default:
+		copy(buf[9:12], stick)
+	}
+	buf[12] = 0x80 // Vibrator input report
+
+	if id == report.StandardFullMode {
+		for i := 0; i < 3; i++ {
+			offset := 13 + (12 * i)
+			for axis := 0; axis < 3; axis++ {
+				binary.LittleEndian.PutUint16(buf[offset+axis*2:], uint16(s.Accel[axis]))
+				binary.LittleEndian.PutUint16(buf[offset+6+axis*2:], uint16(s.Gyro[axis]))
+			}
+		}
+	}
+	return buf
+}
+
+func (c *Controller) String() string {
+	return fmt.Sprintf("%s (%s)", c.Name, c.Serial)
+}
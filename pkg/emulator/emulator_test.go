@@ -0,0 +1,108 @@
+package emulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"joyku/internal/spi"
+	"joyku/internal/subcommand"
+	"joyku/internal/transport"
+	"joyku/pkg/joycon"
+)
+
+func TestFlashIsSharedBetweenTransports(t *testing.T) {
+	c := NewLeft("00:00:00:00:00:01")
+	b := NewBackend(c)
+	defer b.Close()
+
+	// Two connections to the same controller read and write its flash at the same time
+	dispatchers := make([]*subcommand.Dispatcher, 2)
+	for i := range dispatchers {
+		host, err := b.Open(joycon.DeviceInfo{ProductID: c.ProductID, Serial: c.Serial, Name: c.Name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dispatchers[i] = subcommand.NewDispatcher(host)
+		defer dispatchers[i].Close()
+	}
+
+	var wg sync.WaitGroup
+	for i, dp := range dispatchers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			offset := i * 0x10
+			address := spi.UserCalibrationStart + uint32(offset)
+			for n := 0; n < 20; n++ {
+				contents := bytes.Repeat([]byte{byte(n)}, 8)
+				if err := spi.Write(context.Background(), dp, spi.SPIFlashWriteCommand{Address: address, Contents: contents}); err != nil {
+					t.Error(err)
+					return
+				}
+				// Both sections are read, while the other connection may be writing to its section
+				data, err := spi.Read(context.Background(), dp, spi.SPIFlashReadCommand{Address: spi.UserCalibrationStart, Size: 0x18})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got := data[offset : offset+8]; !bytes.Equal(got, contents) {
+					t.Errorf("read % X after writing % X", got, contents)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFlashAccessOutOfBounds(t *testing.T) {
+	c := NewLeft("00:00:00:00:00:01")
+	host, device := transport.NewMemoryPair()
+	go c.Serve(device)
+	dp := subcommand.NewDispatcher(host)
+	defer dp.Close()
+
+	// address+size wraps around to a small number if it's added as a uint32
+	data := binary.LittleEndian.AppendUint32(nil, 0xFFFFFFF8)
+	for _, id := range []subcommand.SubcommandID{subcommand.SPIFlashRead, subcommand.SPIFlashWrite} {
+		_, err := dp.Request(context.Background(), id, append(data, 0x10))
+		var nack subcommand.NackError
+		if !errors.As(err, &nack) {
+			t.Errorf("got %v for subcommand 0x%02X, want a NackError", err, id.Byte())
+		}
+	}
+}
+
+func TestBackendForgetsClosedConnections(t *testing.T) {
+	c := NewLeft("00:00:00:00:00:01")
+	b := NewBackend(c)
+	defer b.Close()
+
+	for i := 0; i < 3; i++ {
+		host, err := b.Open(joycon.DeviceInfo{ProductID: c.ProductID, Serial: c.Serial, Name: c.Name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		host.Close()
+	}
+
+	timeout := time.After(time.Second)
+	for {
+		b.lock.Lock()
+		n := len(b.open[c])
+		b.lock.Unlock()
+		if n == 0 {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("%d closed connections are still kept", n)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
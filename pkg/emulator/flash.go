@@ -0,0 +1,56 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"image/color"
+	"joyku/internal/spi"
+)
+
+const (
+	FlashSize = spi.FlashSize // Size of the SPI flash memory of a Joycon (512KB)
+
+	defaultStickCenter   uint16 = 0x800 // Center value of each stick axis
+	defaultStickRange    uint16 = 0x600 // Distance from the center to the min and max of each stick axis
+	defaultStickDeadzone uint16 = 0x0AE // Deadzone stored in the stick device parameters
+)
+
+// NewFlash returns a virtual SPI flash image with factory calibration and the given colors. Just like
+// a Joycon that has never been calibrated by a user, every user calibration section is left erased (0xFF).
+func NewFlash(body color.RGBA, buttons color.RGBA) []byte {
+	flash := make([]byte, FlashSize)
+	for i := range flash {
+		flash[i] = 0xFF
+	}
+
+	copy(flash[spi.BodyColorSection:], []byte{body.R, body.G, body.B})
+	copy(flash[spi.ButtonColorSection:], []byte{buttons.R, buttons.G, buttons.B})
+
+	// 6-Axis factory calibration: accelerometer origin and sensitivity followed by gyroscope origin and sensitivity
+	imu := []int16{0, 0, 0, 16384, 16384, 16384, 0, 0, 0, 13371, 13371, 13371}
+	for i, v := range imu {
+		binary.LittleEndian.PutUint16(flash[spi.AxisMotionSensorFactoryCalibrationSection+uint32(i*2):], uint16(v))
+	}
+
+	// The left and right sticks store the same calibration values in a different order
+	center := packStickValues(defaultStickCenter, defaultStickCenter)
+	rng := packStickValues(defaultStickRange, defaultStickRange)
+	left := append(append(append([]byte{}, rng...), center...), rng...)
+	right := append(append(append([]byte{}, center...), rng...), rng...)
+	copy(flash[spi.LeftStickFactoryCalibrationSection:], left)
+	copy(flash[spi.RightStickFactoryCalibrationSection:], right)
+
+	params := make([]byte, 18)
+	binary.LittleEndian.PutUint16(params[3:], defaultStickDeadzone)
+	copy(flash[spi.LeftStickDeviceParameters:], params)
+	copy(flash[spi.RightStickDeviceParameters:], params)
+	return flash
+}
+
+// packStickValues packs two 12-bit values into 3 bytes in the same way stick data is packed in input reports
+func packStickValues(x uint16, y uint16) []byte {
+	return []byte{
+		byte(x & 0xFF),
+		byte((x>>8)&0x0F) | byte((y&0x0F)<<4),
+		byte(y >> 4),
+	}
+}
@@ -0,0 +1,131 @@
+package emulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"joyku/pkg/joycon"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Step is a single step of a Script. The state is held for the duration of the step.
+type Step struct {
+	Duration time.Duration
+	State    State
+}
+
+// Script is an InputSource that plays a list of steps in order, starting over once the last step has finished
+type Script struct {
+	Steps []Step
+}
+
+// State returns the state of the step that is active after the given amount of time has elapsed
+func (s *Script) State(elapsed time.Duration) State {
+	var total time.Duration
+	for _, step := range s.Steps {
+		total += step.Duration
+	}
+	if total <= 0 {
+		return NeutralState()
+	}
+
+	elapsed %= total
+	for _, step := range s.Steps {
+		if elapsed < step.Duration {
+			return step.State
+		}
+		elapsed -= step.Duration
+	}
+	return NeutralState()
+}
+
+// LoadScript parses the script file at the given path. See ParseScript for the file format.
+func LoadScript(path string) (*Script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseScript(f)
+}
+
+// ParseScript parses a script where each line is a step. A step starts with its duration and is optionally followed by
+// the buttons being pressed and the stick position (rstick sets the right stick of a Pro Controller). Blank lines and
+// lines starting with # are ignored.
+//
+//	# Hold the stick up for half a second, then press A
+//	500ms stick=2048,3500
+//	200ms rstick=600,2048
+//	100ms A
+//	400ms
+//	100ms ZL+ZR
+func ParseScript(r io.Reader) (*Script, error) {
+	script := &Script{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		duration, err := time.ParseDuration(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid duration: %w", line, err)
+		}
+
+		step := Step{Duration: duration, State: NeutralState()}
+		for _, field := range fields[1:] {
+			if stick, ok := strings.CutPrefix(field, "stick="); ok {
+				h, v, err := parseStickPosition(stick)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				step.State.StickHorizontal = h
+				step.State.StickVertical = v
+				continue
+			}
+			if stick, ok := strings.CutPrefix(field, "rstick="); ok {
+				h, v, err := parseStickPosition(stick)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				step.State.RightHorizontal = h
+				step.State.RightVertical = v
+				continue
+			}
+
+			buttons, err := joycon.ParseButton(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			step.State.Buttons |= buttons
+		}
+		script.Steps = append(script.Steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+func parseStickPosition(s string) (uint16, uint16, error) {
+	h, v, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid stick position %q, expected horizontal,vertical", s)
+	}
+	horizontal, err := strconv.ParseUint(h, 10, 12)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid horizontal stick value %q: %w", h, err)
+	}
+	vertical, err := strconv.ParseUint(v, 10, 12)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid vertical stick value %q: %w", v, err)
+	}
+	return uint16(horizontal), uint16(vertical), nil
+}
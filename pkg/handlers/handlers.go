@@ -2,25 +2,36 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"joyku/internal/bluez"
 	"joyku/pkg/components"
 	"joyku/pkg/joycon"
+	"joyku/pkg/roku"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
 )
 
-func Home(w http.ResponseWriter, r *http.Request) {
-	pair := joycon.FindFirstPair()
-	components.Dashboard(pair).Render(r.Context(), w)
+// How long connecting to a Joycon may take before the request fails
+const connectTimeout = 10 * time.Second
+
+// Home renders the dashboard. The roku device may be nil if one could not be found.
+func Home(reg *joycon.Registry, device *roku.RokuDevice) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pair := reg.FindFirstPairContext(r.Context())
+		components.Dashboard(pair, device).Render(r.Context(), w)
+	}
 }
 
 // Device Searching
 // Manual -> Search all HID devices and return the first left and right joycons
 // Bluetooth -> Start a scan which will search for Joycons and connect them to the system
 
-func Search(adpt *bluez.Adapter) http.HandlerFunc {
+// Search searches for Joycons and renders the first pair found. The adapter may be nil if bluetooth is unavailable, in
+// which case only manual searches are supported.
+func Search(reg *joycon.Registry, adpt *bluez.Adapter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		bfv := r.PostFormValue("bluetooth")
 		if bfv == "" {
@@ -38,6 +49,10 @@ func Search(adpt *bluez.Adapter) http.HandlerFunc {
 
 		var pair joycon.Pair
 		if useBluetooth {
+			if adpt == nil {
+				http.Error(w, "Bluetooth is not available", http.StatusServiceUnavailable)
+				return
+			}
 			if err = adpt.SetDiscoveryFilter(bluez.JoyconFilter); err != nil {
 				log.Printf("Could not set discovery filter, err: %s\n", err)
 				http.Error(w, "Failed to start bluetooth discovery", http.StatusInternalServerError)
@@ -47,6 +62,18 @@ func Search(adpt *bluez.Adapter) http.HandlerFunc {
 			ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
 			defer cancel()
 
+			// Pulse the HOME light of connected Joycons while scanning
+			for _, jc := range reg.Connected() {
+				if jc.IsLeft() {
+					continue
+				}
+				if err := jc.SetHomeLight(joycon.HomeLightPulse); err != nil {
+					log.Printf("Could not set home light on %s: %s\n", jc.Name, err)
+					continue
+				}
+				defer jc.SetHomeLight(joycon.HomeLightOff)
+			}
+
 			deviceC, err := adpt.Scan(ctx)
 			if err != nil {
 				log.Printf("Could not start bluetooth scan, err: %s\n", err)
@@ -55,7 +82,7 @@ func Search(adpt *bluez.Adapter) http.HandlerFunc {
 			}
 
 			for device := range deviceC {
-				if pair.Left != nil && pair.Right != nil {
+				if pair.Complete() {
 					break
 				}
 
@@ -64,7 +91,7 @@ func Search(adpt *bluez.Adapter) http.HandlerFunc {
 					continue
 				}
 
-				jc := joycon.Find(device.Address)
+				jc := reg.FindContext(ctx, device.Address)
 				if jc == nil {
 					log.Printf("Could not find Joycon with address: %s, skipping\n", device.Address)
 					continue
@@ -74,16 +101,20 @@ func Search(adpt *bluez.Adapter) http.HandlerFunc {
 					pair.Left = jc
 				} else if jc.IsRight() && pair.Right == nil {
 					pair.Right = jc
+				} else if jc.IsPro() && pair.Pro == nil {
+					pair.Pro = jc
 				}
 			}
 		} else {
-			pair = joycon.FindFirstPair()
+			pair = reg.FindFirstPairContext(r.Context())
 		}
 		components.RenderJoycons(pair).Render(r.Context(), w)
 	}
 }
 
-func Connect(mux *joycon.FOFIMultiplexer) http.HandlerFunc {
+// Connect connects to a Joycon and adds it to the multiplexer. The roku device may be nil if one could not be found,
+// otherwise the Joycon's player lights show which roku it controls.
+func Connect(reg *joycon.Registry, mux *joycon.FOFIMultiplexer, device *roku.RokuDevice) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		serial := r.PostFormValue("joycon")
 		if serial == "" {
@@ -92,25 +123,51 @@ func Connect(mux *joycon.FOFIMultiplexer) http.HandlerFunc {
 			return
 		}
 
-		jc := joycon.Find(serial)
+		jc := reg.FindContext(r.Context(), serial)
 		if jc == nil {
 			log.Printf("Could not find Joycon with serial: %s\n", serial)
 			http.Error(w, "Could not find Joycon with provided serial number", http.StatusNotFound)
 			return
 		}
 
-		if err := jc.Connect(); err != nil {
+		// Joycons are connected automatically once they're attached, so this one may already be streaming
+		if s := jc.State(); s == joycon.StateConnected || s == joycon.StateReconnecting {
+			components.RenderJoycon(jc).Render(r.Context(), w)
+			return
+		}
+
+		// Stop connecting if the browser gives up on the request
+		ctx, cancel := context.WithTimeout(r.Context(), connectTimeout)
+		defer cancel()
+		if err := jc.ConnectContext(ctx); err != nil {
 			log.Printf("Failed to connect to %s: %s\n", serial, err)
-			http.Error(w, "Failed to connect to Joycon", http.StatusInternalServerError)
+			if r.Context().Err() != nil {
+				return
+			}
+			status := http.StatusInternalServerError
+			if errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusGatewayTimeout
+			}
+			message := "Failed to connect to Joycon"
+			var ce joycon.ConnectError
+			if errors.As(err, &ce) {
+				message = fmt.Sprintf("Failed to connect to Joycon, could not %s", ce.Step)
+			}
+			http.Error(w, message, status)
 			return
 		}
+		if device != nil {
+			if err := jc.SetPlayerLights(joycon.PlayerLightsFor(device.PlayerNumber())); err != nil {
+				log.Printf("Could not set player lights on %s: %s\n", serial, err)
+			}
+		}
 		// Add Joycon to multiplexer for event streaming
 		mux.Join(jc)
 		components.RenderJoycon(jc).Render(r.Context(), w)
 	}
 }
 
-func Disconnect(adpt *bluez.Adapter) http.HandlerFunc {
+func Disconnect(reg *joycon.Registry, adpt *bluez.Adapter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		serial := r.PostFormValue("joycon")
 		if serial == "" {
@@ -119,7 +176,7 @@ func Disconnect(adpt *bluez.Adapter) http.HandlerFunc {
 			return
 		}
 
-		jc := joycon.Find(serial)
+		jc := reg.FindContext(r.Context(), serial)
 		if jc == nil {
 			log.Printf("Could not find Joycon with serial: %s\n", serial)
 			http.Error(w, "Could not find Joycon with provided serial number", http.StatusNotFound)
@@ -132,12 +189,14 @@ func Disconnect(adpt *bluez.Adapter) http.HandlerFunc {
 			return
 		}
 
-		if err := adpt.RemoveDeviceWithSerial(jc.Serial); err != nil {
-			log.Printf("Could not remove Joycon from bluetooth adapter: %s\n", err)
+		if adpt != nil {
+			if err := adpt.RemoveDeviceWithSerial(jc.Serial); err != nil {
+				log.Printf("Could not remove Joycon from bluetooth adapter: %s\n", err)
+			}
 		}
 
 		// TODO: add a disconnect joycon component and write that to response instead?
-		pair := joycon.FindFirstPair()
+		pair := reg.FindFirstPairContext(r.Context())
 		components.RenderJoycons(pair).Render(r.Context(), w)
 	}
 }
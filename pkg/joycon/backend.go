@@ -0,0 +1,26 @@
+package joycon
+
+// DeviceInfo describes a Joycon that was discovered by a Backend
+type DeviceInfo struct {
+	ProductID uint16 // Product id of the device (e.g. LeftJoyconProductID)
+	Serial    string // Serial number of the device
+	Name      string // Name (product str) of the device
+}
+
+// Backend is used to discover Joycons attached to the system and open connections to them. By default, Joycons are
+// discovered by enumerating HID devices, but a different backend (e.g. an emulator) can be used by calling SetBackend
+// or by creating a Registry with NewRegistry.
+type Backend interface {
+	// Enumerate calls fn for every Joycon device that is currently attached
+	Enumerate(fn func(info DeviceInfo) error) error
+	// Open opens a connection to the Joycon with the given info
+	Open(info DeviceInfo) (Transport, error)
+	// Close releases any resources held by the backend
+	Close() error
+}
+
+// SetBackend replaces the backend DefaultRegistry uses to discover and connect to Joycons. This should be called
+// before any Joycons have been found.
+func SetBackend(b Backend) {
+	DefaultRegistry.SetBackend(b)
+}
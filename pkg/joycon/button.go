@@ -0,0 +1,168 @@
+package joycon
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Button identifies a single Joycon button. The value of each button is its bit in the three button bytes of an
+// input report (right buttons, shared buttons, left buttons), so multiple buttons can be combined into a single value.
+type Button uint32
+
+const (
+	ButtonY            Button = 1 << iota // Right Joycon Y button
+	ButtonX                               // Right Joycon X button
+	ButtonB                               // Right Joycon B button
+	ButtonA                               // Right Joycon A button
+	ButtonRightSR                         // Right Joycon SR button
+	ButtonRightSL                         // Right Joycon SL button
+	ButtonR                               // Right Joycon R button
+	ButtonZR                              // Right Joycon ZR button
+	ButtonMinus                           // Left Joycon minus button
+	ButtonPlus                            // Right Joycon plus button
+	ButtonRightStick                      // Right Joycon stick press
+	ButtonLeftStick                       // Left Joycon stick press
+	ButtonHome                            // Right Joycon home button
+	ButtonCapture                         // Left Joycon capture button
+	_                                     // Unused
+	ButtonChargingGrip                    // Charging grip button
+	ButtonDown                            // Left Joycon down d-pad button
+	ButtonUp                              // Left Joycon up d-pad button
+	ButtonRight                           // Left Joycon right d-pad button
+	ButtonLeft                            // Left Joycon left d-pad button
+	ButtonLeftSR                          // Left Joycon SR button
+	ButtonLeftSL                          // Left Joycon SL button
+	ButtonL                               // Left Joycon L button
+	ButtonZL                              // Left Joycon ZL button
+)
+
+// NoButton represents no buttons being pressed
+const NoButton Button = 0
+
+// Buttons contains every button in the order they appear in an input report
+var Buttons = []Button{
+	ButtonY, ButtonX, ButtonB, ButtonA, ButtonRightSR, ButtonRightSL, ButtonR, ButtonZR,
+	ButtonMinus, ButtonPlus, ButtonRightStick, ButtonLeftStick, ButtonHome, ButtonCapture, ButtonChargingGrip,
+	ButtonDown, ButtonUp, ButtonRight, ButtonLeft, ButtonLeftSR, ButtonLeftSL, ButtonL, ButtonZL,
+}
+
+var buttonNames = map[Button]string{
+	ButtonY:            "Y",
+	ButtonX:            "X",
+	ButtonB:            "B",
+	ButtonA:            "A",
+	ButtonRightSR:      "RightSR",
+	ButtonRightSL:      "RightSL",
+	ButtonR:            "R",
+	ButtonZR:           "ZR",
+	ButtonMinus:        "Minus",
+	ButtonPlus:         "Plus",
+	ButtonRightStick:   "RightStick",
+	ButtonLeftStick:    "LeftStick",
+	ButtonHome:         "Home",
+	ButtonCapture:      "Capture",
+	ButtonChargingGrip: "ChargingGrip",
+	ButtonDown:         "Down",
+	ButtonUp:           "Up",
+	ButtonRight:        "Right",
+	ButtonLeft:         "Left",
+	ButtonLeftSR:       "LeftSR",
+	ButtonLeftSL:       "LeftSL",
+	ButtonL:            "L",
+	ButtonZL:           "ZL",
+}
+
+// String returns the name of the button. Combined buttons are joined with "+" (e.g. "ZL+ZR").
+func (b Button) String() string {
+	if b == NoButton {
+		return "None"
+	}
+	if name, ok := buttonNames[b]; ok {
+		return name
+	}
+
+	names := []string{}
+	for _, button := range Buttons {
+		if b&button != 0 {
+			names = append(names, buttonNames[button])
+		}
+	}
+	if len(names) == 0 {
+		return "Invalid"
+	}
+	return strings.Join(names, "+")
+}
+
+// Has returns true if every button in other is also in b
+func (b Button) Has(other Button) bool {
+	return b&other == other
+}
+
+// ParseButton parses a button name as returned by Button.String. Names are case insensitive and multiple buttons can be
+// combined with "+" (e.g. "zl+zr").
+func ParseButton(s string) (Button, error) {
+	var b Button
+	for _, part := range strings.Split(s, "+") {
+		part = strings.TrimSpace(part)
+		found := false
+		for button, name := range buttonNames {
+			if strings.EqualFold(part, name) {
+				b |= button
+				found = true
+				break
+			}
+		}
+		if !found {
+			return NoButton, fmt.Errorf("unknown button: %q", part)
+		}
+	}
+	return b, nil
+}
+
+// Buttons that are found on each Joycon model
+const (
+	leftJoyconButtons = ButtonMinus | ButtonLeftStick | ButtonCapture | ButtonChargingGrip | ButtonDown | ButtonUp |
+		ButtonRight | ButtonLeft | ButtonLeftSR | ButtonLeftSL | ButtonL | ButtonZL
+	rightJoyconButtons = ButtonY | ButtonX | ButtonB | ButtonA | ButtonRightSR | ButtonRightSL | ButtonR | ButtonZR |
+		ButtonPlus | ButtonRightStick | ButtonHome | ButtonChargingGrip
+	// Pro Controllers have every button except the SL and SR buttons found on the rail of each Joycon
+	proControllerButtons = (leftJoyconButtons | rightJoyconButtons) &^
+		(ButtonLeftSR | ButtonLeftSL | ButtonRightSR | ButtonRightSL | ButtonChargingGrip)
+)
+
+// buttonsFromReport returns the buttons that are pressed in the given input report
+func buttonsFromReport(report []byte) Button {
+	return Button(report[3]) | Button(report[4])<<8 | Button(report[5])<<16
+}
+
+// Pressed returns true if every button in b is being pressed
+func (js *JoyconStatus) Pressed(b Button) bool {
+	return b != NoButton && js.Buttons.Has(b)
+}
+
+// setButtonFields sets the individual button fields of js from its Buttons
+func (js *JoyconStatus) setButtonFields() {
+	js.ButtonY = js.Pressed(ButtonY)
+	js.ButtonX = js.Pressed(ButtonX)
+	js.ButtonB = js.Pressed(ButtonB)
+	js.ButtonA = js.Pressed(ButtonA)
+	js.RightButtonSR = js.Pressed(ButtonRightSR)
+	js.RightButtonSL = js.Pressed(ButtonRightSL)
+	js.ButtonR = js.Pressed(ButtonR)
+	js.ButtonZR = js.Pressed(ButtonZR)
+	js.ButtonMinus = js.Pressed(ButtonMinus)
+	js.ButtonPlus = js.Pressed(ButtonPlus)
+	js.RightStickPress = js.Pressed(ButtonRightStick)
+	js.LeftStickPress = js.Pressed(ButtonLeftStick)
+	js.ButtonHome = js.Pressed(ButtonHome)
+	js.ButtonCapture = js.Pressed(ButtonCapture)
+	js.ButtonChargingGrip = js.Pressed(ButtonChargingGrip)
+	js.DPadDown = js.Pressed(ButtonDown)
+	js.DPadUp = js.Pressed(ButtonUp)
+	js.DPadRight = js.Pressed(ButtonRight)
+	js.DPadLeft = js.Pressed(ButtonLeft)
+	js.LeftButtonSR = js.Pressed(ButtonLeftSR)
+	js.LeftButtonSL = js.Pressed(ButtonLeftSL)
+	js.ButtonL = js.Pressed(ButtonL)
+	js.ButtonZL = js.Pressed(ButtonZL)
+}
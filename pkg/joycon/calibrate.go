@@ -0,0 +1,291 @@
+package joycon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"joyku/internal/spi"
+	"math"
+)
+
+const (
+	minCalibrationSamples = 10   // Fewest samples each step of a calibration needs
+	maxCenterNoise        = 0x40 // Furthest a centered stick sample can be from the average center
+	stickEdgeMargin       = 0.05 // Portion of the measured range that is cut off so the stick can reach its full range
+	stickEdgeSectors      = 8    // Number of sectors the edge of a stick must be rotated through
+	maxGyroNoiseDPS       = 5.0  // Largest change in angular velocity while the controller should be still
+	maxFlatTiltG          = 0.2  // Largest acceleration on the X and Y axes while the controller should be lying flat
+	userCalibrationSize   = 0x30 // Size of the user calibration in SPI flash, including the magic of each section
+)
+
+// Sticks returns the sticks this controller has
+func (j *Joycon) Sticks() []Stick {
+	if j.IsPro() {
+		return []Stick{MainStick, RightStick}
+	}
+	return []Stick{MainStick}
+}
+
+// StickCalibrator computes a new calibration for a stick from statuses sampled while the stick is left centered and
+// while it's rotated around its edge. The Joycon must be held vertically while sampling.
+type StickCalibrator struct {
+	Stick  Stick // Stick that is being calibrated
+	center []StickData
+	edge   []StickData
+}
+
+// AddCenter adds a status sampled while the stick was left centered
+func (c *StickCalibrator) AddCenter(js *JoyconStatus) {
+	c.center = append(c.center, c.Stick.Data(js))
+}
+
+// AddEdge adds a status sampled while the stick was rotated around its edge
+func (c *StickCalibrator) AddEdge(js *JoyconStatus) {
+	c.edge = append(c.edge, c.Stick.Data(js))
+}
+
+// Calibration returns the calibration computed from the sampled statuses with the given deadzone. An error is returned
+// if the stick moved while it should have been centered, or if it wasn't rotated all the way around its edge.
+func (c *StickCalibrator) Calibration(deadzone byte) (StickCalibration, error) {
+	if len(c.center) < minCalibrationSamples {
+		return StickCalibration{}, errors.New("not enough samples of the centered stick")
+	}
+	if len(c.edge) < minCalibrationSamples {
+		return StickCalibration{}, errors.New("not enough samples of the stick's edge")
+	}
+
+	var cx, cy float64
+	for _, sd := range c.center {
+		cx += float64(sd.Horizontal)
+		cy += float64(sd.Vertical)
+	}
+	cx /= float64(len(c.center))
+	cy /= float64(len(c.center))
+	for _, sd := range c.center {
+		if math.Abs(float64(sd.Horizontal)-cx) > maxCenterNoise || math.Abs(float64(sd.Vertical)-cy) > maxCenterNoise {
+			return StickCalibration{}, errors.New("the stick moved while it should have been centered")
+		}
+	}
+
+	minX, maxX, minY, maxY := cx, cx, cy, cy
+	covered := [stickEdgeSectors]bool{}
+	for _, sd := range c.edge {
+		x, y := float64(sd.Horizontal), float64(sd.Vertical)
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+
+		// Only samples that are well away from the center count towards rotating around the edge
+		if math.Hypot(x-cx, y-cy) < minStickRange {
+			continue
+		}
+		angle := radiansToDegrees(math.Atan2(y-cy, x-cx))
+		if angle < 0 {
+			angle += 360
+		}
+		covered[int(angle/(360/stickEdgeSectors))%stickEdgeSectors] = true
+	}
+	for _, ok := range covered {
+		if !ok {
+			return StickCalibration{}, errors.New("the stick wasn't rotated all the way around its edge")
+		}
+	}
+
+	extent := func(v float64) uint16 {
+		return uint16(v * (1 - stickEdgeMargin))
+	}
+	sc := StickCalibration{
+		XAxisCenter:         uint16(math.Round(cx)),
+		XAxisMinBelowCenter: extent(cx - minX),
+		XAxisMaxAboveCenter: extent(maxX - cx),
+		YAxisCenter:         uint16(math.Round(cy)),
+		YAxisMinBelowCenter: extent(cy - minY),
+		YAxisMaxAboveCenter: extent(maxY - cy),
+		Deadzone:            deadzone,
+	}
+	if err := sc.Validate(); err != nil {
+		return StickCalibration{}, fmt.Errorf("calibration is not plausible: %w", err)
+	}
+	return sc, nil
+}
+
+// IMUCalibrator computes a new calibration for the accelerometer and gyroscope from statuses sampled while the
+// controller is lying still on a flat surface
+type IMUCalibrator struct {
+	samples []IMUSample
+}
+
+// Add adds the IMU samples of a status sampled while the controller was lying flat
+func (c *IMUCalibrator) Add(js *JoyconStatus) {
+	c.samples = append(c.samples, js.IMUSamples[:]...)
+}
+
+// Calibration returns the calibration computed from the sampled statuses. The sensitivity of each axis is kept from the
+// current calibration, only the origins are moved. An error is returned if the controller moved or wasn't lying flat.
+func (c *IMUCalibrator) Calibration(current IMUCalibration) (IMUCalibration, error) {
+	if len(c.samples) < minCalibrationSamples {
+		return IMUCalibration{}, errors.New("not enough IMU samples")
+	}
+
+	var accel, gyro [3]float64
+	minGyro, maxGyro := c.samples[0].RawGyro, c.samples[0].RawGyro
+	for _, s := range c.samples {
+		for axis := 0; axis < 3; axis++ {
+			accel[axis] += float64(s.RawAccel[axis])
+			gyro[axis] += float64(s.RawGyro[axis])
+			minGyro[axis] = min(minGyro[axis], s.RawGyro[axis])
+			maxGyro[axis] = max(maxGyro[axis], s.RawGyro[axis])
+		}
+	}
+	for axis := 0; axis < 3; axis++ {
+		accel[axis] /= float64(len(c.samples))
+		gyro[axis] /= float64(len(c.samples))
+		if float64(int(maxGyro[axis])-int(minGyro[axis]))*current.gyroCoefficient(axis) > maxGyroNoiseDPS {
+			return IMUCalibration{}, errors.New("the controller moved while it should have been still")
+		}
+	}
+
+	// The controller is lying flat when gravity pulls straight along the Z axis
+	g := AxisData{
+		X: (accel[0] - float64(current.AccelOrigin[0])) * current.accelCoefficient(0),
+		Y: (accel[1] - float64(current.AccelOrigin[1])) * current.accelCoefficient(1),
+		Z: (accel[2] - float64(current.AccelOrigin[2])) * current.accelCoefficient(2),
+	}
+	if math.Abs(g.X) > maxFlatTiltG || math.Abs(g.Y) > maxFlatTiltG || math.Abs(g.Z) < 1-maxFlatTiltG {
+		return IMUCalibration{}, errors.New("the controller wasn't lying flat")
+	}
+
+	ic := IMUCalibration{}
+	for axis := 0; axis < 3; axis++ {
+		accelSpan := 1 / current.accelCoefficient(axis) * accelRangeG
+		gyroSpan := 1 / current.gyroCoefficient(axis) * gyroRangeDPS
+
+		// At rest every axis reads zero, except Z which reads 1G up or down depending on which side is facing up
+		rest := 0.0
+		if axis == 2 {
+			rest = math.Copysign(accelSpan/accelRangeG, g.Z)
+		}
+		var err error
+		ic.AccelOrigin[axis], ic.AccelSensitivity[axis], err = imuAxisCalibration(accel[axis]-rest, accelSpan)
+		if err != nil {
+			return IMUCalibration{}, err
+		}
+		ic.GyroOrigin[axis], ic.GyroSensitivity[axis], err = imuAxisCalibration(gyro[axis], gyroSpan)
+		if err != nil {
+			return IMUCalibration{}, err
+		}
+	}
+	return ic, nil
+}
+
+// imuAxisCalibration returns the origin and sensitivity of a single IMU axis, the sensitivity is stored as the
+// origin plus the span between them
+func imuAxisCalibration(origin float64, span float64) (int16, int16, error) {
+	o, s := math.Round(origin), math.Round(origin+span)
+	for _, v := range []float64{o, s} {
+		if v < math.MinInt16 || v > math.MaxInt16 {
+			return 0, 0, errors.New("imu calibration is out of range")
+		}
+	}
+	return int16(o), int16(s), nil
+}
+
+// WriteStickCalibration writes sc to the user calibration of the given stick and starts using it right away. The
+// deadzone is not part of the user calibration, so the deadzone of the current calibration is kept.
+func (j *Joycon) WriteStickCalibration(ctx context.Context, stick Stick, sc StickCalibration) error {
+	sections, err := j.stickSections()
+	if err != nil {
+		return err
+	}
+	if int(stick) >= len(sections) {
+		return fmt.Errorf("%s has no %s", j.Name, stick)
+	}
+	dp, err := j.connectedDispatcher()
+	if err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	current := &j.StickCalibration
+	if stick == RightStick {
+		current = &j.RightStickCalibration
+	}
+	sc.Deadzone = current.Deadzone
+	j.lock.Unlock()
+	if err := sc.Validate(); err != nil {
+		return fmt.Errorf("could not write stick calibration: %w", err)
+	}
+
+	data := append(append([]byte{}, spi.UserCalibrationMagic...), sections[stick].marshal(sc)...)
+	err = spi.Write(ctx, dp, spi.SPIFlashWriteCommand{Address: sections[stick].magic, Contents: data})
+	if err != nil {
+		return fmt.Errorf("could not write stick calibration: %w", err)
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	*current = sc
+	return nil
+}
+
+// WriteIMUCalibration writes ic to the user calibration of the accelerometer and gyroscope and starts using it right away
+func (j *Joycon) WriteIMUCalibration(ctx context.Context, ic IMUCalibration) error {
+	if err := ic.Validate(); err != nil {
+		return fmt.Errorf("could not write imu calibration: %w", err)
+	}
+	dp, err := j.connectedDispatcher()
+	if err != nil {
+		return err
+	}
+
+	data := append(append([]byte{}, spi.UserCalibrationMagic...), marshalIMUCalibration(ic)...)
+	err = spi.Write(ctx, dp, spi.SPIFlashWriteCommand{Address: spi.AxisMotionSensorUserCalibrationMagic, Contents: data})
+	if err != nil {
+		return fmt.Errorf("could not write imu calibration: %w", err)
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.IMUCalibration = ic
+	return nil
+}
+
+// BackupUserCalibration returns the entire user calibration from SPI flash, so it can be put back later with
+// RestoreUserCalibration
+func (j *Joycon) BackupUserCalibration(ctx context.Context) ([]byte, error) {
+	dp, err := j.connectedDispatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	backup, err := spi.ReadRange(ctx, dp, spi.UserCalibrationStart, userCalibrationSize)
+	if err != nil {
+		return nil, fmt.Errorf("could not back up user calibration: %w", err)
+	}
+	return backup, nil
+}
+
+// RestoreUserCalibration writes a backup made with BackupUserCalibration to SPI flash and starts using it right away
+func (j *Joycon) RestoreUserCalibration(ctx context.Context, backup []byte) error {
+	if len(backup) != userCalibrationSize {
+		return fmt.Errorf("user calibration backup must be %d bytes, got %d", userCalibrationSize, len(backup))
+	}
+	dp, err := j.connectedDispatcher()
+	if err != nil {
+		return err
+	}
+
+	for written := 0; written < len(backup); {
+		size := min(int(spi.MaxFlashWriteInBytes), len(backup)-written)
+		sfw := spi.SPIFlashWriteCommand{Address: spi.UserCalibrationStart + uint32(written), Contents: backup[written : written+size]}
+		if err := spi.Write(ctx, dp, sfw); err != nil {
+			return fmt.Errorf("could not restore user calibration: %w", err)
+		}
+		written += size
+	}
+
+	// Read the calibration the same way as when connecting, so restoring an erased section goes back to the factory one
+	if err := readStickCalibrationFromSPIFlash(ctx, j); err != nil {
+		return err
+	}
+	return readAxisCalibration(ctx, j)
+}
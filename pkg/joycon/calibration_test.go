@@ -0,0 +1,79 @@
+package joycon_test
+
+import (
+	"testing"
+
+	"joyku/internal/spi"
+	"joyku/pkg/emulator"
+	"joyku/pkg/joycon"
+)
+
+func TestStickCalibrationFallback(t *testing.T) {
+	user := []byte{0xBA, 0xF5, 0x62, 0x6F, 0xC8, 0x77, 0xED, 0x95, 0x5B}
+	corrupt := []byte{0xBA, 0xF5, 0x62, 0x50, 0x00, 0x05, 0xED, 0x95, 0x5B}
+	factory := joycon.StickCalibration{
+		XAxisCenter:         0x800,
+		XAxisMinBelowCenter: 0x600,
+		XAxisMaxAboveCenter: 0x600,
+		YAxisCenter:         0x800,
+		YAxisMinBelowCenter: 0x600,
+		YAxisMaxAboveCenter: 0x600,
+		Deadzone:            0xAE,
+	}
+
+	tests := []struct {
+		name    string
+		user    []byte
+		noMagic bool // The user calibration is left without its magic, as if it was erased
+		factory []byte
+		want    joycon.StickCalibration
+	}{
+		{
+			name: "user calibration",
+			user: user,
+			want: joycon.StickCalibration{
+				XAxisCenter:         0x86F,
+				XAxisMinBelowCenter: 0x5ED,
+				XAxisMaxAboveCenter: 0x5BA,
+				YAxisCenter:         0x77C,
+				YAxisMinBelowCenter: 0x5B9,
+				YAxisMaxAboveCenter: 0x62F,
+				Deadzone:            0xAE,
+			},
+		},
+		{name: "no user calibration", want: factory},
+		{name: "stale user calibration without magic", user: user, noMagic: true, want: factory},
+		{name: "corrupt user calibration", user: corrupt, want: factory},
+		{name: "corrupt user and factory calibration", user: corrupt, factory: corrupt, want: joycon.DefaultStickCalibration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := emulator.NewLeft("00:00:00:00:00:01")
+			if tt.user != nil {
+				copy(c.Flash[spi.LeftStickUserCalibrationSection:], tt.user)
+				if !tt.noMagic {
+					copy(c.Flash[spi.LeftStickUserCalibrationMagic:], spi.UserCalibrationMagic)
+				}
+			}
+			if tt.factory != nil {
+				copy(c.Flash[spi.LeftStickFactoryCalibrationSection:], tt.factory)
+			}
+
+			info := joycon.DeviceInfo{ProductID: c.ProductID, Serial: c.Serial, Name: c.Name}
+			transport, err := emulator.NewBackend(c).Open(info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			jc := joycon.New(info.ProductID, info.Serial, info.Name)
+			if err := jc.ConnectTransport(transport); err != nil {
+				t.Fatal(err)
+			}
+			defer jc.Disconnect()
+
+			if jc.StickCalibration != tt.want {
+				t.Errorf("got %+v, want %+v", jc.StickCalibration, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package joycon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// CombinedProductID is the product id set in the statuses of a CombinedController, so they can be told apart from the
+// statuses of a single Joycon
+const CombinedProductID uint16 = 0x2008
+
+// A half that hasn't reported for this long is treated as dropped out, Joycons in full mode report every 15ms
+const combinedStaleAfter = 250 * time.Millisecond
+
+// Controller is a source of Joycon statuses, either a single Joycon or a CombinedController
+type Controller interface {
+	Status() <-chan *JoyconStatus
+}
+
+// combinedUpdate is a status (or nil once its stream closed) received from one half of a CombinedController
+type combinedUpdate struct {
+	joycon *Joycon
+	status *JoyconStatus
+}
+
+// CombinedController merges the statuses of a left and right Joycon into a single controller, like holding both
+// Joycons in a grip. Every status has the buttons of both halves, the left stick in JoystickData and the right stick in
+// RightJoystickData. If a half drops out its buttons are released and its stick is centered until a Joycon is attached
+// in its place again.
+type CombinedController struct {
+	Serial string // Serial used in the statuses of this controller, made from the serials of the original halves
+
+	left    *Joycon
+	right   *Joycon
+	stop    map[*Joycon]chan struct{} // Stops reading from a half once it's replaced
+	updates chan combinedUpdate
+	statusC chan *JoyconStatus
+	closeC  chan struct{}
+	once    sync.Once
+	lock    sync.Mutex
+}
+
+// NewCombinedController combines the left and right Joycon of the given pair. Both Joycons should be connected, the
+// combined controller reads their statuses so they shouldn't be read from anywhere else.
+func NewCombinedController(pair Pair) (*CombinedController, error) {
+	if pair.Left == nil || pair.Right == nil || !pair.Left.IsLeft() || !pair.Right.IsRight() {
+		return nil, errors.New("a combined controller needs both a left and right joycon")
+	}
+
+	c := &CombinedController{
+		Serial:  pair.Left.Serial + "+" + pair.Right.Serial,
+		stop:    make(map[*Joycon]chan struct{}),
+		updates: make(chan combinedUpdate),
+		statusC: make(chan *JoyconStatus),
+		closeC:  make(chan struct{}),
+	}
+	if err := c.Attach(pair.Left); err != nil {
+		return nil, err
+	}
+	if err := c.Attach(pair.Right); err != nil {
+		return nil, err
+	}
+	go c.run()
+	return c, nil
+}
+
+// Left returns the Joycon currently used as the left half
+func (c *CombinedController) Left() *Joycon {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.left
+}
+
+// Right returns the Joycon currently used as the right half
+func (c *CombinedController) Right() *Joycon {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.right
+}
+
+// Attach uses the given Joycon as the left or right half of this controller, e.g. when a half that dropped out was
+// connected again. The Joycon it replaces is no longer read from.
+func (c *CombinedController) Attach(jc *Joycon) error {
+	if !jc.IsLeft() && !jc.IsRight() {
+		return fmt.Errorf("%s (%s) can not be part of a combined controller", jc.Name, jc.ControllerType)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	select {
+	case <-c.closeC:
+		return errors.New("the combined controller has been closed")
+	default:
+	}
+
+	old := c.right
+	if jc.IsLeft() {
+		old = c.left
+		c.left = jc
+	} else {
+		c.right = jc
+	}
+	if old == jc {
+		return nil
+	}
+	if old != nil {
+		close(c.stop[old])
+		delete(c.stop, old)
+	}
+
+	stop := make(chan struct{})
+	c.stop[jc] = stop
+	go c.read(jc, stop)
+	return nil
+}
+
+// Status exposes a readonly channel of the merged statuses of both halves. The channel is closed after Close is called.
+func (c *CombinedController) Status() <-chan *JoyconStatus {
+	return c.statusC
+}
+
+// Rumble plays the given pattern on both halves at the same time
+func (c *CombinedController) Rumble(ctx context.Context, pattern RumblePattern) error {
+	halves := []*Joycon{c.Left(), c.Right()}
+	errs := make([]error, len(halves))
+
+	wg := sync.WaitGroup{}
+	for i, jc := range halves {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = jc.Rumble(ctx, pattern)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Close stops merging statuses and closes the status channel. The halves are not disconnected.
+func (c *CombinedController) Close() {
+	c.once.Do(func() {
+		c.lock.Lock()
+		close(c.closeC)
+		c.lock.Unlock()
+	})
+}
+
+// isHalf returns true if jc is currently one of the halves of this controller
+func (c *CombinedController) isHalf(jc *Joycon) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return jc == c.left || jc == c.right
+}
+
+// current returns the status of the given update if it's from one of the current halves, nil otherwise
+func (c *CombinedController) current(update combinedUpdate) *JoyconStatus {
+	if update.joycon == nil || !c.isHalf(update.joycon) {
+		return nil
+	}
+	return update.status
+}
+
+// read forwards the statuses of a half until it's replaced, its status channel is closed, or the controller is closed
+func (c *CombinedController) read(jc *Joycon, stop <-chan struct{}) {
+	statuses := jc.Status()
+	for {
+		var update combinedUpdate
+		select {
+		case <-c.closeC:
+			return
+		case <-stop:
+			return
+		case js, ok := <-statuses:
+			update = combinedUpdate{joycon: jc, status: js}
+			if !ok {
+				update.status = nil
+			}
+		}
+
+		select {
+		case c.updates <- update:
+		case <-c.closeC:
+			return
+		case <-stop:
+			return
+		}
+		if update.status == nil {
+			return
+		}
+	}
+}
+
+// run merges the latest status of each half whenever either of them reports, until the controller is closed
+func (c *CombinedController) run() {
+	defer close(c.statusC)
+
+	// Latest update from each half, a half that was replaced is ignored until its replacement reports
+	var left, right combinedUpdate
+	for {
+		select {
+		case <-c.closeC:
+			return
+		case update := <-c.updates:
+			if !c.isHalf(update.joycon) {
+				continue
+			}
+			if update.status == nil {
+				log.Printf("%s dropped out of combined controller %s\n", update.joycon.Name, c.Serial)
+			}
+			if update.joycon.IsLeft() {
+				left = update
+			} else {
+				right = update
+			}
+
+			js := mergeStatuses(c.current(left), c.current(right))
+			js.Serial = c.Serial
+			select {
+			case c.statusC <- js:
+			case <-c.closeC:
+				return
+			}
+		}
+	}
+}
+
+// mergeStatuses returns a status with the input of both halves. Either status can be nil if that half is missing, and
+// a status that is much older than the other one is ignored. The motion data of the right Joycon is used if it's
+// available since it's the half usually used for pointing.
+func mergeStatuses(left *JoyconStatus, right *JoyconStatus) *JoyconStatus {
+	latest := time.Time{}
+	for _, s := range []*JoyconStatus{left, right} {
+		if s != nil && s.Timestamp.After(latest) {
+			latest = s.Timestamp
+		}
+	}
+	if left != nil && latest.Sub(left.Timestamp) > combinedStaleAfter {
+		left = nil
+	}
+	if right != nil && latest.Sub(right.Timestamp) > combinedStaleAfter {
+		right = nil
+	}
+
+	js := &JoyconStatus{
+		ProductID:         CombinedProductID,
+		BatteryLevel:      Invalid,
+		JoystickData:      StickData{Direction: NoStickDirection},
+		RightJoystickData: StickData{Direction: NoStickDirection},
+		Timestamp:         latest,
+	}
+	motion := right
+	if motion == nil {
+		motion = left
+	}
+	if motion != nil {
+		js.Acceleration = motion.Acceleration
+		js.GyroscopeData = motion.GyroscopeData
+		js.IMUSamples = motion.IMUSamples
+		js.Orientation = motion.Orientation
+	}
+
+	if left != nil {
+		js.BatteryLevel = left.BatteryLevel
+		js.ConnectionKind = left.ConnectionKind
+		js.LeftButtonSR = left.LeftButtonSR
+		js.LeftButtonSL = left.LeftButtonSL
+		js.ButtonMinus = left.ButtonMinus
+		js.LeftStickPress = left.LeftStickPress
+		js.ButtonCapture = left.ButtonCapture
+		js.DPadDown = left.DPadDown
+		js.DPadUp = left.DPadUp
+		js.DPadRight = left.DPadRight
+		js.DPadLeft = left.DPadLeft
+		js.ButtonL = left.ButtonL
+		js.ButtonZL = left.ButtonZL
+		js.ButtonChargingGrip = left.ButtonChargingGrip
+		js.JoystickData = left.JoystickData
+		js.Buttons |= left.Buttons & leftJoyconButtons
+	}
+	if right != nil {
+		// Report the lowest battery level of the two halves
+		if right.BatteryLevel < js.BatteryLevel {
+			js.BatteryLevel = right.BatteryLevel
+		}
+		if left == nil {
+			js.ConnectionKind = right.ConnectionKind
+		}
+		js.ButtonY = right.ButtonY
+		js.ButtonX = right.ButtonX
+		js.ButtonB = right.ButtonB
+		js.ButtonA = right.ButtonA
+		js.RightButtonSR = right.RightButtonSR
+		js.RightButtonSL = right.RightButtonSL
+		js.ButtonR = right.ButtonR
+		js.ButtonZR = right.ButtonZR
+		js.ButtonPlus = right.ButtonPlus
+		js.RightStickPress = right.RightStickPress
+		js.ButtonHome = right.ButtonHome
+		js.ButtonChargingGrip = js.ButtonChargingGrip || right.ButtonChargingGrip
+		js.RightJoystickData = right.JoystickData
+		js.Buttons |= right.Buttons & rightJoyconButtons
+	}
+	return js
+}
@@ -0,0 +1,136 @@
+package joycon_test
+
+import (
+	"testing"
+	"time"
+
+	"joyku/pkg/emulator"
+	"joyku/pkg/joycon"
+)
+
+// emulatedJoycon returns an emulated controller created with newController that holds the given buttons
+func emulatedJoycon(
+	newController func(string) *emulator.Controller, serial string, buttons joycon.Button,
+) *emulator.Controller {
+	c := newController(serial)
+	state := emulator.NeutralState()
+	state.Buttons = buttons
+	c.SetState(state)
+	return c
+}
+
+// connect finds and connects the Joycon with the given serial, it's disconnected once the test is done
+func connect(t *testing.T, r *joycon.Registry, serial string) *joycon.Joycon {
+	t.Helper()
+	jc := r.Find(serial)
+	if jc == nil {
+		t.Fatalf("%s wasn't found", serial)
+	}
+	if err := jc.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { jc.Disconnect() })
+	return jc
+}
+
+// waitForButtons reads statuses of c until one has exactly the given buttons pressed, and returns it
+func waitForButtons(t *testing.T, c *joycon.CombinedController, want joycon.Button) *joycon.JoyconStatus {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	var last joycon.Button
+	for {
+		select {
+		case js, ok := <-c.Status():
+			if !ok {
+				t.Fatalf("status channel was closed before %s was reported", want)
+			}
+			if js.Buttons == want {
+				return js
+			}
+			last = js.Buttons
+		case <-timeout:
+			t.Fatalf("got %s, want %s", last, want)
+		}
+	}
+}
+
+func TestCombinedControllerHalfDropsOut(t *testing.T) {
+	left := emulatedJoycon(emulator.NewLeft, "aa:bb:cc:dd:ee:01", joycon.ButtonZL)
+	right := emulatedJoycon(emulator.NewRight, "aa:bb:cc:dd:ee:02", joycon.ButtonZR)
+	b := emulator.NewBackend(left, right)
+	r := joycon.NewRegistry(b)
+
+	c, err := joycon.NewCombinedController(joycon.Pair{
+		Left:  connect(t, r, left.Serial),
+		Right: connect(t, r, right.Serial),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	js := waitForButtons(t, c, joycon.ButtonZL|joycon.ButtonZR)
+	if js.Serial != left.Serial+"+"+right.Serial || js.ProductID != joycon.CombinedProductID {
+		t.Errorf("got serial %s and product id %#x, want %s+%s and %#x",
+			js.Serial, js.ProductID, left.Serial, right.Serial, joycon.CombinedProductID)
+	}
+
+	// The left Joycon stops reporting while it reconnects, so its last status goes stale and ZL is released
+	b.Remove(left)
+	start := time.Now()
+	waitForButtons(t, c, joycon.ButtonZR)
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("ZL was released after %s, before the left half went stale", d)
+	}
+
+	b.Add(left)
+	waitForButtons(t, c, joycon.ButtonZL|joycon.ButtonZR)
+}
+
+func TestCombinedControllerAttach(t *testing.T) {
+	left := emulatedJoycon(emulator.NewLeft, "aa:bb:cc:dd:ee:01", joycon.ButtonZL)
+	right := emulatedJoycon(emulator.NewRight, "aa:bb:cc:dd:ee:02", joycon.ButtonZR)
+	other := emulatedJoycon(emulator.NewLeft, "aa:bb:cc:dd:ee:03", joycon.ButtonL)
+	pro := emulator.NewPro("aa:bb:cc:dd:ee:04")
+	r := joycon.NewRegistry(emulator.NewBackend(left, right, other, pro))
+
+	c, err := joycon.NewCombinedController(joycon.Pair{
+		Left:  connect(t, r, left.Serial),
+		Right: connect(t, r, right.Serial),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitForButtons(t, c, joycon.ButtonZL|joycon.ButtonZR)
+
+	// The attached Joycon replaces the left half, the replaced one is no longer read from
+	jc := connect(t, r, other.Serial)
+	if err := c.Attach(jc); err != nil {
+		t.Fatal(err)
+	}
+	if c.Left() != jc {
+		t.Errorf("left half is %s, want %s", c.Left().Serial, jc.Serial)
+	}
+	waitForButtons(t, c, joycon.ButtonL|joycon.ButtonZR)
+
+	if err := c.Attach(r.Find(pro.Serial)); err == nil {
+		t.Error("attached a Pro Controller as a half")
+	}
+
+	c.Close()
+	if err := c.Attach(jc); err == nil {
+		t.Error("attached a Joycon after the combined controller was closed")
+	}
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-c.Status():
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("status channel wasn't closed after closing the combined controller")
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package joycon
+
+import "fmt"
+
+// ConnectStep is a step of the handshake done while connecting to a Joycon, in the order they're done
+type ConnectStep byte
+
+const (
+	StepOpen             ConnectStep = iota // Opening the device
+	StepDeviceInfo                          // Asking the Joycon what type of controller it is
+	StepColors                              // Reading the body and button colors from SPI flash
+	StepStickCalibration                    // Reading the stick calibration from SPI flash
+	StepIMUCalibration                      // Reading the accelerometer and gyroscope calibration from SPI flash
+	StepEnableIMU                           // Enabling the accelerometer and gyroscope
+	StepEnableVibration                     // Enabling the rumble motors
+	StepReportMode                          // Switching to full input reports at 60hz
+)
+
+func (s ConnectStep) String() string {
+	switch s {
+	case StepOpen:
+		return "open device"
+	case StepDeviceInfo:
+		return "read device info"
+	case StepColors:
+		return "read colors"
+	case StepStickCalibration:
+		return "read stick calibration"
+	case StepIMUCalibration:
+		return "read imu calibration"
+	case StepEnableIMU:
+		return "enable imu"
+	case StepEnableVibration:
+		return "enable vibration"
+	case StepReportMode:
+		return "set input report mode"
+	default:
+		return "unknown step"
+	}
+}
+
+// ConnectError is returned when a step of the handshake fails while connecting to a Joycon
+type ConnectError struct {
+	Step ConnectStep // Step that failed
+	Err  error       // Why it failed, this is the context's error if it was canceled or timed out
+}
+
+func (e ConnectError) Error() string {
+	return fmt.Sprintf("could not %s: %s", e.Step, e.Err)
+}
+
+func (e ConnectError) Unwrap() error {
+	return e.Err
+}
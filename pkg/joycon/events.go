@@ -0,0 +1,184 @@
+package joycon
+
+import (
+	"context"
+	"time"
+)
+
+// ButtonEventKind is the kind of transition a button made
+type ButtonEventKind byte
+
+const (
+	EventDown      ButtonEventKind = iota // Button was pressed
+	EventUp                               // Button was released
+	EventLongPress                        // Button has been held for the long press duration
+	EventRepeat                           // Button is still being held, sent every repeat interval after the repeat delay
+	EventDoubleTap                        // Button was pressed again shortly after being tapped, sent after EventDown
+)
+
+func (k ButtonEventKind) String() string {
+	switch k {
+	case EventDown:
+		return "Down"
+	case EventUp:
+		return "Up"
+	case EventLongPress:
+		return "LongPress"
+	case EventRepeat:
+		return "Repeat"
+	case EventDoubleTap:
+		return "DoubleTap"
+	default:
+		return "Unknown"
+	}
+}
+
+// ButtonEvent is a single button transition
+type ButtonEvent struct {
+	Serial string          // Serial number of the Joycon the event is from
+	Button Button          // Button that transitioned
+	Kind   ButtonEventKind // Kind of transition
+	Time   time.Time       // Time of the status that caused the event
+	Held   time.Duration   // How long the button has been held (zero for EventDown and EventDoubleTap)
+}
+
+// ButtonTimings controls when timed button events are sent. A zero duration disables the event.
+type ButtonTimings struct {
+	LongPress      time.Duration // How long a button must be held before EventLongPress is sent
+	RepeatDelay    time.Duration // How long a button must be held before the first EventRepeat is sent
+	RepeatInterval time.Duration // Time between each EventRepeat after the first
+	DoubleTap      time.Duration // Max time between releasing a tap and pressing again for EventDoubleTap to be sent
+}
+
+// DefaultButtonTimings are the timings used for buttons that don't have their own timings
+var DefaultButtonTimings = ButtonTimings{
+	LongPress:      500 * time.Millisecond,
+	RepeatDelay:    500 * time.Millisecond,
+	RepeatInterval: 100 * time.Millisecond,
+	DoubleTap:      300 * time.Millisecond,
+}
+
+// buttonState tracks the transitions of a single button
+type buttonState struct {
+	pressed    bool
+	pressedAt  time.Time
+	releasedAt time.Time
+	longSent   bool
+	lastRepeat time.Time
+	tapped     bool // If the last press was released before it became a long press
+	doubleTap  bool // If the current press completed a double tap, so releasing it doesn't count as a tap
+}
+
+// ButtonEventDetector turns the button levels in a stream of statuses from a single Joycon into button events
+type ButtonEventDetector struct {
+	Default ButtonTimings            // Timings used for buttons without their own timings
+	Timings map[Button]ButtonTimings // Timings for individual buttons
+
+	states map[Button]*buttonState
+}
+
+// NewButtonEventDetector returns a detector that uses DefaultButtonTimings for every button
+func NewButtonEventDetector() *ButtonEventDetector {
+	return &ButtonEventDetector{
+		Default: DefaultButtonTimings,
+		Timings: make(map[Button]ButtonTimings),
+		states:  make(map[Button]*buttonState),
+	}
+}
+
+func (d *ButtonEventDetector) timings(b Button) ButtonTimings {
+	if t, ok := d.Timings[b]; ok {
+		return t
+	}
+	return d.Default
+}
+
+// Update compares the given status with the previous one and returns the resulting events in button order
+func (d *ButtonEventDetector) Update(js *JoyconStatus) []ButtonEvent {
+	now := js.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	events := []ButtonEvent{}
+	event := func(b Button, kind ButtonEventKind, held time.Duration) {
+		events = append(events, ButtonEvent{Serial: js.Serial, Button: b, Kind: kind, Time: now, Held: held})
+	}
+
+	for _, b := range Buttons {
+		s, ok := d.states[b]
+		if !ok {
+			s = &buttonState{}
+			d.states[b] = s
+		}
+		t := d.timings(b)
+		pressed := js.Buttons.Has(b)
+
+		switch {
+		case pressed && !s.pressed:
+			doubleTap := s.tapped && t.DoubleTap > 0 && now.Sub(s.releasedAt) <= t.DoubleTap
+			s.pressed = true
+			s.pressedAt = now
+			s.longSent = false
+			s.lastRepeat = time.Time{}
+			// A double tap completes the sequence, so a third tap starts a new one
+			s.doubleTap = doubleTap
+			s.tapped = false
+			event(b, EventDown, 0)
+			if doubleTap {
+				event(b, EventDoubleTap, 0)
+			}
+		case !pressed && s.pressed:
+			held := now.Sub(s.pressedAt)
+			s.pressed = false
+			s.releasedAt = now
+			s.tapped = !s.doubleTap && !s.longSent && (t.LongPress == 0 || held < t.LongPress)
+			event(b, EventUp, held)
+		case pressed:
+			held := now.Sub(s.pressedAt)
+			if t.LongPress > 0 && !s.longSent && held >= t.LongPress {
+				s.longSent = true
+				event(b, EventLongPress, held)
+			}
+			if t.RepeatDelay > 0 {
+				if s.lastRepeat.IsZero() {
+					if held >= t.RepeatDelay {
+						s.lastRepeat = now
+						event(b, EventRepeat, held)
+					}
+				} else if t.RepeatInterval > 0 && now.Sub(s.lastRepeat) >= t.RepeatInterval {
+					s.lastRepeat = now
+					event(b, EventRepeat, held)
+				}
+			}
+		}
+	}
+	return events
+}
+
+// ButtonEvents reads statuses from a single Joycon (e.g. Joycon.Status()) and sends the button events they cause to the
+// returned channel. The returned channel is closed once statuses is closed or the context is done.
+func ButtonEvents(ctx context.Context, statuses <-chan *JoyconStatus, d *ButtonEventDetector) <-chan ButtonEvent {
+	eventC := make(chan ButtonEvent)
+	go func() {
+		defer close(eventC)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case js, ok := <-statuses:
+				if !ok {
+					return
+				}
+				for _, e := range d.Update(js) {
+					select {
+					case eventC <- e:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return eventC
+}
@@ -0,0 +1,171 @@
+package joycon_test
+
+import (
+	"testing"
+	"time"
+
+	"joyku/pkg/joycon"
+)
+
+func TestButtonEventDetector(t *testing.T) {
+	const ms = time.Millisecond
+	timings := joycon.ButtonTimings{
+		LongPress:      500 * ms,
+		RepeatDelay:    600 * ms,
+		RepeatInterval: 100 * ms,
+		DoubleTap:      300 * ms,
+	}
+
+	// step is a status sent to the detector at the given offset, with A either held or not
+	type step struct {
+		at      time.Duration
+		pressed bool
+	}
+	// event is an event expected at the given offset
+	type event struct {
+		kind joycon.ButtonEventKind
+		at   time.Duration
+		held time.Duration
+	}
+
+	tests := []struct {
+		name    string
+		timings joycon.ButtonTimings
+		steps   []step
+		want    []event
+	}{
+		{
+			name:    "tap",
+			timings: timings,
+			steps:   []step{{0, true}, {100 * ms, false}},
+			want:    []event{{joycon.EventDown, 0, 0}, {joycon.EventUp, 100 * ms, 100 * ms}},
+		},
+		{
+			name:    "hold",
+			timings: timings,
+			steps: []step{
+				{0, true}, {400 * ms, true}, {500 * ms, true}, {600 * ms, true}, {650 * ms, true}, {700 * ms, true},
+				{800 * ms, true}, {850 * ms, false},
+			},
+			want: []event{
+				{joycon.EventDown, 0, 0},
+				{joycon.EventLongPress, 500 * ms, 500 * ms},
+				{joycon.EventRepeat, 600 * ms, 600 * ms},
+				{joycon.EventRepeat, 700 * ms, 700 * ms},
+				{joycon.EventRepeat, 800 * ms, 800 * ms},
+				{joycon.EventUp, 850 * ms, 850 * ms},
+			},
+		},
+		{
+			name:    "double tap",
+			timings: timings,
+			steps:   []step{{0, true}, {100 * ms, false}, {300 * ms, true}, {400 * ms, false}},
+			want: []event{
+				{joycon.EventDown, 0, 0},
+				{joycon.EventUp, 100 * ms, 100 * ms},
+				{joycon.EventDown, 300 * ms, 0},
+				{joycon.EventDoubleTap, 300 * ms, 0},
+				{joycon.EventUp, 400 * ms, 100 * ms},
+			},
+		},
+		{
+			// The double tap completed the sequence, so the third tap is only a tap
+			name:    "third tap starts over",
+			timings: timings,
+			steps: []step{
+				{0, true}, {50 * ms, false}, {100 * ms, true}, {150 * ms, false}, {200 * ms, true}, {250 * ms, false},
+				{300 * ms, true},
+			},
+			want: []event{
+				{joycon.EventDown, 0, 0},
+				{joycon.EventUp, 50 * ms, 50 * ms},
+				{joycon.EventDown, 100 * ms, 0},
+				{joycon.EventDoubleTap, 100 * ms, 0},
+				{joycon.EventUp, 150 * ms, 50 * ms},
+				{joycon.EventDown, 200 * ms, 0},
+				{joycon.EventUp, 250 * ms, 50 * ms},
+				// The third tap was the first of a new sequence
+				{joycon.EventDown, 300 * ms, 0},
+				{joycon.EventDoubleTap, 300 * ms, 0},
+			},
+		},
+		{
+			name:    "second tap too late",
+			timings: timings,
+			steps:   []step{{0, true}, {100 * ms, false}, {401 * ms, true}},
+			want: []event{
+				{joycon.EventDown, 0, 0},
+				{joycon.EventUp, 100 * ms, 100 * ms},
+				{joycon.EventDown, 401 * ms, 0},
+			},
+		},
+		{
+			// A long press isn't a tap, so pressing again right after it isn't a double tap
+			name:    "press after a long press",
+			timings: timings,
+			steps:   []step{{0, true}, {500 * ms, true}, {550 * ms, false}, {600 * ms, true}},
+			want: []event{
+				{joycon.EventDown, 0, 0},
+				{joycon.EventLongPress, 500 * ms, 500 * ms},
+				{joycon.EventUp, 550 * ms, 550 * ms},
+				{joycon.EventDown, 600 * ms, 0},
+			},
+		},
+		{
+			// Without long presses every release is a tap, no matter how long the button was held
+			name:    "long press disabled",
+			timings: joycon.ButtonTimings{DoubleTap: 300 * ms},
+			steps:   []step{{0, true}, {2000 * ms, true}, {2100 * ms, false}, {2200 * ms, true}},
+			want: []event{
+				{joycon.EventDown, 0, 0},
+				{joycon.EventUp, 2100 * ms, 2100 * ms},
+				{joycon.EventDown, 2200 * ms, 0},
+				{joycon.EventDoubleTap, 2200 * ms, 0},
+			},
+		},
+		{
+			// Without a repeat interval only the first repeat is sent
+			name:    "repeat interval disabled",
+			timings: joycon.ButtonTimings{RepeatDelay: 200 * ms},
+			steps:   []step{{0, true}, {200 * ms, true}, {400 * ms, true}, {600 * ms, true}},
+			want: []event{
+				{joycon.EventDown, 0, 0},
+				{joycon.EventRepeat, 200 * ms, 200 * ms},
+			},
+		},
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := joycon.NewButtonEventDetector()
+			d.Timings[joycon.ButtonA] = tt.timings
+
+			got := []joycon.ButtonEvent{}
+			for _, s := range tt.steps {
+				js := &joycon.JoyconStatus{Serial: "00:00:00:00:00:01", Timestamp: start.Add(s.at)}
+				if s.pressed {
+					js.Buttons = joycon.ButtonA
+				}
+				got = append(got, d.Update(js)...)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d events (%v), want %d", len(got), got, len(tt.want))
+			}
+			for i, w := range tt.want {
+				want := joycon.ButtonEvent{
+					Serial: "00:00:00:00:00:01",
+					Button: joycon.ButtonA,
+					Kind:   w.kind,
+					Time:   start.Add(w.at),
+					Held:   w.held,
+				}
+				if got[i] != want {
+					t.Errorf("event %d: got %s at %s (held %s), want %s at %s (held %s)", i,
+						got[i].Kind, got[i].Time.Sub(start), got[i].Held, want.Kind, w.at, want.Held)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package joycon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"joyku/internal/spi"
+)
+
+// Amount of flash that is read before it's written out and progress is reported
+const flashDumpBlockSize = 0x1000
+
+// flashSection is a section of SPI flash that is read a second time after dumping, to make sure it transferred cleanly
+type flashSection struct {
+	name    string
+	address uint32
+	size    int
+}
+
+var (
+	// Factory calibration of both sticks, it's unique to each controller
+	factoryStickSection = flashSection{"factory stick calibration", spi.LeftStickFactoryCalibrationSection, 18}
+	// Sections holding the calibration and colors of a controller, which are the parts of a dump that matter most
+	flashCheckedSections = []flashSection{
+		{"factory imu calibration", spi.AxisMotionSensorFactoryCalibrationSection, 24},
+		factoryStickSection,
+		{"colors", spi.BodyColorSection, 6},
+		{"stick device parameters", spi.ProSensorAndStickDeviceParameters, 0x2A},
+		{"user calibration", spi.UserCalibrationStart, userCalibrationSize},
+	}
+)
+
+// FlashProgress is called while dumping flash with the number of bytes read so far and the total number of bytes
+type FlashProgress func(read int, total int)
+
+// DumpFlash reads the entire SPI flash of this Joycon and writes it to w, calling progress (if it's set) as it goes.
+// Once everything is read the calibration and color sections are read again and compared, and the image is checked
+// with VerifyFlash. The dump has been fully written to w even if it fails these checks.
+func (j *Joycon) DumpFlash(ctx context.Context, w io.Writer, progress FlashProgress) error {
+	dp, err := j.connectedDispatcher()
+	if err != nil {
+		return err
+	}
+
+	total := int(spi.FlashSize)
+	image := make([]byte, 0, total)
+	for len(image) < total {
+		block, err := spi.ReadRange(ctx, dp, uint32(len(image)), min(flashDumpBlockSize, total-len(image)))
+		if err != nil {
+			return fmt.Errorf("could not dump flash: %w", err)
+		}
+		if _, err := w.Write(block); err != nil {
+			return fmt.Errorf("could not write flash dump: %w", err)
+		}
+		image = append(image, block...)
+		if progress != nil {
+			progress(len(image), total)
+		}
+	}
+
+	for _, s := range flashCheckedSections {
+		data, err := spi.ReadRange(ctx, dp, s.address, s.size)
+		if err != nil {
+			return fmt.Errorf("could not check flash dump: %w", err)
+		}
+		if !bytes.Equal(data, image[s.address:int(s.address)+s.size]) {
+			return fmt.Errorf("%s read differently the second time, the flash dump may be corrupt", s.name)
+		}
+	}
+	return VerifyFlash(image, j.ControllerType)
+}
+
+// VerifyFlash checks that the calibration and color sections of a flash image from the given type of controller are
+// intact. User calibration sections that were never written are fine, but factory sections must always be set.
+func VerifyFlash(image []byte, ct ControllerType) error {
+	if len(image) != int(spi.FlashSize) {
+		return fmt.Errorf("flash image must be %d bytes, got %d", spi.FlashSize, len(image))
+	}
+	sections := stickSectionsFor(ct)
+	if sections == nil {
+		return fmt.Errorf("can not verify the flash of an unknown controller type (%s)", ct)
+	}
+	section := func(address uint32, size int) []byte {
+		return image[address : int(address)+size]
+	}
+
+	var errs []error
+	if isErased(section(spi.BodyColorSection, 3)) {
+		errs = append(errs, errors.New("body color is erased"))
+	}
+	if isErased(section(spi.ButtonColorSection, 3)) {
+		errs = append(errs, errors.New("button color is erased"))
+	}
+
+	for _, s := range sections {
+		deadzone := image[s.parameters+uint32(s.deadzoneOffset)]
+		if _, err := parseStickCalibration(section(s.factory, 9), deadzone, s.unmarshal); err != nil {
+			errs = append(errs, fmt.Errorf("factory stick calibration at 0x%04X: %w", s.factory, err))
+		}
+		err := verifyUserSection(section(s.magic, len(spi.UserCalibrationMagic)), func() error {
+			_, err := parseStickCalibration(section(s.user, 9), deadzone, s.unmarshal)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user stick calibration at 0x%04X: %w", s.user, err))
+		}
+	}
+
+	factory := section(spi.AxisMotionSensorFactoryCalibrationSection, 24)
+	if isErased(factory) {
+		errs = append(errs, errors.New("factory imu calibration is erased"))
+	} else if err := unmarshalIMUCalibration(factory).Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("factory imu calibration: %w", err))
+	}
+	err := verifyUserSection(section(spi.AxisMotionSensorUserCalibrationMagic, len(spi.UserCalibrationMagic)), func() error {
+		return unmarshalIMUCalibration(section(spi.AxisMotionSensorUserCalibrationSection, 24)).Validate()
+	})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("user imu calibration: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// RestoreFlash puts back the user calibration from a flash image made with DumpFlash. The rest of the flash holds
+// factory data that is never written, so restoring an image from a different controller is refused.
+func (j *Joycon) RestoreFlash(ctx context.Context, image []byte) error {
+	if err := VerifyFlash(image, j.ControllerType); err != nil {
+		return fmt.Errorf("could not restore flash: %w", err)
+	}
+	dp, err := j.connectedDispatcher()
+	if err != nil {
+		return err
+	}
+
+	// Factory calibration is unique to each controller, so it tells us if the image came from this one
+	factory := factoryStickSection
+	data, err := spi.ReadRange(ctx, dp, factory.address, factory.size)
+	if err != nil {
+		return fmt.Errorf("could not restore flash: %w", err)
+	}
+	if !bytes.Equal(data, image[factory.address:int(factory.address)+factory.size]) {
+		return fmt.Errorf("could not restore flash: the image is from a different controller than %s", j.Name)
+	}
+	return j.RestoreUserCalibration(ctx, image[spi.UserCalibrationStart:spi.UserCalibrationEnd])
+}
+
+// verifyUserSection checks a user calibration section with the given magic. Sections without the magic were never
+// written by the user and are skipped, otherwise parse is used to check the calibration itself.
+func verifyUserSection(magic []byte, parse func() error) error {
+	if bytes.Equal(magic, spi.UserCalibrationMagic) {
+		return parse()
+	}
+	if isErased(magic) {
+		return nil
+	}
+	return fmt.Errorf("magic % X is corrupt", magic)
+}
+
+// isErased returns true if every byte is 0xFF, which is what flash that was never written (or was erased) reads as
+func isErased(data []byte) bool {
+	for _, b := range data {
+		if b != 0xFF {
+			return false
+		}
+	}
+	return true
+}
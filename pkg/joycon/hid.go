@@ -0,0 +1,49 @@
+package joycon
+
+import (
+	"joyku/internal/transport"
+	"time"
+
+	"github.com/sstallion/go-hid"
+)
+
+// Transport is the connection used to communicate with a Joycon. See ConnectTransport.
+type Transport = transport.Transport
+
+// hidBackend discovers Joycons by enumerating the HID devices attached to the system
+type hidBackend struct{}
+
+func (hidBackend) Enumerate(fn func(info DeviceInfo) error) error {
+	return hid.Enumerate(JoyconVendorID, hid.ProductIDAny, func(info *hid.DeviceInfo) error {
+		return fn(DeviceInfo{
+			ProductID: info.ProductID,
+			Serial:    info.SerialNbr,
+			Name:      info.ProductStr,
+		})
+	})
+}
+
+func (hidBackend) Open(info DeviceInfo) (Transport, error) {
+	d, err := hid.Open(JoyconVendorID, info.ProductID, info.Serial)
+	if err != nil {
+		return nil, err
+	}
+	return hidTransport{d}, nil
+}
+
+func (hidBackend) Close() error {
+	return hid.Exit()
+}
+
+// hidTransport adapts a HID device to the Transport interface
+type hidTransport struct {
+	*hid.Device
+}
+
+func (h hidTransport) ReadWithTimeout(p []byte, timeout time.Duration) (int, error) {
+	n, err := h.Device.ReadWithTimeout(p, timeout)
+	if err == hid.ErrTimeout {
+		return n, transport.ErrTimeout
+	}
+	return n, err
+}
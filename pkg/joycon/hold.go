@@ -0,0 +1,159 @@
+package joycon
+
+import "fmt"
+
+// HoldMode is the way a single Joycon is held. Joycons held sideways have their stick and face buttons rotated so
+// up is always away from the user, and the SL and SR buttons on the rail become the L and R shoulder buttons.
+type HoldMode byte
+
+const (
+	HoldVertical      HoldMode = iota // Held upright, the same way it's attached to a Switch
+	HoldSidewaysLeft                  // Held sideways with the stick under the left thumb and the rail facing away
+	HoldSidewaysRight                 // Held sideways with the stick under the right thumb and the rail facing the user
+)
+
+func (m HoldMode) String() string {
+	switch m {
+	case HoldVertical:
+		return "Vertical"
+	case HoldSidewaysLeft:
+		return "Sideways (left)"
+	case HoldSidewaysRight:
+		return "Sideways (right)"
+	default:
+		return "Invalid"
+	}
+}
+
+// Buttons around the face of each Joycon in clockwise order, starting from the top when held vertically
+var (
+	leftFaceButtons  = [4]Button{ButtonUp, ButtonRight, ButtonDown, ButtonLeft}
+	rightFaceButtons = [4]Button{ButtonX, ButtonA, ButtonB, ButtonY}
+)
+
+// quarterTurns returns how many clockwise quarter turns a Joycon of the given type is rotated by when held this way,
+// negative turns are counterclockwise
+func (m HoldMode) quarterTurns(ct ControllerType) int {
+	turns := 0
+	switch m {
+	case HoldSidewaysLeft:
+		turns = 1
+	case HoldSidewaysRight:
+		turns = -1
+	}
+	// The rail is on the opposite side of each Joycon, so the left one is turned the other way
+	if ct == ControllerTypeLeft {
+		turns = -turns
+	}
+	return turns
+}
+
+// SetHoldMode sets how this Joycon is held. Only a single Joycon can be held sideways.
+func (j *Joycon) SetHoldMode(m HoldMode) error {
+	if m > HoldSidewaysRight {
+		return fmt.Errorf("invalid hold mode: %d", m)
+	}
+	if m != HoldVertical && !j.IsLeft() && !j.IsRight() {
+		return fmt.Errorf("%s can not be held sideways", j.ControllerType)
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.holdMode = m
+	return nil
+}
+
+// HoldMode returns how this Joycon is held
+func (j *Joycon) HoldMode() HoldMode {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.holdMode
+}
+
+// applyHoldMode rotates the stick and buttons of a status parsed for a vertical Joycon to match the given hold mode
+func applyHoldMode(js *JoyconStatus, m HoldMode, ct ControllerType, sc StickCalibration, r StickResponse) {
+	turns := m.quarterTurns(ct)
+	if turns == 0 {
+		return
+	}
+
+	js.JoystickData = calibrateStick(rotateStickData(js.JoystickData, sc, turns), rotateStickCalibration(sc, turns), r)
+
+	face, sl, sr, shoulder, trigger := leftFaceButtons, ButtonLeftSL, ButtonLeftSR, ButtonL, ButtonZL
+	if ct == ControllerTypeRight {
+		face, sl, sr, shoulder, trigger = rightFaceButtons, ButtonRightSL, ButtonRightSR, ButtonR, ButtonZR
+	}
+	buttons := rotateButtons(js.Buttons, face, turns)
+
+	// The shoulder and trigger end up next to each other on the far edge, so both act as the trigger
+	rail := buttons & (sl | sr | shoulder | trigger)
+	buttons &^= rail
+	if rail&(shoulder|trigger) != 0 {
+		buttons |= trigger
+	}
+	left, right := ButtonL, ButtonR
+	if m == HoldSidewaysRight {
+		left, right = right, left
+	}
+	if rail.Has(sl) {
+		buttons |= left
+	}
+	if rail.Has(sr) {
+		buttons |= right
+	}
+
+	js.Buttons = buttons
+	js.setButtonFields()
+}
+
+// rotateButtons moves each face button to the position it's in after the given number of clockwise quarter turns
+func rotateButtons(b Button, face [4]Button, turns int) Button {
+	rotated := b &^ (face[0] | face[1] | face[2] | face[3])
+	for i, fb := range face {
+		if b.Has(fb) {
+			rotated |= face[((i+turns)%4+4)%4]
+		}
+	}
+	return rotated
+}
+
+// rotateStickData rotates the stick values by a quarter turn (clockwise if turns is positive) around the center of
+// the calibration. Axes are mirrored around their center so the distance from the center is kept.
+func rotateStickData(sd StickData, sc StickCalibration, turns int) StickData {
+	if turns > 0 {
+		return StickData{Horizontal: sd.Vertical, Vertical: mirrorStickValue(sd.Horizontal, sc.XAxisCenter)}
+	}
+	return StickData{Horizontal: mirrorStickValue(sd.Vertical, sc.YAxisCenter), Vertical: sd.Horizontal}
+}
+
+// rotateStickCalibration returns the calibration of the stick after rotateStickData was applied with the same turns
+func rotateStickCalibration(sc StickCalibration, turns int) StickCalibration {
+	rotated := StickCalibration{Deadzone: sc.Deadzone}
+	if turns > 0 {
+		rotated.XAxisCenter = sc.YAxisCenter
+		rotated.XAxisMinBelowCenter = sc.YAxisMinBelowCenter
+		rotated.XAxisMaxAboveCenter = sc.YAxisMaxAboveCenter
+		rotated.YAxisCenter = sc.XAxisCenter
+		rotated.YAxisMinBelowCenter = sc.XAxisMaxAboveCenter
+		rotated.YAxisMaxAboveCenter = sc.XAxisMinBelowCenter
+	} else {
+		rotated.XAxisCenter = sc.YAxisCenter
+		rotated.XAxisMinBelowCenter = sc.YAxisMaxAboveCenter
+		rotated.XAxisMaxAboveCenter = sc.YAxisMinBelowCenter
+		rotated.YAxisCenter = sc.XAxisCenter
+		rotated.YAxisMinBelowCenter = sc.XAxisMinBelowCenter
+		rotated.YAxisMaxAboveCenter = sc.XAxisMaxAboveCenter
+	}
+	return rotated
+}
+
+// mirrorStickValue mirrors a 12-bit stick value around the given center
+func mirrorStickValue(v uint16, center uint16) uint16 {
+	mirrored := 2*int(center) - int(v)
+	if mirrored < 0 {
+		return 0
+	} else if mirrored > 0xFFF {
+		return 0xFFF
+	}
+	return uint16(mirrored)
+}
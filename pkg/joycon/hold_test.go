@@ -0,0 +1,79 @@
+package joycon
+
+import "testing"
+
+// pushStick returns the raw values of a stick pushed all the way in the given direction, relative to the Joycon held
+// vertically
+func pushStick(sc StickCalibration, d StickDirection) StickData {
+	sd := StickData{Horizontal: sc.XAxisCenter, Vertical: sc.YAxisCenter}
+	switch d {
+	case StickUp:
+		sd.Vertical += sc.YAxisMaxAboveCenter
+	case StickDown:
+		sd.Vertical -= sc.YAxisMinBelowCenter
+	case StickRight:
+		sd.Horizontal += sc.XAxisMaxAboveCenter
+	case StickLeft:
+		sd.Horizontal -= sc.XAxisMinBelowCenter
+	}
+	return sd
+}
+
+func TestApplyHoldMode(t *testing.T) {
+	tests := []struct {
+		ct         ControllerType
+		mode       HoldMode
+		up         Button         // Face button that is reported as the top one (Up or X)
+		stickUp    StickDirection // Direction the stick is pushed in to be reported as up
+		stickRight StickDirection // Direction the stick is pushed in to be reported as right
+		sl, sr     Button         // Buttons SL and SR are reported as
+	}{
+		{ControllerTypeLeft, HoldVertical, ButtonUp, StickUp, StickRight, ButtonLeftSL, ButtonLeftSR},
+		{ControllerTypeLeft, HoldSidewaysLeft, ButtonRight, StickRight, StickDown, ButtonL, ButtonR},
+		{ControllerTypeLeft, HoldSidewaysRight, ButtonLeft, StickLeft, StickUp, ButtonR, ButtonL},
+		{ControllerTypeRight, HoldVertical, ButtonX, StickUp, StickRight, ButtonRightSL, ButtonRightSR},
+		{ControllerTypeRight, HoldSidewaysLeft, ButtonY, StickLeft, StickUp, ButtonL, ButtonR},
+		{ControllerTypeRight, HoldSidewaysRight, ButtonA, StickRight, StickDown, ButtonR, ButtonL},
+	}
+
+	// The calibration isn't symmetric, so the rotated calibration must follow the axes it was rotated with
+	sc := leftStickCalibration
+	for _, tt := range tests {
+		t.Run(tt.ct.String()+" "+tt.mode.String(), func(t *testing.T) {
+			top, sl, sr, shoulder, trigger := ButtonUp, ButtonLeftSL, ButtonLeftSR, ButtonL, ButtonZL
+			if tt.ct == ControllerTypeRight {
+				top, sl, sr, shoulder, trigger = ButtonX, ButtonRightSL, ButtonRightSR, ButtonR, ButtonZR
+			}
+
+			// apply returns the status of a Joycon held this way with the given buttons pressed and stick pushed
+			apply := func(buttons Button, stick StickDirection) *JoyconStatus {
+				js := &JoyconStatus{Buttons: buttons}
+				js.JoystickData = calibrateStick(pushStick(sc, stick), sc, DefaultStickResponse)
+				applyHoldMode(js, tt.mode, tt.ct, sc, DefaultStickResponse)
+				return js
+			}
+
+			if got := apply(tt.up, NoStickDirection).Buttons; got != top {
+				t.Errorf("pressing %s reported %s, want %s", tt.up, got, top)
+			}
+			if got := apply(0, tt.stickUp).JoystickData.Direction; got != StickUp {
+				t.Errorf("pushing the stick %s reported %s, want %s", tt.stickUp, got, StickUp)
+			}
+			if got := apply(0, tt.stickRight).JoystickData.Direction; got != StickRight {
+				t.Errorf("pushing the stick %s reported %s, want %s", tt.stickRight, got, StickRight)
+			}
+			if got := apply(sl, NoStickDirection).Buttons; got != tt.sl {
+				t.Errorf("pressing SL reported %s, want %s", got, tt.sl)
+			}
+			if got := apply(sr, NoStickDirection).Buttons; got != tt.sr {
+				t.Errorf("pressing SR reported %s, want %s", got, tt.sr)
+			}
+			// Held sideways the shoulder is next to the trigger, so both are the trigger
+			if tt.mode != HoldVertical {
+				if got := apply(shoulder, NoStickDirection).Buttons; got != trigger {
+					t.Errorf("pressing %s reported %s, want %s", shoulder, got, trigger)
+				}
+			}
+		})
+	}
+}
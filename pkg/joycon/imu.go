@@ -0,0 +1,153 @@
+package joycon
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	imuSamplesPerReport = 3                    // Number of IMU samples contained in each 0x30/0x31 input report
+	imuSampleInterval   = 5 * time.Millisecond // Time between each IMU sample in a single input report
+	imuSampleOffset     = 13                   // Offset of the first IMU sample in an input report
+	imuSampleSize       = 12                   // Size of a single IMU sample in bytes
+
+	accelRangeG      = 4.0   // Accelerometer range used with the sensitivity coefficient (+-8G sensor, 16-bit)
+	gyroRangeDPS     = 936.0 // Gyroscope range used with the sensitivity coefficient (+-2000dps sensor, 16-bit)
+	defaultAccelSens = 16384 // Accelerometer sensitivity used when no calibration is available
+	defaultGyroSens  = 13371 // Gyroscope sensitivity used when no calibration is available
+)
+
+// IMUCalibration contains the 6-axis motion sensor calibration stored in SPI flash memory. Each array is ordered X, Y, Z.
+type IMUCalibration struct {
+	AccelOrigin      [3]int16 // Accelerometer value when no acceleration is applied
+	AccelSensitivity [3]int16 // Accelerometer value that corresponds to 1G
+	GyroOrigin       [3]int16 // Gyroscope value when the Joycon is not rotating
+	GyroSensitivity  [3]int16 // Gyroscope value used to scale raw values to degrees per second
+}
+
+// DefaultIMUCalibration is used until calibration data has been read from the Joycon
+var DefaultIMUCalibration = IMUCalibration{
+	AccelSensitivity: [3]int16{defaultAccelSens, defaultAccelSens, defaultAccelSens},
+	GyroSensitivity:  [3]int16{defaultGyroSens, defaultGyroSens, defaultGyroSens},
+}
+
+// IMUSample is a single accelerometer and gyroscope reading. Each full input report contains three samples taken 5ms apart.
+type IMUSample struct {
+	Timestamp     time.Time // Approximate time the sample was taken
+	RawAccel      [3]int16  // Uncalibrated accelerometer values (X, Y, Z)
+	RawGyro       [3]int16  // Uncalibrated gyroscope values (X, Y, Z)
+	Acceleration  AxisData  // Calibrated acceleration in G
+	GyroscopeData AxisData  // Calibrated angular velocity in degrees per second
+}
+
+func unmarshalIMUCalibration(calibration []byte) IMUCalibration {
+	ic := IMUCalibration{}
+	for i := 0; i < 3; i++ {
+		ic.AccelOrigin[i] = int16(binary.LittleEndian.Uint16(calibration[i*2:]))
+		ic.AccelSensitivity[i] = int16(binary.LittleEndian.Uint16(calibration[6+i*2:]))
+		ic.GyroOrigin[i] = int16(binary.LittleEndian.Uint16(calibration[12+i*2:]))
+		ic.GyroSensitivity[i] = int16(binary.LittleEndian.Uint16(calibration[18+i*2:]))
+	}
+	return ic
+}
+
+func marshalIMUCalibration(ic IMUCalibration) []byte {
+	calibration := make([]byte, 24)
+	for i := 0; i < 3; i++ {
+		binary.LittleEndian.PutUint16(calibration[i*2:], uint16(ic.AccelOrigin[i]))
+		binary.LittleEndian.PutUint16(calibration[6+i*2:], uint16(ic.AccelSensitivity[i]))
+		binary.LittleEndian.PutUint16(calibration[12+i*2:], uint16(ic.GyroOrigin[i]))
+		binary.LittleEndian.PutUint16(calibration[18+i*2:], uint16(ic.GyroSensitivity[i]))
+	}
+	return calibration
+}
+
+// Validate returns an error if the sensitivity of an axis is the same as its origin, which would make every value on
+// that axis infinite
+func (ic IMUCalibration) Validate() error {
+	for axis := 0; axis < 3; axis++ {
+		if ic.AccelSensitivity[axis] == ic.AccelOrigin[axis] {
+			return fmt.Errorf("accelerometer sensitivity of axis %d is the same as its origin", axis)
+		}
+		if ic.GyroSensitivity[axis] == ic.GyroOrigin[axis] {
+			return fmt.Errorf("gyroscope sensitivity of axis %d is the same as its origin", axis)
+		}
+	}
+	return nil
+}
+
+// accelCoefficient returns the multiplier used to convert a raw accelerometer value on the given axis to G
+func (ic IMUCalibration) accelCoefficient(axis int) float64 {
+	div := float64(ic.AccelSensitivity[axis]) - float64(ic.AccelOrigin[axis])
+	if div == 0 {
+		div = defaultAccelSens
+	}
+	return accelRangeG / div
+}
+
+// gyroCoefficient returns the multiplier used to convert a raw gyroscope value on the given axis to degrees per second
+func (ic IMUCalibration) gyroCoefficient(axis int) float64 {
+	div := float64(ic.GyroSensitivity[axis]) - float64(ic.GyroOrigin[axis])
+	if div == 0 {
+		div = defaultGyroSens
+	}
+	return gyroRangeDPS / div
+}
+
+// Acceleration converts raw accelerometer values to G
+func (ic IMUCalibration) Acceleration(raw [3]int16) AxisData {
+	return AxisData{
+		X: (float64(raw[0]) - float64(ic.AccelOrigin[0])) * ic.accelCoefficient(0),
+		Y: (float64(raw[1]) - float64(ic.AccelOrigin[1])) * ic.accelCoefficient(1),
+		Z: (float64(raw[2]) - float64(ic.AccelOrigin[2])) * ic.accelCoefficient(2),
+	}
+}
+
+// AngularVelocity converts raw gyroscope values to degrees per second
+func (ic IMUCalibration) AngularVelocity(raw [3]int16) AxisData {
+	return AxisData{
+		X: (float64(raw[0]) - float64(ic.GyroOrigin[0])) * ic.gyroCoefficient(0),
+		Y: (float64(raw[1]) - float64(ic.GyroOrigin[1])) * ic.gyroCoefficient(1),
+		Z: (float64(raw[2]) - float64(ic.GyroOrigin[2])) * ic.gyroCoefficient(2),
+	}
+}
+
+// parseIMUSamples parses the three IMU samples contained in a full input report. The samples are ordered oldest to newest,
+// with the newest sample being taken at approximately the time the report was received.
+func parseIMUSamples(report []byte, ic IMUCalibration, received time.Time) [imuSamplesPerReport]IMUSample {
+	samples := [imuSamplesPerReport]IMUSample{}
+	for i := 0; i < imuSamplesPerReport; i++ {
+		raw := report[imuSampleOffset+(imuSampleSize*i):]
+
+		s := IMUSample{
+			Timestamp: received.Add(-imuSampleInterval * time.Duration(imuSamplesPerReport-1-i)),
+		}
+		for axis := 0; axis < 3; axis++ {
+			s.RawAccel[axis] = int16(binary.LittleEndian.Uint16(raw[axis*2:]))
+			s.RawGyro[axis] = int16(binary.LittleEndian.Uint16(raw[6+axis*2:]))
+		}
+		s.Acceleration = ic.Acceleration(s.RawAccel)
+		s.GyroscopeData = ic.AngularVelocity(s.RawGyro)
+		samples[i] = s
+	}
+	return samples
+}
+
+// averageAxisData returns the average of each axis over the given values
+func averageAxisData(values ...AxisData) AxisData {
+	avg := AxisData{}
+	if len(values) == 0 {
+		return avg
+	}
+	for _, v := range values {
+		avg.X += v.X
+		avg.Y += v.Y
+		avg.Z += v.Z
+	}
+	n := float64(len(values))
+	avg.X /= n
+	avg.Y /= n
+	avg.Z /= n
+	return avg
+}
@@ -0,0 +1,91 @@
+package joycon
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"joyku/internal/report"
+)
+
+// fullModeReport returns a 0x30 input report containing the given raw accelerometer and gyroscope samples
+func fullModeReport(accel, gyro [imuSamplesPerReport][3]int16) []byte {
+	buf := make([]byte, report.ReportLengthBytes)
+	buf[0] = report.StandardFullMode.Byte()
+	for i := 0; i < imuSamplesPerReport; i++ {
+		sample := buf[imuSampleOffset+imuSampleSize*i:]
+		for axis := 0; axis < 3; axis++ {
+			binary.LittleEndian.PutUint16(sample[axis*2:], uint16(accel[i][axis]))
+			binary.LittleEndian.PutUint16(sample[6+axis*2:], uint16(gyro[i][axis]))
+		}
+	}
+	return buf
+}
+
+func TestParseIMUSamples(t *testing.T) {
+	tests := []struct {
+		name        string
+		calibration IMUCalibration
+		accel       [imuSamplesPerReport][3]int16
+		gyro        [imuSamplesPerReport][3]int16
+		wantAccel   [imuSamplesPerReport]AxisData // In G
+		wantGyro    [imuSamplesPerReport]AxisData // In degrees per second
+	}{
+		{
+			name:        "resting flat with the default calibration",
+			calibration: DefaultIMUCalibration,
+			accel:       [3][3]int16{{0, 0, 4096}, {0, 0, 4096}, {0, 0, 4096}},
+			wantAccel:   [3]AxisData{{Z: 1}, {Z: 1}, {Z: 1}},
+		},
+		{
+			name:        "default calibration",
+			calibration: DefaultIMUCalibration,
+			accel:       [3][3]int16{{-4096, 8192, 2048}, {16384, 0, -16384}, {1024, -1024, 0}},
+			gyro:        [3][3]int16{{13371, 0, -13371}, {0, 6685, 0}, {-26742, 0, 13371}},
+			wantAccel:   [3]AxisData{{X: -1, Y: 2, Z: 0.5}, {X: 4, Z: -4}, {X: 0.25, Y: -0.25}},
+			wantGyro:    [3]AxisData{{X: 936, Z: -936}, {Y: 6685 * 936.0 / 13371}, {X: -1872, Z: 936}},
+		},
+		{
+			// The origin is subtracted before scaling, and every axis has its own sensitivity
+			name: "factory calibration with offsets",
+			calibration: IMUCalibration{
+				AccelOrigin:      [3]int16{100, -50, 0},
+				AccelSensitivity: [3]int16{100 + 16384, -50 + 8192, 16384},
+				GyroOrigin:       [3]int16{20, -20, 5},
+				GyroSensitivity:  [3]int16{20 + 9360, -20 + 9360, 5 + 4680},
+			},
+			accel:     [3][3]int16{{100, -50, 4096}, {100 + 4096, -50 - 2048, 0}, {100 - 8192, -50, -4096}},
+			gyro:      [3][3]int16{{20, -20, 5}, {20 + 1000, -20 - 500, 5 + 50}, {20 - 2000, -20, 5 + 100}},
+			wantAccel: [3]AxisData{{Z: 1}, {X: 1, Y: -1}, {X: -2, Z: -1}},
+			wantGyro:  [3]AxisData{{}, {X: 100, Y: -50, Z: 10}, {X: -200, Z: 20}},
+		},
+	}
+
+	received := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	near := func(got, want AxisData) bool {
+		return math.Abs(got.X-want.X) < 1e-9 && math.Abs(got.Y-want.Y) < 1e-9 && math.Abs(got.Z-want.Z) < 1e-9
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := parseIMUSamples(fullModeReport(tt.accel, tt.gyro), tt.calibration, received)
+			for i, s := range samples {
+				if s.RawAccel != tt.accel[i] || s.RawGyro != tt.gyro[i] {
+					t.Errorf("sample %d: got raw values %v and %v, want %v and %v", i, s.RawAccel, s.RawGyro, tt.accel[i], tt.gyro[i])
+				}
+				if !near(s.Acceleration, tt.wantAccel[i]) {
+					t.Errorf("sample %d: got acceleration %+v, want %+v", i, s.Acceleration, tt.wantAccel[i])
+				}
+				if !near(s.GyroscopeData, tt.wantGyro[i]) {
+					t.Errorf("sample %d: got angular velocity %+v, want %+v", i, s.GyroscopeData, tt.wantGyro[i])
+				}
+
+				// Samples are oldest first and 5ms apart, the newest was taken when the report was received
+				want := received.Add(-time.Duration(imuSamplesPerReport-1-i) * 5 * time.Millisecond)
+				if !s.Timestamp.Equal(want) {
+					t.Errorf("sample %d: got timestamp %s, want %s", i, s.Timestamp, want)
+				}
+			}
+		})
+	}
+}
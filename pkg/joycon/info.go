@@ -0,0 +1,108 @@
+package joycon
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"joyku/internal/subcommand"
+)
+
+// ControllerType is the type of controller a device reports itself as
+type ControllerType byte
+
+const (
+	ControllerTypeUnknown ControllerType = 0x00
+	ControllerTypeLeft    ControllerType = 0x01
+	ControllerTypeRight   ControllerType = 0x02
+	ControllerTypePro     ControllerType = 0x03
+)
+
+func (c ControllerType) String() string {
+	switch c {
+	case ControllerTypeLeft:
+		return "Left Joycon"
+	case ControllerTypeRight:
+		return "Right Joycon"
+	case ControllerTypePro:
+		return "Pro Controller"
+	default:
+		return "Unknown"
+	}
+}
+
+// controllerTypeFromProductID returns the controller type that is expected for the given product id
+func controllerTypeFromProductID(productID uint16) ControllerType {
+	switch productID {
+	case LeftJoyconProductID:
+		return ControllerTypeLeft
+	case RightJoyconProductID:
+		return ControllerTypeRight
+	case ProController:
+		return ControllerTypePro
+	default:
+		return ControllerTypeUnknown
+	}
+}
+
+// FirmwareVersion is the version of the firmware running on a controller
+type FirmwareVersion struct {
+	Major byte
+	Minor byte
+}
+
+// String returns the version the same way the Switch shows it (e.g. 4.33), or "Unknown" if it hasn't been read
+func (f FirmwareVersion) String() string {
+	if f.Major == 0 && f.Minor == 0 {
+		return "Unknown"
+	}
+	return fmt.Sprintf("%X.%02X", f.Major, f.Minor)
+}
+
+// DeviceInformation is the reply to the device info subcommand (0x02)
+type DeviceInformation struct {
+	Firmware       FirmwareVersion  // Firmware version of the controller
+	ControllerType ControllerType   // Type the controller reports itself as
+	MAC            net.HardwareAddr // Bluetooth MAC address of the controller
+	SPIColors      bool             // If the colors stored in SPI flash are used, otherwise the default grey is
+}
+
+// requestDeviceInfo asks the controller for its device information
+func requestDeviceInfo(ctx context.Context, r subcommand.Requester) (DeviceInformation, error) {
+	reply, err := r.Request(ctx, subcommand.RequestDeviceInfo, nil)
+	if err != nil {
+		return DeviceInformation{}, fmt.Errorf("could not request device info: %w", err)
+	}
+	return unmarshalDeviceInfo(reply.Data)
+}
+
+// unmarshalDeviceInfo parses the data of a device info reply
+//
+// https://github.com/dekuNukem/Nintendo_Switch_Reverse_Engineering/blob/master/bluetooth_hid_subcommands_notes.md
+func unmarshalDeviceInfo(data []byte) (DeviceInformation, error) {
+	if len(data) < 12 {
+		return DeviceInformation{}, fmt.Errorf("device info is too short (%d bytes)", len(data))
+	}
+	return DeviceInformation{
+		Firmware:       FirmwareVersion{Major: data[0], Minor: data[1]},
+		ControllerType: ControllerType(data[2]),
+		MAC:            net.HardwareAddr(append([]byte{}, data[4:10]...)),
+		SPIColors:      data[11] == 0x01,
+	}, nil
+}
+
+// probeControllerType opens the given device just long enough to ask for its controller type
+func probeControllerType(ctx context.Context, b Backend, info DeviceInfo) (ControllerType, error) {
+	t, err := b.Open(info)
+	if err != nil {
+		return ControllerTypeUnknown, err
+	}
+	dp := subcommand.NewDispatcher(t)
+	defer dp.Close()
+
+	di, err := requestDeviceInfo(ctx, dp)
+	if err != nil {
+		return ControllerTypeUnknown, err
+	}
+	return di.ControllerType, nil
+}
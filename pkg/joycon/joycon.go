@@ -1,25 +1,26 @@
 package joycon
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image/color"
 	"joyku/internal/report"
 	"joyku/internal/spi"
 	"joyku/internal/subcommand"
 	"log"
+	"net"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/sstallion/go-hid"
 )
 
 const (
 	JoyconVendorID       uint16 = 0x057E // Same for every joycon
 	LeftJoyconProductID  uint16 = 0x2006
 	RightJoyconProductID uint16 = 0x2007
-	ProController        uint16 = 0x2009 // Not supported
+	ProController        uint16 = 0x2009
 )
 
 type AxisData struct {
@@ -29,34 +30,41 @@ type AxisData struct {
 }
 
 type JoyconStatus struct {
+	Serial             string // Serial number of the Joycon this status is from
+	ProductID          uint16 // Product id of the Joycon this status is from
 	BatteryLevel       BatteryLevel
 	ConnectionKind     byte
-	LeftButtonSR       bool // If the SR button is being pressed
-	LeftButtonSL       bool // If the SL button is being pressed
-	ButtonMinus        bool // If the minus button is being pressed
-	LeftStickPress     bool // If the left stick is being pressed
-	ButtonCapture      bool // If the capture button is being pressed
-	DPadDown           bool // If the down d-pad button is being pressed
-	DPadUp             bool // If the up d-pad button is being pressed
-	DPadRight          bool // If the right d-pad button is being pressed
-	DPadLeft           bool // If the left d-pad button is being pressed
-	ButtonL            bool // If the L button is being pressed
-	ButtonZL           bool // If the ZL button is being pressed
-	ButtonY            bool // If the Y button is being pressed
-	ButtonX            bool // If the X button is being pressed
-	ButtonB            bool // If the B button is being pressed
-	ButtonA            bool // If the A button is being pressed
-	RightButtonSR      bool // If the SR button is being pressed
-	RightButtonSL      bool // If the SL button is being pressed
-	ButtonR            bool // If the R button is being pressed
-	ButtonZR           bool // If the ZR button is being pressed
-	ButtonPlus         bool // If the plus button is being pressed
-	RightStickPress    bool // If the right stick is being pressed
-	ButtonHome         bool // If the home button is being pressed
-	ButtonChargingGrip bool // If the charging grip button is being pressed
-	JoystickData       StickData
-	Acceleration       AxisData
-	GyroscopeData      AxisData
+	LeftButtonSR       bool                           // If the SR button is being pressed
+	LeftButtonSL       bool                           // If the SL button is being pressed
+	ButtonMinus        bool                           // If the minus button is being pressed
+	LeftStickPress     bool                           // If the left stick is being pressed
+	ButtonCapture      bool                           // If the capture button is being pressed
+	DPadDown           bool                           // If the down d-pad button is being pressed
+	DPadUp             bool                           // If the up d-pad button is being pressed
+	DPadRight          bool                           // If the right d-pad button is being pressed
+	DPadLeft           bool                           // If the left d-pad button is being pressed
+	ButtonL            bool                           // If the L button is being pressed
+	ButtonZL           bool                           // If the ZL button is being pressed
+	ButtonY            bool                           // If the Y button is being pressed
+	ButtonX            bool                           // If the X button is being pressed
+	ButtonB            bool                           // If the B button is being pressed
+	ButtonA            bool                           // If the A button is being pressed
+	RightButtonSR      bool                           // If the SR button is being pressed
+	RightButtonSL      bool                           // If the SL button is being pressed
+	ButtonR            bool                           // If the R button is being pressed
+	ButtonZR           bool                           // If the ZR button is being pressed
+	ButtonPlus         bool                           // If the plus button is being pressed
+	RightStickPress    bool                           // If the right stick is being pressed
+	ButtonHome         bool                           // If the home button is being pressed
+	ButtonChargingGrip bool                           // If the charging grip button is being pressed
+	JoystickData       StickData                      // Stick of a Joycon or the left stick of a Pro Controller
+	RightJoystickData  StickData                      // Right stick of a Pro Controller
+	Buttons            Button                         // Every button that is being pressed
+	Acceleration       AxisData                       // Average calibrated acceleration (G) over the IMU samples
+	GyroscopeData      AxisData                       // Average calibrated angular velocity (deg/s) over the IMU samples
+	IMUSamples         [imuSamplesPerReport]IMUSample // Individual IMU samples, oldest first - only set for full mode reports
+	Orientation        Orientation                    // Estimated orientation after fusing the IMU samples
+	Timestamp          time.Time                      // Time the input report was received
 }
 
 func (js *JoyconStatus) String() string {
@@ -105,150 +113,127 @@ func (js *JoyconStatus) String() string {
 
 // Joycon is the representation of the underlying HID device for a Nintendo Switch Joycon attached to the system
 type Joycon struct {
-	VendorID         uint16             // This will always be 0x057E
-	ProductID        uint16             // This will either be 0x2006 or 0x2007 depending on if its the left or right
-	Serial           string             // The serial number of the HID device (This equivalent to the MAC address)
-	Name             string             // The name (product str) of the HID device
-	BodyColor        color.Color        // The body color of this Joycon
-	ButtonColor      color.Color        // The color of this joycons buttons
-	StickCalibration StickCalibration   // The stick calibration data for this joycons joystick
-	statusC          chan *JoyconStatus // Channel for receiving joycon status updates
-	closeC           chan struct{}      // Channel used for notifying when the Joycon was closed
-	device           *hid.Device        // The underlying HID device for this joycon - set after calling Connect()
-	lock             sync.Mutex         // Internal lock for reading/writing the state of the Joycon
-	closed           bool               // If this Joycon is closed and no longer able to provide data - set after calling Disconnect()
-}
-
-// Pair represents a Joycon "pair", which consists of a left and right Joycon
+	VendorID              uint16                 // This will always be 0x057E
+	ProductID             uint16                 // This will either be 0x2006 or 0x2007 depending on if its the left or right
+	Serial                string                 // The serial number of the HID device (This equivalent to the MAC address)
+	Name                  string                 // The name (product str) of the HID device
+	ControllerType        ControllerType         // The type of controller - reported by the device after calling Connect()
+	Firmware              FirmwareVersion        // The firmware version of this Joycon - set after calling Connect()
+	MAC                   net.HardwareAddr       // The bluetooth MAC address of this Joycon - set after calling Connect()
+	SPIColors             bool                   // If this Joycon uses the colors in its SPI flash - set after calling Connect()
+	BodyColor             color.Color            // The body color of this Joycon
+	ButtonColor           color.Color            // The color of this joycons buttons
+	StickCalibration      StickCalibration       // The stick calibration data for this joycons joystick (the left stick of a Pro Controller)
+	RightStickCalibration StickCalibration       // The stick calibration data for the right stick of a Pro Controller
+	IMUCalibration        IMUCalibration         // The accelerometer and gyroscope calibration data for this joycon
+	orientation           *OrientationFilter     // Fuses IMU samples into an orientation estimate - set while connecting, guarded by lock
+	stickResponse         StickResponse          // How the sticks respond to being pushed, see SetStickResponse
+	stickDirections       [2]StickDirection      // Last direction of each stick, only used by the report loop
+	holdMode              HoldMode               // How this Joycon is held, see SetHoldMode
+	recorder              *Recorder              // Records the input reports of this Joycon, see Record
+	playerLights          PlayerLights           // Last pattern set with SetPlayerLights, restored after reconnecting
+	statusC               chan *JoyconStatus     // Channel for receiving joycon status updates
+	stateC                chan StateChange       // Channel for receiving connection state changes
+	closeC                chan struct{}          // Channel used for notifying when the Joycon was closed
+	registry              *Registry              // Registry this Joycon was found with, nil if it was created with New
+	open                  openFunc               // Opens the device again when reconnecting, nil if it can't be - set after calling Connect()
+	device                Transport              // The underlying connection to this joycon - set after calling Connect()
+	dispatcher            *subcommand.Dispatcher // Reads from device and routes subcommand replies - set after calling Connect()
+	lock                  sync.Mutex             // Internal lock for reading/writing the state of the Joycon
+	rumbleLock            sync.Mutex             // Ensures only one rumble pattern is played at a time
+	state                 ConnectionState        // State of the connection, see State
+}
+
+// Pair represents a Joycon "pair", which consists of a left and right Joycon. A Pro Controller is a complete controller
+// on its own, so it takes the place of both.
 type Pair struct {
 	Left  *Joycon
 	Right *Joycon
+	Pro   *Joycon
 }
 
 func (p Pair) Empty() bool {
-	return p.Left == nil && p.Right == nil
+	return p.Left == nil && p.Right == nil && p.Pro == nil
 }
 
-// Map of connected joycons
-var connectedJoycons = make(map[string]*Joycon)
+// Complete returns true if the pair has both a left and right Joycon or a Pro Controller
+func (p Pair) Complete() bool {
+	return (p.Left != nil && p.Right != nil) || p.Pro != nil
+}
 
-// Find attempts to find a Joycon connected to the system with the given serial number
-func Find(serial string) *Joycon {
-	if j, ok := connectedJoycons[serial]; ok {
-		return j
+// add adds jc to the pair if its place is empty and returns true if it was added
+func (p *Pair) add(jc *Joycon) bool {
+	switch {
+	case jc.IsLeft() && p.Left == nil:
+		p.Left = jc
+	case jc.IsRight() && p.Right == nil:
+		p.Right = jc
+	case jc.IsPro() && p.Pro == nil:
+		p.Pro = jc
+	default:
+		return false
+	}
+	return true
+}
+
+// New returns a Joycon with the given product id, serial number, and name that has not been connected yet. Joycons
+// attached to the system should be found with Find, FindAll, or FindFirstPair instead; New is intended for Joycons
+// that are connected with ConnectTransport.
+func New(productID uint16, serial string, name string) *Joycon {
+	return &Joycon{
+		VendorID:       JoyconVendorID,
+		ProductID:      productID,
+		Serial:         serial,
+		Name:           name,
+		ControllerType: controllerTypeFromProductID(productID),
+		IMUCalibration: DefaultIMUCalibration,
+		stickResponse:  DefaultStickResponse,
+		statusC:        make(chan *JoyconStatus),
+		stateC:         make(chan StateChange, stateBufferSize),
+		closeC:         make(chan struct{}),
+		state:          StateDisconnected,
 	}
+}
 
-	jc := new(Joycon)
-	hid.Enumerate(JoyconVendorID, hid.ProductIDAny, func(info *hid.DeviceInfo) error {
-		if jc != nil {
-			return nil
-		}
-		if strings.EqualFold(serial, info.SerialNbr) {
-			jc = &Joycon{
-				VendorID:  info.VendorID,
-				ProductID: info.ProductID,
-				Serial:    info.SerialNbr,
-				Name:      info.ProductStr,
-				device:    nil,
-				statusC:   make(chan *JoyconStatus),
-				closeC:    make(chan struct{}),
-				closed:    false,
-			}
-			connectedJoycons[info.SerialNbr] = jc
-		}
-		return nil
-	})
-	return jc
+// ErrNotConnected is returned when an operation requires a connected Joycon
+var ErrNotConnected = errors.New("joycon is not connected")
+
+// Find attempts to find a Joycon attached to the system with the given serial number, nil is returned if there isn't
+// one. Joycons are found with DefaultRegistry, see Registry.Find.
+func Find(serial string) *Joycon {
+	return DefaultRegistry.Find(serial)
+}
+
+// FindContext is the same as Find, but ctx bounds how long a device with an unexpected product id is probed for
+func FindContext(ctx context.Context, serial string) *Joycon {
+	return DefaultRegistry.FindContext(ctx, serial)
 }
 
 // FindAll finds all joycons connected to this device and returns them
 func FindAll() []*Joycon {
-	joycons := []*Joycon{}
-	hid.Enumerate(JoyconVendorID, hid.ProductIDAny, func(info *hid.DeviceInfo) error {
-		if jc, ok := connectedJoycons[info.SerialNbr]; ok {
-			joycons = append(joycons, jc)
-			return nil
-		}
+	return DefaultRegistry.FindAll()
+}
 
-		if info.ProductID == LeftJoyconProductID || info.ProductID == RightJoyconProductID {
-			jc := &Joycon{
-				VendorID:  info.VendorID,
-				ProductID: info.ProductID,
-				Serial:    info.SerialNbr,
-				Name:      info.ProductStr,
-				device:    nil,
-				statusC:   make(chan *JoyconStatus),
-				closeC:    make(chan struct{}),
-				closed:    false,
-			}
-			joycons = append(joycons, jc)
-			connectedJoycons[info.SerialNbr] = jc
-		}
-		return nil
-	})
-	return joycons
+// FindAllContext is the same as FindAll, but ctx bounds how long devices with an unexpected product id are probed for
+func FindAllContext(ctx context.Context) []*Joycon {
+	return DefaultRegistry.FindAllContext(ctx)
 }
 
-// FindFirstPair finds the first joycon pair and returns them. A joycon pair consists of one left and one right joycon.
+// FindFirstPair finds the first joycon pair and returns them. A joycon pair consists of one left and one right joycon,
+// or a Pro Controller if one is found before a complete pair.
 func FindFirstPair() Pair {
-	pair := Pair{}
-
-	if len(connectedJoycons) > 0 {
-		for _, joycon := range connectedJoycons {
-			if joycon.IsLeft() && pair.Left == nil {
-				pair.Left = joycon
-			} else if joycon.IsRight() && pair.Right == nil {
-				pair.Right = joycon
-			}
-		}
-	}
-
-	if pair.Left != nil && pair.Right != nil {
-		return pair
-	}
-
-	hid.Enumerate(JoyconVendorID, hid.ProductIDAny, func(info *hid.DeviceInfo) error {
-		// we already found a pair, skip
-		if pair.Left != nil && pair.Right != nil {
-			return nil
-		}
+	return DefaultRegistry.FindFirstPair()
+}
 
-		// ignore invalid product id values
-		if info.ProductID != LeftJoyconProductID && info.ProductID != RightJoyconProductID {
-			log.Printf("Received unexpected ProductID value for Joycon: %d, ignoring\n", info.ProductID)
-			return nil
-		}
+// FindFirstPairContext is the same as FindFirstPair, but ctx bounds how long devices with an unexpected product id
+// are probed for
+func FindFirstPairContext(ctx context.Context) Pair {
+	return DefaultRegistry.FindFirstPairContext(ctx)
+}
 
-		if info.ProductID == LeftJoyconProductID && pair.Left == nil {
-			jc := &Joycon{
-				VendorID:  info.VendorID,
-				ProductID: info.ProductID,
-				Serial:    info.SerialNbr,
-				Name:      info.ProductStr,
-				device:    nil,
-				statusC:   make(chan *JoyconStatus),
-				closeC:    make(chan struct{}),
-				closed:    false,
-			}
-			connectedJoycons[info.SerialNbr] = jc
-			pair.Left = jc
-		} else if info.ProductID == RightJoyconProductID && pair.Right == nil {
-			jc := &Joycon{
-				VendorID:  info.VendorID,
-				ProductID: info.ProductID,
-				Serial:    info.SerialNbr,
-				Name:      info.ProductStr,
-				device:    nil,
-				statusC:   make(chan *JoyconStatus),
-				closeC:    make(chan struct{}),
-				closed:    false,
-			}
-			connectedJoycons[info.SerialNbr] = jc
-			pair.Right = jc
-		}
-		return nil
-	})
-	return pair
+// Connected returns every known Joycon that is currently connected, including Joycons that are reconnecting
+func Connected() []*Joycon {
+	return DefaultRegistry.Connected()
 }
 
 // DisconnectAll disconnects all Joycons connected to the system and removes them from internal cache. Each Joycon is
@@ -256,28 +241,38 @@ func FindFirstPair() Pair {
 //
 // This function ignores all errors returned by Joycon.Disconnect()
 func DisconnectAll(closeFunc func(jc *Joycon)) {
-	for serial, jc := range connectedJoycons {
-		jc.Disconnect()
-		delete(connectedJoycons, serial)
-		if closeFunc != nil {
-			closeFunc(jc)
-		}
-	}
-	hid.Exit()
+	DefaultRegistry.DisconnectAll(closeFunc)
 }
 
 // IsLeft returns whether or not this is a left joycon model
 func (j *Joycon) IsLeft() bool {
-	return j.ProductID == LeftJoyconProductID
+	return j.ControllerType == ControllerTypeLeft
 }
 
 // IsRight returns whether or not this is a right joycon model
 func (j *Joycon) IsRight() bool {
-	return j.ProductID == RightJoyconProductID
+	return j.ControllerType == ControllerTypeRight
+}
+
+// IsPro returns whether or not this is a Pro Controller
+func (j *Joycon) IsPro() bool {
+	return j.ControllerType == ControllerTypePro
 }
 
+// IsConnected returns whether or not this Joycon is connected and reporting its status, see State
 func (j *Joycon) IsConnected() bool {
-	return j.device != nil && !j.closed
+	return j.State() == StateConnected
+}
+
+// connectedDispatcher returns the dispatcher of this Joycon or ErrNotConnected if it isn't connected (or is reconnecting)
+func (j *Joycon) connectedDispatcher() (*subcommand.Dispatcher, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.state != StateConnected {
+		return nil, ErrNotConnected
+	}
+	return j.dispatcher, nil
 }
 
 // Status exposes a readonly channel for parsing joycon status packets
@@ -285,12 +280,48 @@ func (j *Joycon) Status() <-chan *JoyconStatus {
 	return j.statusC
 }
 
-// Connect attempts to initiate a connection via HID to this Joycon device (if one isn't already established).
-// Calling this function will populate BodyColor, ButtonColor, and StickCalibration
+// Connect is the same as ConnectContext, without a deadline for the whole handshake
 func (j *Joycon) Connect() error {
+	return j.ConnectContext(context.Background())
+}
+
+// ConnectContext attempts to initiate a connection via HID to this Joycon device (if one isn't already established).
+// Calling this function will populate BodyColor, ButtonColor, and StickCalibration. Every step of the handshake stops
+// once ctx is done, and a failed step is returned as a ConnectError. If the Joycon stops reporting afterwards it's
+// reconnected automatically, see State.
+func (j *Joycon) ConnectContext(ctx context.Context) error {
+	// The backend is looked up before connect takes j.lock, the registry's lock is never taken while it's held
+	b := j.backend()
+	return j.connect(ctx, func() (Transport, error) {
+		return b.Open(DeviceInfo{ProductID: j.ProductID, Serial: j.Serial, Name: j.Name})
+	}, true)
+}
+
+// backend returns the backend of the registry this Joycon was found with, or the default one if it was created with New
+func (j *Joycon) backend() Backend {
+	if j.registry == nil {
+		return DefaultRegistry.Backend()
+	}
+	return j.registry.Backend()
+}
+
+// ConnectTransport is the same as Connect, but communicates with the Joycon over the given transport instead of
+// opening its HID device. The transport is closed when the Joycon is disconnected, and since it can't be opened again
+// the Joycon is disconnected instead of reconnected if it stops reporting.
+func (j *Joycon) ConnectTransport(t Transport) error {
+	return j.connect(context.Background(), func() (Transport, error) {
+		return t, nil
+	}, false)
+}
+
+// openFunc opens the device of a Joycon
+type openFunc func() (Transport, error)
+
+// connect opens the device and initializes the Joycon, reopenable is set if open can be called again to reconnect
+func (j *Joycon) connect(ctx context.Context, open openFunc, reopenable bool) error {
 	j.lock.Lock()
 	// If this joycon has been closed and can no longer be used, return an error
-	if j.closed {
+	if j.state == StateClosed {
 		j.lock.Unlock()
 		return fmt.Errorf("the connection to this joycon (%s) has been closed", j.Name)
 	}
@@ -300,175 +331,220 @@ func (j *Joycon) Connect() error {
 		return fmt.Errorf("a connection to this joycon (%s) has already been made", j.Name)
 	}
 
-	// Open connection to HID device (Joycon)
-	d, err := hid.Open(j.VendorID, j.ProductID, j.Serial)
+	// Open connection to the device (Joycon), opening can't be canceled so don't start if we're already too late
+	if err := ctx.Err(); err != nil {
+		j.lock.Unlock()
+		return ConnectError{Step: StepOpen, Err: err}
+	}
+	d, err := open()
 	if err != nil {
 		j.lock.Unlock()
-		return err
+		return ConnectError{Step: StepOpen, Err: err}
 	}
 	j.device = d
+	j.dispatcher = subcommand.NewDispatcher(d)
 	j.lock.Unlock()
 
-	ctx := context.TODO()
-
-	// Read static configuration values from Joycon SPI flash memory and update this joycon with the data (if no error)
-	err = readColorDataFromSPIFlash(ctx, j)
-	if err != nil {
-		log.Printf("Error while reading color data from spi flash memory - %s", err.Error())
-		return err
-	}
-	err = readStickCalibrationFromSPIFlash(ctx, j)
-	if err != nil {
-		log.Printf("Error while reading stick data from spi flash memory - %s", err.Error())
+	if err := j.initialize(ctx); err != nil {
+		// Leave the Joycon disconnected so connecting can be tried again
+		j.lock.Lock()
+		j.dispatcher.Close()
+		j.dispatcher = nil
+		j.device = nil
+		j.lock.Unlock()
 		return err
 	}
-	// err = readAxisCalibration(ctx, j)
-	// if err != nil {
-	// 	log.Printf("Error while reading axis data from spi flash memory - %s", err.Error())
-	// 	return err
-	// }
 
-	// Enable IMU so we can receive accelerometer and gyroscope data
-	data := []byte{0x01}
-	err = subcommand.Send(j.device, subcommand.EnableIMU, data)
-	if err != nil {
-		return err
+	j.lock.Lock()
+	if reopenable {
+		j.open = open
 	}
+	// The filter must exist before anyone can see the Joycon as connected and reset its orientation
+	j.orientation = NewOrientationFilter()
+	j.changeState(StateConnected)
+	j.lock.Unlock()
 
-	log.Printf("Enabling IMU..")
-	time.Sleep(time.Millisecond * 500)
+	go j.readStatus()
+	return nil
+}
 
-	// Enable vibration
-	data = []byte{0x01}
-	err = subcommand.Send(j.device, subcommand.EnableVibration, data)
-	if err != nil {
-		return err
+// initialize reads the Joycon's configuration from SPI flash and enables full input reports. If a step fails it's
+// returned as a ConnectError.
+func (j *Joycon) initialize(ctx context.Context) error {
+	enable := func(id subcommand.SubcommandID, arg byte) func(context.Context, *Joycon) error {
+		return func(ctx context.Context, j *Joycon) error {
+			_, err := j.dispatcher.Request(ctx, id, []byte{arg})
+			return err
+		}
 	}
-
-	log.Printf("Enabling vibration..")
-	time.Sleep(time.Millisecond * 500)
-
-	// Configure Joycon to Input Report Mode which outputs its status at 60hz
-	data = []byte{0x30}
-	err = subcommand.Send(j.device, subcommand.SetInputReportMode, data)
-	if err != nil {
-		return err
+	// The reported controller type decides how the rest of the configuration is read, so device info must be first
+	steps := []struct {
+		step ConnectStep
+		run  func(context.Context, *Joycon) error
+	}{
+		{StepDeviceInfo, readDeviceInfo},
+		{StepColors, readColorDataFromSPIFlash},
+		{StepStickCalibration, readStickCalibrationFromSPIFlash},
+		{StepIMUCalibration, readAxisCalibration},
+		{StepEnableIMU, enable(subcommand.EnableIMU, 0x01)},
+		{StepEnableVibration, enable(subcommand.EnableVibration, 0x01)},
+		// Configure Joycon to Input Report Mode which outputs its status at 60hz
+		{StepReportMode, enable(subcommand.SetInputReportMode, 0x30)},
+	}
+	for _, s := range steps {
+		if err := s.run(ctx, j); err != nil {
+			return ConnectError{Step: s.step, Err: err}
+		}
 	}
-
-	go j.readStatus()
 	return nil
 }
 
+// ResetOrientation sets the current orientation of this Joycon as the new reference orientation (i.e. no rotation)
+func (j *Joycon) ResetOrientation() {
+	j.lock.Lock()
+	orientation := j.orientation
+	j.lock.Unlock()
+	if orientation != nil {
+		orientation.Reset()
+	}
+}
+
 // Disconnect closes connection to the Joycon and its connection to the system. Because this causes the Joycon to disconnect
 // from the system, this should only be called when you're done with this Joycon. In order to reestablish a connection with this Joycon,
 // it must be rediscovered by using the FindJoycons or FindFirstJoyconPair functions.
 func (j *Joycon) Disconnect() error {
 	j.lock.Lock()
-	if j.closed || j.device == nil {
+	if j.state == StateClosed || j.state == StateDisconnected {
 		j.lock.Unlock()
 		return fmt.Errorf("the connection to this joycon (%s) has already been closed", j.Name)
 	}
-	j.closed = true
+	dp := j.dispatcher
+	j.changeState(StateClosed)
 	j.lock.Unlock()
 
-	// Power the Joy-Con off
+	// Power the Joy-Con off, it disconnects right away so there may not be a reply. This fails if the device was
+	// already lost (or is reconnecting), which doesn't matter since the connection is being closed anyway.
 	data := []byte{0x00}
-	err := subcommand.Send(j.device, subcommand.SetHCIState, data)
-	if err != nil {
-		return err
+	err := dp.Send(subcommand.SetHCIState, data)
+	if errors.Is(err, subcommand.ErrDispatcherClosed) {
+		err = nil
+	}
+	if j.registry != nil {
+		j.registry.remove(j)
 	}
-	delete(connectedJoycons, j.Serial)
 
-	// This must be done before the HID device is closed to prevent reading after closing
-	j.closeC <- struct{}{}
+	// Stop the report loop, the status channel is closed once it has stopped
 	close(j.closeC)
-
-	err = j.device.Close()
-	if err != nil {
-		return err
+	if closeErr := dp.Close(); err == nil {
+		err = closeErr
 	}
-	close(j.statusC)
 	return err
 }
 
+// readStatus parses the input reports read by the dispatcher and sends them to the status channel until the Joycon is
+// disconnected. If the dispatcher stops reading (e.g. the device was lost), the Joycon is reconnected and the reports
+// of the new dispatcher are read, so the status channel stays open.
 func (j *Joycon) readStatus() {
-	// Make one buffer to be reused for each input report
-	buf := make([]byte, report.ReportLengthBytes)
-	// Number of consecutive retries before giving up and disconnecting from the device
-	retries := 5
-	func() {
-		log.Println("Starting input report loop")
-		for {
+	defer close(j.statusC)
+
+	j.lock.Lock()
+	reports := j.dispatcher.Reports()
+	j.lock.Unlock()
+
+	log.Println("Starting input report loop")
+	for {
+		select {
+		case <-j.closeC:
+			log.Println("Device was closed, stopping report loop")
+			return
+		case buf, ok := <-reports:
+			if !ok {
+				dp := j.reconnect()
+				if dp == nil {
+					log.Println("Device was closed, stopping report loop")
+					return
+				}
+				reports = dp.Reports()
+				continue
+			}
+
+			received := time.Now()
+			j.record(buf, received)
+			js := parseInputReport(j, buf, received)
+			if js == nil {
+				continue
+			}
 			select {
+			case j.statusC <- js:
 			case <-j.closeC:
 				log.Println("Device was closed, stopping report loop")
 				return
-			default:
-				// Read will block if there is no data and timeout if it blocks for too long
-				_, err := j.device.ReadWithTimeout(buf, time.Second)
-				if err != nil {
-					if retries <= 0 {
-						log.Printf("Exceeded number of retries while reading from device: %s\n", err)
-						return
-					}
-					retries -= 1
-					log.Printf("An error occurred while reading from device: %s, retrying (%d left)", err, retries)
-				}
-				// Reset number of retries after each successful read
-				retries = 5
-
-				js := parseInputReport(j, buf)
-				if js != nil {
-					j.statusC <- js
-				}
 			}
 		}
-	}()
-	j.Disconnect()
+	}
 }
 
-func parseInputReport(joycon *Joycon, reportData []byte) *JoyconStatus {
+func parseInputReport(joycon *Joycon, reportData []byte, received time.Time) *JoyconStatus {
 	reportId := reportData[0]
 	if !report.Supported(reportId) {
 		log.Printf("Received unsupported input report: %d", reportId)
 		return nil
 	}
 
+	// The calibration can be written while reports are streaming, so the whole report is parsed with the same copy
+	joycon.lock.Lock()
+	stickCalibration := joycon.StickCalibration
+	rightStickCalibration := joycon.RightStickCalibration
+	imuCalibration := joycon.IMUCalibration
+	orientation := joycon.orientation
+	joycon.lock.Unlock()
+
 	var joyconStatus *JoyconStatus
-	if joycon.IsLeft() {
-		joyconStatus = parseLeftJoyconStatus(reportData, joycon.StickCalibration)
+	response := joycon.StickResponse()
+	if joycon.IsPro() {
+		joyconStatus = parseProControllerStatus(reportData, stickCalibration, rightStickCalibration, response)
+	} else if joycon.IsLeft() {
+		joyconStatus = parseLeftJoyconStatus(reportData, stickCalibration, response)
 	} else {
-		joyconStatus = parseRightJoyconStatus(reportData, joycon.StickCalibration)
-	}
-
-	// TODO: Finish implementing gyroscope and accelerometer support
-	// 		 - Will probably need some sort of filter here to reduce noise
-
-	// if reportId == report.StandardFullMode.Byte() || reportId == report.NFCIRMode.Byte() {
-	// 	// three samples are provided for gyroscope and acceleration
-	// 	for i := 0; i < 3; i++ {
-	// 		offset := (12 * i)
-	// 		// parse sample
-	// 		// the constant values are the base values for the first sample
-	// 		ax := int16(reportData[13+offset]) | int16(reportData[14+offset])<<8
-	// 		ay := int16(reportData[15+offset]) | int16(reportData[16+offset])<<8
-	// 		az := int16(reportData[17+offset]) | int16(reportData[18+offset])<<8
-	// 		gx := int16(reportData[19+offset]) | int16(reportData[20+offset])<<8
-	// 		gy := int16(reportData[21+offset]) | int16(reportData[22+offset])<<8
-	// 		gz := int16(reportData[23+offset]) | int16(reportData[24+offset])<<8
-
-	// 		joyconStatus.Acceleration.X = float64(ax)
-	// 		joyconStatus.Acceleration.Y = float64(ay)
-	// 		joyconStatus.Acceleration.Z = float64(az)
-	// 		joyconStatus.GyroscopeData.X = float64(gx)
-	// 		joyconStatus.GyroscopeData.Y = float64(gy)
-	// 		joyconStatus.GyroscopeData.Z = float64(gz)
-	// 	}
-	// }
+		joyconStatus = parseRightJoyconStatus(reportData, stickCalibration, response)
+	}
+	if hold := joycon.HoldMode(); hold != HoldVertical {
+		applyHoldMode(joyconStatus, hold, joycon.ControllerType, stickCalibration, response)
+	}
+	// Keep the previous direction of each stick while it's near the edge of its sector
+	joyconStatus.JoystickData.Direction = response.direction(joyconStatus.JoystickData, joycon.stickDirections[0])
+	joycon.stickDirections[0] = joyconStatus.JoystickData.Direction
+	if joycon.IsPro() {
+		joyconStatus.RightJoystickData.Direction = response.direction(joyconStatus.RightJoystickData, joycon.stickDirections[1])
+		joycon.stickDirections[1] = joyconStatus.RightJoystickData.Direction
+	}
+	joyconStatus.Serial = joycon.Serial
+	joyconStatus.ProductID = joycon.ProductID
+	joyconStatus.Timestamp = received
+
+	// Only full mode reports contain IMU data, reply reports use the same bytes for the subcommand reply
+	if reportId == report.StandardFullMode.Byte() || reportId == report.NFCIRMode.Byte() {
+		joyconStatus.IMUSamples = parseIMUSamples(reportData, imuCalibration, received)
+
+		accel := make([]AxisData, 0, imuSamplesPerReport)
+		gyro := make([]AxisData, 0, imuSamplesPerReport)
+		for _, sample := range joyconStatus.IMUSamples {
+			accel = append(accel, sample.Acceleration)
+			gyro = append(gyro, sample.GyroscopeData)
+		}
+		joyconStatus.Acceleration = averageAxisData(accel...)
+		joyconStatus.GyroscopeData = averageAxisData(gyro...)
+
+		if orientation != nil {
+			for _, sample := range joyconStatus.IMUSamples {
+				joyconStatus.Orientation = orientation.Update(sample)
+			}
+		}
+	}
 	return joyconStatus
 }
 
-func parseLeftJoyconStatus(report []byte, sc StickCalibration) *JoyconStatus {
+func parseLeftJoyconStatus(report []byte, sc StickCalibration, r StickResponse) *JoyconStatus {
 	js := new(JoyconStatus)
 
 	batteryAndConnection := report[2]
@@ -492,17 +568,18 @@ func parseLeftJoyconStatus(report []byte, sc StickCalibration) *JoyconStatus {
 	js.LeftStickPress = ((sharedButtons & 0x08) >> 3) != 0
 	js.ButtonCapture = ((sharedButtons & 0x20) >> 5) != 0
 	js.ButtonChargingGrip = ((sharedButtons & 0x80) >> 7) != 0
+	js.Buttons = buttonsFromReport(report) & leftJoyconButtons
 
 	leftStickData := report[6:9]
 	js.JoystickData = StickData{
 		Horizontal: uint16(leftStickData[0]) | ((uint16(leftStickData[1] & 0xF)) << 8),
 		Vertical:   uint16(leftStickData[1]>>4) | uint16(leftStickData[2])<<4,
 	}
-	js.JoystickData.Direction = calculateStickDirection(js.JoystickData, sc)
+	js.JoystickData = calibrateStick(js.JoystickData, sc, r)
 	return js
 }
 
-func parseRightJoyconStatus(report []byte, sc StickCalibration) *JoyconStatus {
+func parseRightJoyconStatus(report []byte, sc StickCalibration, r StickResponse) *JoyconStatus {
 	js := new(JoyconStatus)
 	batteryAndConnection := report[2]
 	js.BatteryLevel = BatteryFromByte((batteryAndConnection >> 4) & 0xF)
@@ -525,13 +602,54 @@ func parseRightJoyconStatus(report []byte, sc StickCalibration) *JoyconStatus {
 	js.RightStickPress = ((sharedButtons & 0x04) >> 2) != 0
 	js.ButtonHome = ((sharedButtons & 0x10) >> 4) != 0
 	js.ButtonChargingGrip = ((sharedButtons & 0x80) >> 7) != 0
+	js.Buttons = buttonsFromReport(report) & rightJoyconButtons
 
 	rightStickData := report[9:12]
 	js.JoystickData = StickData{
 		Horizontal: uint16(rightStickData[0]) | ((uint16(rightStickData[1] & 0xF)) << 8),
 		Vertical:   uint16(rightStickData[1]>>4) | uint16(rightStickData[2])<<4,
 	}
-	js.JoystickData.Direction = calculateStickDirection(js.JoystickData, sc)
+	js.JoystickData = calibrateStick(js.JoystickData, sc, r)
+	return js
+}
+
+// readDeviceInfo requests the device info of j and stores it in j
+func readDeviceInfo(ctx context.Context, j *Joycon) error {
+	di, err := requestDeviceInfo(ctx, j.dispatcher)
+	if err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if di.ControllerType != j.ControllerType {
+		log.Printf("%s reported itself as a %s but was expected to be a %s, using the reported type\n", j.Name, di.ControllerType, j.ControllerType)
+		j.ControllerType = di.ControllerType
+	}
+	j.Firmware = di.Firmware
+	j.MAC = di.MAC
+	j.SPIColors = di.SPIColors
+	log.Printf("Connected to %s (firmware %s, mac %s)\n", j.ControllerType, j.Firmware, j.MAC)
+	return nil
+}
+
+// parseProControllerStatus parses the status of a Pro Controller, which reports every button and both sticks
+func parseProControllerStatus(report []byte, left StickCalibration, right StickCalibration, r StickResponse) *JoyconStatus {
+	js := parseLeftJoyconStatus(report, left, r)
+	rs := parseRightJoyconStatus(report, right, r)
+
+	js.ButtonY = rs.ButtonY
+	js.ButtonX = rs.ButtonX
+	js.ButtonB = rs.ButtonB
+	js.ButtonA = rs.ButtonA
+	js.ButtonR = rs.ButtonR
+	js.ButtonZR = rs.ButtonZR
+	js.ButtonPlus = rs.ButtonPlus
+	js.RightStickPress = rs.RightStickPress
+	js.ButtonHome = rs.ButtonHome
+	js.Buttons = buttonsFromReport(report) & proControllerButtons
+	js.RightJoystickData = rs.JoystickData
 	return js
 }
 
@@ -542,11 +660,14 @@ func readColorDataFromSPIFlash(ctx context.Context, j *Joycon) error {
 		Size:    6,
 	}
 
-	data, err := spi.Read(ctx, j.device, sfc)
+	data, err := spi.Read(ctx, j.dispatcher, sfc)
 	if err != nil {
 		return err
 	}
 
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
 	j.BodyColor = color.RGBA{
 		R: data[0],
 		G: data[1],
@@ -562,109 +683,172 @@ func readColorDataFromSPIFlash(ctx context.Context, j *Joycon) error {
 	return nil
 }
 
-// TODO: cleanup
-func readStickCalibrationFromSPIFlash(ctx context.Context, j *Joycon) error {
-	// 1. Read user stick calibration data
-	// 2. If user calibration data is all maxed out (i.e. every value is 255), use the factory configuration instead
-	var address uint32
-	if j.IsLeft() {
-		address = spi.LeftStickUserCalibrationSection
-	} else if j.IsRight() {
-		address = spi.RightStickUserCalibrationSection
-	}
+// stickSections are the SPI flash sections used to calibrate a single stick
+type stickSections struct {
+	magic          uint32                        // Section that holds the magic marking the user calibration as set
+	user           uint32                        // User calibration section
+	factory        uint32                        // Factory calibration section
+	parameters     uint32                        // Section that contains the stick device parameters
+	deadzoneOffset uint8                         // Offset of the deadzone from the start of the parameters section
+	unmarshal      func([]byte) StickCalibration // Unmarshals the calibration data, left and right sticks use a different order
+	marshal        func(StickCalibration) []byte // Marshals the calibration data in the same order as unmarshal
+}
 
-	sfc := spi.SPIFlashReadCommand{Address: address, Size: 9}
-	data, err := spi.Read(ctx, j.device, sfc)
-	if err != nil {
-		return err
+var (
+	leftStickSections = stickSections{
+		magic:          spi.LeftStickUserCalibrationMagic,
+		user:           spi.LeftStickUserCalibrationSection,
+		factory:        spi.LeftStickFactoryCalibrationSection,
+		parameters:     spi.LeftStickDeviceParameters,
+		deadzoneOffset: 3,
+		unmarshal:      unmarshalLeftStick,
+		marshal:        marshalLeftStick,
+	}
+	rightStickSections = stickSections{
+		magic:          spi.RightStickUserCalibrationMagic,
+		user:           spi.RightStickUserCalibrationSection,
+		factory:        spi.RightStickFactoryCalibrationSection,
+		parameters:     spi.RightStickDeviceParameters,
+		deadzoneOffset: 3,
+		unmarshal:      unmarshalRightStick,
+		marshal:        marshalRightStick,
+	}
+	// The left stick parameters of a Pro Controller are read along with its 6-axis horizontal offsets
+	proLeftStickSections = stickSections{
+		magic:          spi.LeftStickUserCalibrationMagic,
+		user:           spi.LeftStickUserCalibrationSection,
+		factory:        spi.LeftStickFactoryCalibrationSection,
+		parameters:     spi.ProSensorAndStickDeviceParameters,
+		deadzoneOffset: 9,
+		unmarshal:      unmarshalLeftStick,
+		marshal:        marshalLeftStick,
 	}
+)
 
-	rawStickCalibration := data[0:9]
-	useUserConfiguration := false
-	for _, calibration := range rawStickCalibration {
-		// If the joystick was not calibrated by the user, the entire section will be filled with 255
-		if calibration != 255 {
-			useUserConfiguration = true
-			break
-		}
+// stickSections returns the sections of each stick on j, in the same order as Sticks
+func (j *Joycon) stickSections() ([]stickSections, error) {
+	sections := stickSectionsFor(j.ControllerType)
+	if sections == nil {
+		return nil, fmt.Errorf("unknown joycon product id %d", j.ProductID)
 	}
+	return sections, nil
+}
 
-	// Use factory configuration
-	if !useUserConfiguration {
-		if j.IsLeft() {
-			address = spi.LeftStickFactoryCalibrationSection
-		} else if j.IsRight() {
-			address = spi.RightStickFactoryCalibrationSection
-		}
+// stickSectionsFor returns the sections of each stick on the given type of controller, nil if the type is unknown
+func stickSectionsFor(ct ControllerType) []stickSections {
+	switch ct {
+	case ControllerTypeLeft:
+		return []stickSections{leftStickSections}
+	case ControllerTypeRight:
+		return []stickSections{rightStickSections}
+	case ControllerTypePro:
+		return []stickSections{proLeftStickSections, rightStickSections}
+	default:
+		return nil
+	}
+}
 
-		sfc := spi.SPIFlashReadCommand{Address: address, Size: 9}
-		data, err = spi.Read(ctx, j.device, sfc)
+// readStickCalibrationFromSPIFlash reads the calibration of every stick on j and stores it in j
+func readStickCalibrationFromSPIFlash(ctx context.Context, j *Joycon) error {
+	sections, err := j.stickSections()
+	if err != nil {
+		return err
+	}
+	calibrations := [2]StickCalibration{}
+	for i, s := range sections {
+		calibrations[i], err = readStickCalibration(ctx, j, s)
 		if err != nil {
 			return err
 		}
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.StickCalibration = calibrations[MainStick]
+	j.RightStickCalibration = calibrations[RightStick]
+	return nil
+}
 
-		rawStickCalibration = data[0:9]
+// readStickCalibration reads the calibration of a single stick. The user calibration is used if its magic marks it as
+// set and it's valid, otherwise the factory calibration is. If neither are valid DefaultStickCalibration is used so the
+// stick still works.
+func readStickCalibration(ctx context.Context, j *Joycon, sections stickSections) (StickCalibration, error) {
+	sfc := spi.SPIFlashReadCommand{Address: sections.parameters, Size: sections.deadzoneOffset + 2}
+	data, err := spi.Read(ctx, j.dispatcher, sfc)
+	if err != nil {
+		return StickCalibration{}, err
 	}
+	deadzone := data[sections.deadzoneOffset]
 
-	// TODO: cleanup
-	if j.IsLeft() {
-		address = spi.LeftStickDeviceParameters
-	} else if j.IsRight() {
-		address = spi.RightStickDeviceParameters
-	} else {
-		return fmt.Errorf("unknown joycon product id %d", j.ProductID)
+	// parse returns the calibration in the given section if it's valid
+	parse := func(section uint32, data []byte) (StickCalibration, bool) {
+		sc, err := parseStickCalibration(data, deadzone, sections.unmarshal)
+		if err != nil && !errors.Is(err, errStickCalibrationErased) {
+			log.Printf("Ignoring invalid stick calibration at 0x%04X: %s\n", section, err)
+		}
+		return sc, err == nil
 	}
 
-	sfc = spi.SPIFlashReadCommand{Address: address, Size: 5}
-	data, err = spi.Read(ctx, j.device, sfc)
+	user, set, err := readUserCalibration(ctx, j, sections.magic, 9)
 	if err != nil {
-		return err
+		return StickCalibration{}, err
+	}
+	if set {
+		if sc, ok := parse(sections.user, user); ok {
+			return sc, nil
+		}
 	}
-	deadzone := data[3]
 
-	j.lock.Lock()
-	defer j.lock.Unlock()
+	sfc = spi.SPIFlashReadCommand{Address: sections.factory, Size: 9}
+	data, err = spi.Read(ctx, j.dispatcher, sfc)
+	if err != nil {
+		return StickCalibration{}, err
+	}
+	if sc, ok := parse(sections.factory, data); ok {
+		return sc, nil
+	}
 
-	if j.IsLeft() {
-		lsc := unmarshalLeftStick(rawStickCalibration)
-		j.StickCalibration = lsc
-		j.StickCalibration.Deadzone = deadzone
-	} else if j.IsRight() {
-		rsc := unmarshalRightStick(rawStickCalibration)
-		j.StickCalibration = rsc
-		j.StickCalibration.Deadzone = deadzone
+	log.Printf("%s has no valid stick calibration, using the default calibration\n", j.Name)
+	sc := DefaultStickCalibration
+	if deadzone < sc.Deadzone*2 {
+		sc.Deadzone = deadzone
 	}
+	return sc, nil
+}
 
-	return nil
+// readUserCalibration reads the user calibration section right after the given magic, along with whether the magic
+// marks it as set. The data of a section that isn't set may be stale, so it must not be used.
+func readUserCalibration(ctx context.Context, j *Joycon, magic uint32, size uint8) ([]byte, bool, error) {
+	n := len(spi.UserCalibrationMagic)
+	sfc := spi.SPIFlashReadCommand{Address: magic, Size: uint8(n) + size}
+	data, err := spi.Read(ctx, j.dispatcher, sfc)
+	if err != nil {
+		return nil, false, err
+	}
+	return data[n:], bytes.Equal(data[:n], spi.UserCalibrationMagic), nil
 }
 
+// readAxisCalibration reads the IMU calibration and stores it in j. The user calibration is used if its magic marks it
+// as set, otherwise the factory calibration is.
 func readAxisCalibration(ctx context.Context, j *Joycon) error {
-	// 1. Read user stick calibration data
-	// 2. If user calibration data is all maxed out (i.e. every value is 255), use the factory configuration instead
-	sfc := spi.SPIFlashReadCommand{Address: spi.AxisMotionSensorUserCalibrationSection, Size: 24}
-	data, err := spi.Read(ctx, j.device, sfc)
+	data, set, err := readUserCalibration(ctx, j, spi.AxisMotionSensorUserCalibrationMagic, 24)
 	if err != nil {
 		return err
 	}
 
-	useUserConfiguration := false
-	for _, calibration := range data {
-		// If the joystick was not calibrated by the user, the entire section will be filled with 255
-		if calibration != 255 {
-			useUserConfiguration = true
-			break
-		}
-	}
-
 	// Use factory configuration
-	if !useUserConfiguration {
+	if !set {
 		sfc := spi.SPIFlashReadCommand{Address: spi.AxisMotionSensorFactoryCalibrationSection, Size: 24}
-		data, err = spi.Read(ctx, j.device, sfc)
+		data, err = spi.Read(ctx, j.dispatcher, sfc)
 		if err != nil {
 			return err
 		}
 	}
 
-	// TODO - do some stuff
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.IMUCalibration = unmarshalIMUCalibration(data[0:24])
 	return nil
 }
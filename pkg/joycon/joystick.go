@@ -1,7 +1,8 @@
 package joycon
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"math"
 )
 
@@ -18,6 +19,14 @@ const (
 	StickLowerLeft                       // Joystick is pointing south west
 	StickLeft                            // Joystick is pointing west
 	StickUpperLeft                       // Joystick is pointing north west
+	StickUpUpperRight                    // Joystick is pointing north north east - only used with SixteenWay
+	StickRightUpperRight                 // Joystick is pointing east north east - only used with SixteenWay
+	StickRightLowerRight                 // Joystick is pointing east south east - only used with SixteenWay
+	StickDownLowerRight                  // Joystick is pointing south south east - only used with SixteenWay
+	StickDownLowerLeft                   // Joystick is pointing south south west - only used with SixteenWay
+	StickLeftLowerLeft                   // Joystick is pointing west south west - only used with SixteenWay
+	StickLeftUpperLeft                   // Joystick is pointing west north west - only used with SixteenWay
+	StickUpUpperLeft                     // Joystick is pointing north north west - only used with SixteenWay
 )
 
 func (d StickDirection) String() string {
@@ -38,6 +47,22 @@ func (d StickDirection) String() string {
 		return "Left"
 	case StickUpperLeft:
 		return "Upper Left"
+	case StickUpUpperRight:
+		return "Up Upper Right"
+	case StickRightUpperRight:
+		return "Right Upper Right"
+	case StickRightLowerRight:
+		return "Right Lower Right"
+	case StickDownLowerRight:
+		return "Down Lower Right"
+	case StickDownLowerLeft:
+		return "Down Lower Left"
+	case StickLeftLowerLeft:
+		return "Left Lower Left"
+	case StickLeftUpperLeft:
+		return "Left Upper Left"
+	case StickUpUpperLeft:
+		return "Up Upper Left"
 	case NoStickDirection:
 		return "Center"
 	default:
@@ -45,13 +70,67 @@ func (d StickDirection) String() string {
 	}
 }
 
+// Stick is one of the sticks of a controller
+type Stick byte
+
+const (
+	MainStick  Stick = iota // The stick of a Joycon or the left stick of a Pro Controller (JoystickData)
+	RightStick              // The right stick of a Pro Controller (RightJoystickData)
+)
+
+func (s Stick) String() string {
+	switch s {
+	case MainStick:
+		return "Stick"
+	case RightStick:
+		return "Right Stick"
+	default:
+		return "Invalid"
+	}
+}
+
+// Data returns the data of this stick in the given status
+func (s Stick) Data(js *JoyconStatus) StickData {
+	if s == RightStick {
+		return js.RightJoystickData
+	}
+	return js.JoystickData
+}
+
 // StickData contains the horizontal and vertical values of the joycon
 type StickData struct {
 	Horizontal uint16
 	Vertical   uint16
 	Direction  StickDirection
+	X          float64 // Calibrated horizontal position (-1 to 1) after applying the stick response, right is positive
+	Y          float64 // Calibrated vertical position (-1 to 1) after applying the stick response, up is positive
+	Magnitude  float64 // How far the stick is pushed (0-1)
+	Angle      float64 // Angle of the stick in degrees (0-360), counterclockwise starting from the right
+}
+
+// Limits used to validate stick calibration
+const (
+	maxStickValue      = 0xFFF // Largest 12-bit stick value
+	minStickRange      = 0x100 // Smallest distance from the center to either end of an axis that is plausible
+	minStickCenter     = 0x400 // Smallest plausible center of an axis
+	maxStickCenter     = 0xC00 // Largest plausible center of an axis
+	defaultStickCenter = 0x800
+	defaultStickRange  = 0x600
+)
+
+// DefaultStickCalibration is used when a stick has no valid calibration in its SPI flash
+var DefaultStickCalibration = StickCalibration{
+	XAxisCenter:         defaultStickCenter,
+	XAxisMinBelowCenter: defaultStickRange,
+	XAxisMaxAboveCenter: defaultStickRange,
+	YAxisCenter:         defaultStickCenter,
+	YAxisMinBelowCenter: defaultStickRange,
+	YAxisMaxAboveCenter: defaultStickRange,
+	Deadzone:            0xAE,
 }
 
+// StickCalibration is the center of each stick axis and how far the stick can move to either side of it. Every value
+// is in the same 12-bit units as the raw stick values.
 type StickCalibration struct {
 	XAxisCenter         uint16
 	XAxisMinBelowCenter uint16
@@ -62,6 +141,59 @@ type StickCalibration struct {
 	Deadzone            byte
 }
 
+// Validate returns an error if the calibration can't belong to a working stick, e.g. because the section it was read
+// from is corrupt
+func (sc StickCalibration) Validate() error {
+	axes := []struct {
+		name                 string
+		center, below, above uint16
+	}{
+		{"x", sc.XAxisCenter, sc.XAxisMinBelowCenter, sc.XAxisMaxAboveCenter},
+		{"y", sc.YAxisCenter, sc.YAxisMinBelowCenter, sc.YAxisMaxAboveCenter},
+	}
+	for _, a := range axes {
+		if a.center < minStickCenter || a.center > maxStickCenter {
+			return fmt.Errorf("%s axis center 0x%03X is out of range", a.name, a.center)
+		}
+		if a.below < minStickRange || a.above < minStickRange {
+			return fmt.Errorf("%s axis range (-0x%03X, +0x%03X) is too small", a.name, a.below, a.above)
+		}
+		if int(a.center)-int(a.below) < 0 || int(a.center)+int(a.above) > maxStickValue {
+			return fmt.Errorf("%s axis range (0x%03X-0x%03X, 0x%03X+0x%03X) is out of bounds", a.name, a.center, a.below, a.center, a.above)
+		}
+	}
+	if float64(sc.Deadzone) >= sc.averageRange()/2 {
+		return fmt.Errorf("deadzone 0x%02X covers most of the stick", sc.Deadzone)
+	}
+	return nil
+}
+
+// averageRange returns the average distance from the center to the ends of both axes
+func (sc StickCalibration) averageRange() float64 {
+	return float64(int(sc.XAxisMinBelowCenter)+int(sc.XAxisMaxAboveCenter)+int(sc.YAxisMinBelowCenter)+int(sc.YAxisMaxAboveCenter)) / 4
+}
+
+// errStickCalibrationErased is returned for calibration sections that were never written
+var errStickCalibrationErased = errors.New("stick calibration is erased")
+
+// parseStickCalibration parses the 9 bytes of a stick calibration section and validates the result
+func parseStickCalibration(data []byte, deadzone byte, unmarshal func([]byte) StickCalibration) (StickCalibration, error) {
+	if len(data) < 9 {
+		return StickCalibration{}, fmt.Errorf("stick calibration is too short (%d bytes)", len(data))
+	}
+	// Sections that were never written (e.g. the user never calibrated the stick) are filled with 0xFF
+	if isErased(data[:9]) {
+		return StickCalibration{}, errStickCalibrationErased
+	}
+
+	sc := unmarshal(data[:9])
+	sc.Deadzone = deadzone
+	if err := sc.Validate(); err != nil {
+		return StickCalibration{}, err
+	}
+	return sc, nil
+}
+
 func unmarshalLeftStick(calibration []byte) StickCalibration {
 	sc := StickCalibration{}
 	sc.XAxisMaxAboveCenter = ((uint16(calibration[1]) << 8) & 0xF00) | uint16(calibration[0])
@@ -84,48 +216,140 @@ func unmarshalRightStick(calibration []byte) StickCalibration {
 	return sc
 }
 
-func calculateStickDirection(sd StickData, sc StickCalibration) StickDirection {
-	stick_x_min := sc.XAxisCenter - sc.XAxisMinBelowCenter
-	stick_x_max := sc.XAxisCenter + sc.XAxisMaxAboveCenter
-	stick_y_min := sc.YAxisCenter - sc.YAxisMinBelowCenter
-	stick_y_max := sc.YAxisCenter + sc.YAxisMaxAboveCenter
+func marshalLeftStick(sc StickCalibration) []byte {
+	data := packStickValues(sc.XAxisMaxAboveCenter, sc.YAxisMaxAboveCenter)
+	data = append(data, packStickValues(sc.XAxisCenter, sc.YAxisCenter)...)
+	return append(data, packStickValues(sc.XAxisMinBelowCenter, sc.YAxisMinBelowCenter)...)
+}
+
+func marshalRightStick(sc StickCalibration) []byte {
+	data := packStickValues(sc.XAxisCenter, sc.YAxisCenter)
+	data = append(data, packStickValues(sc.XAxisMinBelowCenter, sc.YAxisMinBelowCenter)...)
+	return append(data, packStickValues(sc.XAxisMaxAboveCenter, sc.YAxisMaxAboveCenter)...)
+}
+
+// packStickValues packs two 12-bit values into 3 bytes, the same way they're packed in input reports and SPI flash
+func packStickValues(x uint16, y uint16) []byte {
+	return []byte{byte(x & 0xFF), byte((x>>8)&0x0F) | byte((y&0x0F)<<4), byte(y >> 4)}
+}
+
+// calibrateStick sets the calibrated position, magnitude, angle, and direction of the raw stick values in sd
+func calibrateStick(sd StickData, sc StickCalibration, r StickResponse) StickData {
+	x, y, deadzone := normalizeStick(sd, sc)
+	sd.X, sd.Y = r.apply(x, y, deadzone)
+	sd.Magnitude = math.Min(math.Hypot(sd.X, sd.Y), 1)
+	sd.Angle = 0
+	if sd.Magnitude > 0 {
+		sd.Angle = radiansToDegrees(math.Atan2(sd.Y, sd.X))
+		if sd.Angle < 0 {
+			sd.Angle += 360
+		}
+	}
+	sd.Direction = r.direction(sd, InvalidStickDirection)
+	return sd
+}
+
+// normalizeStick returns the position of the stick from -1 to 1 on each axis and the deadzone from the calibration
+// in the same units. Each side of an axis is scaled by its own calibrated range, since the center of a stick is rarely
+// in the middle of its range.
+func normalizeStick(sd StickData, sc StickCalibration) (float64, float64, float64) {
+	axis := func(v uint16, center uint16, below uint16, above uint16) float64 {
+		offset := float64(v) - float64(center)
+		if offset < 0 && below > 0 {
+			return clamp(offset / float64(below))
+		} else if offset > 0 && above > 0 {
+			return clamp(offset / float64(above))
+		}
+		return 0
+	}
+
+	x := axis(sd.Horizontal, sc.XAxisCenter, sc.XAxisMinBelowCenter, sc.XAxisMaxAboveCenter)
+	y := axis(sd.Vertical, sc.YAxisCenter, sc.YAxisMinBelowCenter, sc.YAxisMaxAboveCenter)
+
+	deadzone := 0.0
+	if r := sc.averageRange(); r > 0 {
+		deadzone = float64(sc.Deadzone) / r
+	}
+	return x, y, deadzone
+}
+
+// DirectionSectors is the number of directions a stick can point in
+type DirectionSectors int
+
+const (
+	FourWay    DirectionSectors = 4  // Up, right, down, and left
+	EightWay   DirectionSectors = 8  // Cardinal and diagonal directions, cardinal directions are twice as wide
+	SixteenWay DirectionSectors = 16 // Every direction, all of the same width
+)
+
+// sector is the range of stick angles (in degrees) that point in a direction
+type sector struct {
+	direction StickDirection
+	center    float64
+	halfWidth float64
+}
+
+var (
+	fourWaySectors = []sector{
+		{StickRight, 0, 45}, {StickUp, 90, 45}, {StickLeft, 180, 45}, {StickDown, 270, 45},
+	}
+	eightWaySectors = []sector{
+		{StickRight, 0, 30}, {StickUpperRight, 45, 15}, {StickUp, 90, 30}, {StickUpperLeft, 135, 15},
+		{StickLeft, 180, 30}, {StickLowerLeft, 225, 15}, {StickDown, 270, 30}, {StickLowerRight, 315, 15},
+	}
+	sixteenWaySectors = []sector{
+		{StickRight, 0, 11.25}, {StickRightUpperRight, 22.5, 11.25}, {StickUpperRight, 45, 11.25},
+		{StickUpUpperRight, 67.5, 11.25}, {StickUp, 90, 11.25}, {StickUpUpperLeft, 112.5, 11.25},
+		{StickUpperLeft, 135, 11.25}, {StickLeftUpperLeft, 157.5, 11.25}, {StickLeft, 180, 11.25},
+		{StickLeftLowerLeft, 202.5, 11.25}, {StickLowerLeft, 225, 11.25}, {StickDownLowerLeft, 247.5, 11.25},
+		{StickDown, 270, 11.25}, {StickDownLowerRight, 292.5, 11.25}, {StickLowerRight, 315, 11.25},
+		{StickRightLowerRight, 337.5, 11.25},
+	}
+)
 
-	stick_x_center := float64((stick_x_min + stick_x_max) / 2)
-	stick_y_center := float64((stick_y_min + stick_y_max) / 2)
+// sectors returns the sectors for the given number of directions, anything unsupported uses eight directions
+func (n DirectionSectors) sectors() []sector {
+	switch n {
+	case FourWay:
+		return fourWaySectors
+	case SixteenWay:
+		return sixteenWaySectors
+	default:
+		return eightWaySectors
+	}
+}
 
-	// Determine if stick magnitude is within deadzone and return no direction if so
-	if math.Pow((float64(sd.Horizontal)-stick_x_center), 2)+math.Pow((float64(sd.Vertical)-stick_y_center), 2) < math.Pow(float64(sc.Deadzone), 2) {
+// direction returns the direction a calibrated stick is pointing in. The previous direction is kept while the stick is
+// within the response's hysteresis of its sector, so the direction doesn't flicker when the stick sits on an edge.
+func (r StickResponse) direction(sd StickData, previous StickDirection) StickDirection {
+	if sd.Magnitude <= 0 || math.IsNaN(sd.Angle) {
 		return NoStickDirection
 	}
 
-	x := clamp((float64(sd.Horizontal) - stick_x_center) / (stick_x_center - 1))
-	y := clamp((float64(sd.Vertical) - stick_y_center) / (stick_y_center - 1))
-
-	stickDegrees := radiansToDegrees(math.Atan2(y, x))
-	if stickDegrees < 0 {
-		stickDegrees += 360
-	}
-
-	if stickDegrees > 60 && stickDegrees < 120 {
-		return StickUp
-	} else if stickDegrees <= 60 && stickDegrees >= 30 {
-		return StickUpperRight
-	} else if (stickDegrees >= 0 && stickDegrees < 30) || stickDegrees > 330 {
-		return StickRight
-	} else if stickDegrees >= 300 && stickDegrees <= 330 {
-		return StickLowerRight
-	} else if stickDegrees > 240 && stickDegrees < 300 {
-		return StickDown
-	} else if stickDegrees >= 210 && stickDegrees <= 240 {
-		return StickLowerLeft
-	} else if stickDegrees > 150 && stickDegrees < 210 {
-		return StickLeft
-	} else if stickDegrees >= 120 && stickDegrees <= 150 {
-		return StickUpperLeft
-	} else {
-		log.Printf("Unknown direction!!! Angle: %f", stickDegrees)
-		return InvalidStickDirection
+	sectors := r.Sectors.sectors()
+	for _, s := range sectors {
+		if s.direction == previous && angleBetween(sd.Angle, s.center) < s.halfWidth+r.Hysteresis {
+			return previous
+		}
+	}
+
+	// Sectors cover the whole circle, so the closest sector is the one the stick is in
+	closest := sectors[0]
+	for _, s := range sectors[1:] {
+		if angleBetween(sd.Angle, s.center)-s.halfWidth < angleBetween(sd.Angle, closest.center)-closest.halfWidth {
+			closest = s
+		}
+	}
+	return closest.direction
+}
+
+// angleBetween returns the smallest difference between two angles in degrees (0-180)
+func angleBetween(a float64, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	if d > 180 {
+		d = 360 - d
 	}
+	return d
 }
 
 func clamp(v float64) float64 {
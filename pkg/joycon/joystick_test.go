@@ -0,0 +1,239 @@
+package joycon
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// Stick calibration sections as they are stored in SPI flash
+var (
+	leftStickDump  = []byte{0xBA, 0xF5, 0x62, 0x6F, 0xC8, 0x77, 0xED, 0x95, 0x5B}
+	rightStickDump = []byte{0x16, 0xD8, 0x7D, 0xF2, 0xB5, 0x5F, 0x86, 0x65, 0x5E}
+	erasedDump     = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	// Center of 0x050 with 0x5ED below it, which underflows when calculated with uint16
+	underflowDump = []byte{0xBA, 0xF5, 0x62, 0x50, 0x00, 0x05, 0xED, 0x95, 0x5B}
+)
+
+const dumpDeadzone = 0xAE
+
+var leftStickCalibration = StickCalibration{
+	XAxisCenter:         0x86F,
+	XAxisMinBelowCenter: 0x5ED,
+	XAxisMaxAboveCenter: 0x5BA,
+	YAxisCenter:         0x77C,
+	YAxisMinBelowCenter: 0x5B9,
+	YAxisMaxAboveCenter: 0x62F,
+	Deadzone:            dumpDeadzone,
+}
+
+func TestParseStickCalibration(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		deadzone  byte
+		unmarshal func([]byte) StickCalibration
+		want      StickCalibration
+		wantErr   bool
+	}{
+		{
+			name:      "left stick",
+			data:      leftStickDump,
+			deadzone:  dumpDeadzone,
+			unmarshal: unmarshalLeftStick,
+			want:      leftStickCalibration,
+		},
+		{
+			name:      "right stick",
+			data:      rightStickDump,
+			deadzone:  dumpDeadzone,
+			unmarshal: unmarshalRightStick,
+			want: StickCalibration{
+				XAxisCenter:         0x816,
+				XAxisMinBelowCenter: 0x5F2,
+				XAxisMaxAboveCenter: 0x586,
+				YAxisCenter:         0x7DD,
+				YAxisMinBelowCenter: 0x5FB,
+				YAxisMaxAboveCenter: 0x5E6,
+				Deadzone:            dumpDeadzone,
+			},
+		},
+		{name: "erased", data: erasedDump, deadzone: dumpDeadzone, unmarshal: unmarshalLeftStick, wantErr: true},
+		{name: "zeroed", data: make([]byte, 9), deadzone: dumpDeadzone, unmarshal: unmarshalLeftStick, wantErr: true},
+		{name: "underflow", data: underflowDump, deadzone: dumpDeadzone, unmarshal: unmarshalLeftStick, wantErr: true},
+		{name: "too short", data: leftStickDump[:8], deadzone: dumpDeadzone, unmarshal: unmarshalLeftStick, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStickCalibration(tt.data, tt.deadzone, tt.unmarshal)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStickCalibrationValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(sc *StickCalibration)
+		wantErr bool
+	}{
+		{"valid", func(sc *StickCalibration) {}, false},
+		{"center too low", func(sc *StickCalibration) { sc.XAxisCenter = 0x100 }, true},
+		{"center too high", func(sc *StickCalibration) { sc.YAxisCenter = 0xF00 }, true},
+		{"range too small", func(sc *StickCalibration) { sc.YAxisMaxAboveCenter = 0x10 }, true},
+		{"range below zero", func(sc *StickCalibration) { sc.XAxisMinBelowCenter = 0x900 }, true},
+		{"range above max", func(sc *StickCalibration) { sc.XAxisMaxAboveCenter = 0x800 }, true},
+		{"deadzone covers the stick", func(sc *StickCalibration) {
+			sc.XAxisMinBelowCenter, sc.XAxisMaxAboveCenter = 0x180, 0x180
+			sc.YAxisMinBelowCenter, sc.YAxisMaxAboveCenter = 0x180, 0x180
+			sc.Deadzone = 0xFF
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := leftStickCalibration
+			tt.modify(&sc)
+			if err := sc.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseStickCalibrationErased(t *testing.T) {
+	_, err := parseStickCalibration(erasedDump, dumpDeadzone, unmarshalLeftStick)
+	if !errors.Is(err, errStickCalibrationErased) {
+		t.Errorf("got %v, want %v", err, errStickCalibrationErased)
+	}
+}
+
+func TestNormalizeStick(t *testing.T) {
+	sc := leftStickCalibration
+	tests := []struct {
+		name       string
+		horizontal uint16
+		vertical   uint16
+		wantX      float64
+		wantY      float64
+	}{
+		{"center", sc.XAxisCenter, sc.YAxisCenter, 0, 0},
+		{"right", sc.XAxisCenter + sc.XAxisMaxAboveCenter, sc.YAxisCenter, 1, 0},
+		{"left", sc.XAxisCenter - sc.XAxisMinBelowCenter, sc.YAxisCenter, -1, 0},
+		{"up", sc.XAxisCenter, sc.YAxisCenter + sc.YAxisMaxAboveCenter, 0, 1},
+		{"down", sc.XAxisCenter, sc.YAxisCenter - sc.YAxisMinBelowCenter, 0, -1},
+		{"half right", sc.XAxisCenter + sc.XAxisMaxAboveCenter/2, sc.YAxisCenter, 0.5, 0},
+		{"past the calibrated range", 0xFFF, 0, 1, -1},
+		{"minimum values", 0, 0, -1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, y, _ := normalizeStick(StickData{Horizontal: tt.horizontal, Vertical: tt.vertical}, sc)
+			if math.Abs(x-tt.wantX) > 0.001 || math.Abs(y-tt.wantY) > 0.001 {
+				t.Errorf("got (%f, %f), want (%f, %f)", x, y, tt.wantX, tt.wantY)
+			}
+		})
+	}
+}
+
+func TestStickDirection(t *testing.T) {
+	tests := []struct {
+		name     string
+		sectors  DirectionSectors
+		angle    float64
+		previous StickDirection
+		want     StickDirection
+	}{
+		{"four way right", FourWay, 10, InvalidStickDirection, StickRight},
+		{"four way diagonal", FourWay, 50, InvalidStickDirection, StickUp},
+		{"four way wraps around", FourWay, 350, InvalidStickDirection, StickRight},
+		{"eight way up", EightWay, 90, InvalidStickDirection, StickUp},
+		{"eight way wide cardinal", EightWay, 115, InvalidStickDirection, StickUp},
+		{"eight way diagonal", EightWay, 135, InvalidStickDirection, StickUpperLeft},
+		{"eight way lower right", EightWay, 320, InvalidStickDirection, StickLowerRight},
+		{"sixteen way", SixteenWay, 67.5, InvalidStickDirection, StickUpUpperRight},
+		{"sixteen way wraps around", SixteenWay, 355, InvalidStickDirection, StickRight},
+		{"hysteresis keeps previous direction", EightWay, 62, StickUpperRight, StickUpperRight},
+		{"hysteresis is exceeded", EightWay, 70, StickUpperRight, StickUp},
+		{"hysteresis wraps around", FourWay, 40, StickRight, StickRight},
+		{"previous direction not in sectors", FourWay, 45.5, StickUpperRight, StickUp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := StickResponse{Sectors: tt.sectors, Hysteresis: 10}
+			got := r.direction(StickData{Magnitude: 1, Angle: tt.angle}, tt.previous)
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStickDirectionCentered(t *testing.T) {
+	got := DefaultStickResponse.direction(StickData{Magnitude: 0, Angle: 90}, StickUp)
+	if got != NoStickDirection {
+		t.Errorf("got %s, want %s", got, NoStickDirection)
+	}
+}
+
+func FuzzStickCalibration(f *testing.F) {
+	for _, dump := range [][]byte{leftStickDump, rightStickDump, erasedDump, underflowDump} {
+		f.Add(dump, byte(dumpDeadzone), uint16(0x800), uint16(0x800))
+		f.Add(dump, byte(dumpDeadzone), uint16(0), uint16(0xFFF))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, deadzone byte, horizontal uint16, vertical uint16) {
+		sc, err := parseStickCalibration(data, deadzone, unmarshalLeftStick)
+		if err != nil {
+			return
+		}
+		if err := sc.Validate(); err != nil {
+			t.Fatalf("parsed calibration is invalid: %s", err)
+		}
+
+		sd := StickData{Horizontal: horizontal & maxStickValue, Vertical: vertical & maxStickValue}
+		x, y, dz := normalizeStick(sd, sc)
+		for _, v := range []float64{x, y} {
+			if math.IsNaN(v) || v < -1 || v > 1 {
+				t.Fatalf("normalized value %f is out of range", v)
+			}
+		}
+		if math.IsNaN(dz) || dz < 0 || dz >= 1 {
+			t.Fatalf("normalized deadzone %f is out of range", dz)
+		}
+
+		for _, sectors := range []DirectionSectors{FourWay, EightWay, SixteenWay} {
+			r := DefaultStickResponse
+			r.Sectors = sectors
+			got := calibrateStick(sd, sc, r)
+			if math.IsNaN(got.Magnitude) || got.Magnitude < 0 || got.Magnitude > 1 {
+				t.Fatalf("magnitude %f is out of range", got.Magnitude)
+			}
+			if got.Angle < 0 || got.Angle >= 360 {
+				t.Fatalf("angle %f is out of range", got.Angle)
+			}
+
+			valid := got.Direction == NoStickDirection
+			for _, s := range sectors.sectors() {
+				valid = valid || got.Direction == s.direction
+			}
+			if !valid {
+				t.Fatalf("direction %s is not one of the %d directions", got.Direction, sectors)
+			}
+		}
+	})
+}
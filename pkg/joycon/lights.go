@@ -0,0 +1,165 @@
+package joycon
+
+import (
+	"context"
+	"fmt"
+
+	"joyku/internal/subcommand"
+)
+
+// PlayerLights is the state of the four player LEDs. The low four bits turn LEDs on and the high four bits flash them,
+// a flashing LED takes priority over one that is on.
+type PlayerLights byte
+
+// Player LEDs from top to bottom (on the right Joycon) or left to right (on the left Joycon)
+const (
+	PlayerLight1 PlayerLights = 1 << iota
+	PlayerLight2
+	PlayerLight3
+	PlayerLight4
+)
+
+// PlayerLightsOff turns every player LED off
+const PlayerLightsOff PlayerLights = 0
+
+// playerPatterns are the LED patterns used by the Switch for players 1 through 8
+var playerPatterns = []PlayerLights{
+	PlayerLight1,
+	PlayerLight1 | PlayerLight2,
+	PlayerLight1 | PlayerLight2 | PlayerLight3,
+	PlayerLight1 | PlayerLight2 | PlayerLight3 | PlayerLight4,
+	PlayerLight1 | PlayerLight4,
+	PlayerLight1 | PlayerLight3,
+	PlayerLight1 | PlayerLight3 | PlayerLight4,
+	PlayerLight2 | PlayerLight3,
+}
+
+// PlayerLightsFor returns the LED pattern the Switch uses for the given player number (1-8). Numbers above 8 wrap.
+func PlayerLightsFor(player int) PlayerLights {
+	if player < 1 {
+		return PlayerLightsOff
+	}
+	return playerPatterns[(player-1)%len(playerPatterns)]
+}
+
+// Flashing returns the same LEDs set to flash instead of staying on
+func (p PlayerLights) Flashing() PlayerLights {
+	return ((p | p>>4) & 0x0F) << 4
+}
+
+// SetPlayerLights sets the player LEDs to the given pattern, it's set again whenever the Joycon reconnects
+func (j *Joycon) SetPlayerLights(pattern PlayerLights) error {
+	dp, err := j.connectedDispatcher()
+	if err != nil {
+		return err
+	}
+	if _, err = dp.Request(context.Background(), subcommand.SetPlayerLights, []byte{byte(pattern)}); err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.playerLights = pattern
+	return nil
+}
+
+// Limits of the HOME light
+const (
+	MaxHomeLightCycles = 15 // Max number of mini cycles in a HOME light pattern
+	MaxHomeLightValue  = 15 // Max value of every HOME light setting (intensity, durations, and repeats)
+)
+
+// HomeLightCycle is a single step (mini cycle) of a HOME light pattern. Durations are multiples of the pattern's step.
+type HomeLightCycle struct {
+	Intensity uint8 // Brightness the LED fades to (0-15)
+	Fade      uint8 // Number of steps spent fading to the intensity (0-15)
+	Hold      uint8 // Number of steps the intensity is held for once reached (0-15)
+}
+
+// HomeLight is a pattern for the LED ring around the HOME button. Only the right Joycon and Pro Controller have one.
+type HomeLight struct {
+	Step           uint8            // Duration of a single step, from 1 (8ms) to 15 (175ms) - 0 turns the light off
+	StartIntensity uint8            // Brightness of the LED before the first cycle (0-15)
+	Repeat         uint8            // Number of times the cycles are played, 0 repeats them forever
+	Cycles         []HomeLightCycle // Cycles played in order, up to 15
+}
+
+// Built-in HOME light patterns
+var (
+	// HomeLightOff turns the HOME light off
+	HomeLightOff = HomeLight{}
+	// HomeLightOn keeps the HOME light on at full brightness
+	HomeLightOn = HomeLight{
+		Step:           1,
+		StartIntensity: MaxHomeLightValue,
+		Cycles:         []HomeLightCycle{{Intensity: MaxHomeLightValue, Fade: 1, Hold: 1}},
+	}
+	// HomeLightPulse slowly fades the HOME light in and out until it is changed
+	HomeLightPulse = HomeLight{
+		Step: 8,
+		Cycles: []HomeLightCycle{
+			{Intensity: MaxHomeLightValue, Fade: 8, Hold: 2},
+			{Intensity: 0, Fade: 8, Hold: 2},
+		},
+	}
+	// HomeLightBlink quickly blinks the HOME light three times
+	HomeLightBlink = HomeLight{
+		Step:   2,
+		Repeat: 3,
+		Cycles: []HomeLightCycle{
+			{Intensity: MaxHomeLightValue, Fade: 0, Hold: 8},
+			{Intensity: 0, Fade: 0, Hold: 8},
+		},
+	}
+)
+
+// encode returns the data sent with the HOME light subcommand (0x38)
+// https://github.com/dekuNukem/Nintendo_Switch_Reverse_Engineering/blob/master/bluetooth_hid_subcommands_notes.md
+func (h HomeLight) encode() ([]byte, error) {
+	if len(h.Cycles) > MaxHomeLightCycles {
+		return nil, fmt.Errorf("home light has %d cycles, max is %d", len(h.Cycles), MaxHomeLightCycles)
+	}
+	values := []uint8{h.Step, h.StartIntensity, h.Repeat}
+	for _, c := range h.Cycles {
+		values = append(values, c.Intensity, c.Fade, c.Hold)
+	}
+	for _, v := range values {
+		if v > MaxHomeLightValue {
+			return nil, fmt.Errorf("home light value %d is out of range, max is %d", v, MaxHomeLightValue)
+		}
+	}
+
+	// Two cycles are packed into every three bytes: both intensities, then the durations of each cycle
+	data := make([]byte, 2+(len(h.Cycles)+1)/2*3)
+	data[0] = byte(len(h.Cycles))<<4 | h.Step
+	data[1] = h.StartIntensity<<4 | h.Repeat
+	for i, c := range h.Cycles {
+		offset := 2 + i/2*3
+		if i%2 == 0 {
+			data[offset] |= c.Intensity << 4
+			data[offset+1] = c.Fade<<4 | c.Hold
+		} else {
+			data[offset] |= c.Intensity
+			data[offset+2] = c.Fade<<4 | c.Hold
+		}
+	}
+	return data, nil
+}
+
+// SetHomeLight plays the given pattern on the HOME light
+func (j *Joycon) SetHomeLight(light HomeLight) error {
+	if j.IsLeft() {
+		return fmt.Errorf("%s does not have a home light", j.Name)
+	}
+
+	data, err := light.encode()
+	if err != nil {
+		return err
+	}
+	dp, err := j.connectedDispatcher()
+	if err != nil {
+		return err
+	}
+	_, err = dp.Request(context.Background(), subcommand.SetHomeLight, data)
+	return err
+}
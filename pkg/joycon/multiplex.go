@@ -25,8 +25,8 @@ func NewMultiplexer() *FOFIMultiplexer {
 }
 
 // Join adds a new stream of Joycon status packets to the output stream
-func (m *FOFIMultiplexer) Join(jc *Joycon) {
-	m.in <- jc.Status()
+func (m *FOFIMultiplexer) Join(c Controller) {
+	m.in <- c.Status()
 }
 
 // Output returns the output channel that all input streams have been joined together to output to.
@@ -0,0 +1,222 @@
+package joycon
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFilterBeta = 0.1 // Default Madgwick filter gain - higher values trust the accelerometer more
+
+	biasGyroThreshold  = 4.0  // Max angular velocity (deg/s) on any axis for the Joycon to be considered at rest
+	biasAccelTolerance = 0.05 // Max difference (G) between the acceleration magnitude and 1G for the Joycon to be considered at rest
+	biasSettleSamples  = 200  // Number of consecutive resting samples (~1 second) before a bias estimate is made
+	biasSmoothing      = 0.01 // Weight given to new resting samples once a bias estimate has been made
+
+	maxSampleDelta = 100 * time.Millisecond // Larger gaps between samples are treated as a single sample interval
+)
+
+// Quaternion represents a rotation in 3D space
+type Quaternion struct {
+	W float64
+	X float64
+	Y float64
+	Z float64
+}
+
+// IdentityQuaternion is the quaternion representing no rotation
+var IdentityQuaternion = Quaternion{W: 1}
+
+func (q Quaternion) normalize() Quaternion {
+	norm := math.Sqrt(q.W*q.W + q.X*q.X + q.Y*q.Y + q.Z*q.Z)
+	if norm == 0 {
+		return IdentityQuaternion
+	}
+	return Quaternion{W: q.W / norm, X: q.X / norm, Y: q.Y / norm, Z: q.Z / norm}
+}
+
+// Euler returns the pitch, roll, and yaw angles (in degrees) of this rotation
+func (q Quaternion) Euler() (pitch float64, roll float64, yaw float64) {
+	roll = math.Atan2(2*(q.W*q.X+q.Y*q.Z), 1-2*(q.X*q.X+q.Y*q.Y))
+	pitch = math.Asin(clamp(2 * (q.W*q.Y - q.Z*q.X)))
+	yaw = math.Atan2(2*(q.W*q.Z+q.X*q.Y), 1-2*(q.Y*q.Y+q.Z*q.Z))
+	return radiansToDegrees(pitch), radiansToDegrees(roll), radiansToDegrees(yaw)
+}
+
+// Orientation is the estimated orientation of a Joycon
+type Orientation struct {
+	Quaternion Quaternion // Rotation of the Joycon relative to where the filter was started or last reset
+	Pitch      float64    // Rotation around the Y axis in degrees
+	Roll       float64    // Rotation around the X axis in degrees
+	Yaw        float64    // Rotation around the Z axis in degrees - this will drift slowly over time
+	GyroBias   AxisData   // Current gyroscope bias estimate in degrees per second
+	Calibrated bool       // If a gyroscope bias estimate has been made
+}
+
+// OrientationFilter fuses accelerometer and gyroscope samples into an orientation estimate using a Madgwick filter.
+//
+// The gyroscope bias is estimated whenever the Joycon is resting (e.g. on a table) and subtracted from each sample
+// before it is integrated, which greatly reduces drift.
+type OrientationFilter struct {
+	Beta float64 // Filter gain
+
+	q           Quaternion
+	last        time.Time
+	bias        AxisData
+	calibrated  bool
+	restSum     AxisData
+	restSamples int
+	lock        sync.Mutex
+}
+
+// NewOrientationFilter returns a filter with the default gain that starts with no rotation
+func NewOrientationFilter() *OrientationFilter {
+	return &OrientationFilter{
+		Beta: defaultFilterBeta,
+		q:    IdentityQuaternion,
+	}
+}
+
+// Reset resets the orientation to no rotation. The gyroscope bias estimate is kept.
+func (f *OrientationFilter) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.q = IdentityQuaternion
+	f.last = time.Time{}
+}
+
+// Orientation returns the current orientation estimate
+func (f *OrientationFilter) Orientation() Orientation {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.orientation()
+}
+
+// Update fuses the given sample into the orientation estimate and returns the new estimate
+func (f *OrientationFilter) Update(s IMUSample) Orientation {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	dt := imuSampleInterval.Seconds()
+	if !f.last.IsZero() {
+		if delta := s.Timestamp.Sub(f.last); delta > 0 && delta <= maxSampleDelta {
+			dt = delta.Seconds()
+		}
+	}
+	f.last = s.Timestamp
+
+	f.estimateBias(s)
+
+	gx := degreesToRadians(s.GyroscopeData.X - f.bias.X)
+	gy := degreesToRadians(s.GyroscopeData.Y - f.bias.Y)
+	gz := degreesToRadians(s.GyroscopeData.Z - f.bias.Z)
+	f.q = madgwickUpdate(f.q, gx, gy, gz, s.Acceleration, f.Beta, dt)
+	return f.orientation()
+}
+
+func (f *OrientationFilter) orientation() Orientation {
+	pitch, roll, yaw := f.q.Euler()
+	return Orientation{
+		Quaternion: f.q,
+		Pitch:      pitch,
+		Roll:       roll,
+		Yaw:        yaw,
+		GyroBias:   f.bias,
+		Calibrated: f.calibrated,
+	}
+}
+
+// estimateBias updates the gyroscope bias estimate if the Joycon is at rest
+func (f *OrientationFilter) estimateBias(s IMUSample) {
+	g := s.GyroscopeData
+	a := s.Acceleration
+	accelMagnitude := math.Sqrt(a.X*a.X + a.Y*a.Y + a.Z*a.Z)
+	resting := math.Abs(g.X-f.bias.X) < biasGyroThreshold &&
+		math.Abs(g.Y-f.bias.Y) < biasGyroThreshold &&
+		math.Abs(g.Z-f.bias.Z) < biasGyroThreshold &&
+		math.Abs(accelMagnitude-1) < biasAccelTolerance
+
+	if !resting {
+		f.restSum = AxisData{}
+		f.restSamples = 0
+		return
+	}
+
+	if f.restSamples < biasSettleSamples {
+		f.restSum.X += g.X
+		f.restSum.Y += g.Y
+		f.restSum.Z += g.Z
+		f.restSamples += 1
+		if f.restSamples == biasSettleSamples && !f.calibrated {
+			n := float64(biasSettleSamples)
+			f.bias = AxisData{X: f.restSum.X / n, Y: f.restSum.Y / n, Z: f.restSum.Z / n}
+			f.calibrated = true
+		}
+		return
+	}
+
+	// Keep refining the estimate for as long as the Joycon stays at rest
+	f.bias.X += (g.X - f.bias.X) * biasSmoothing
+	f.bias.Y += (g.Y - f.bias.Y) * biasSmoothing
+	f.bias.Z += (g.Z - f.bias.Z) * biasSmoothing
+}
+
+// madgwickUpdate performs a single step of the IMU (6-axis) Madgwick filter. Angular velocity is in radians per second.
+// See: https://x-io.co.uk/open-source-imu-and-ahrs-algorithms/
+func madgwickUpdate(q Quaternion, gx, gy, gz float64, accel AxisData, beta float64, dt float64) Quaternion {
+	q0, q1, q2, q3 := q.W, q.X, q.Y, q.Z
+
+	// Rate of change of quaternion from gyroscope
+	qDot1 := 0.5 * (-q1*gx - q2*gy - q3*gz)
+	qDot2 := 0.5 * (q0*gx + q2*gz - q3*gy)
+	qDot3 := 0.5 * (q0*gy - q1*gz + q3*gx)
+	qDot4 := 0.5 * (q0*gz + q1*gy - q2*gx)
+
+	// Only apply the accelerometer correction if there is a valid measurement
+	norm := math.Sqrt(accel.X*accel.X + accel.Y*accel.Y + accel.Z*accel.Z)
+	if norm > 0 {
+		ax, ay, az := accel.X/norm, accel.Y/norm, accel.Z/norm
+
+		_2q0 := 2 * q0
+		_2q1 := 2 * q1
+		_2q2 := 2 * q2
+		_2q3 := 2 * q3
+		_4q0 := 4 * q0
+		_4q1 := 4 * q1
+		_4q2 := 4 * q2
+		_8q1 := 8 * q1
+		_8q2 := 8 * q2
+		q0q0 := q0 * q0
+		q1q1 := q1 * q1
+		q2q2 := q2 * q2
+		q3q3 := q3 * q3
+
+		// Gradient descent corrective step
+		s0 := _4q0*q2q2 + _2q2*ax + _4q0*q1q1 - _2q1*ay
+		s1 := _4q1*q3q3 - _2q3*ax + 4*q0q0*q1 - _2q0*ay - _4q1 + _8q1*q1q1 + _8q1*q2q2 + _4q1*az
+		s2 := 4*q0q0*q2 + _2q0*ax + _4q2*q3q3 - _2q3*ay - _4q2 + _8q2*q1q1 + _8q2*q2q2 + _4q2*az
+		s3 := 4*q1q1*q3 - _2q1*ax + 4*q2q2*q3 - _2q2*ay
+
+		sNorm := math.Sqrt(s0*s0 + s1*s1 + s2*s2 + s3*s3)
+		if sNorm > 0 {
+			qDot1 -= beta * (s0 / sNorm)
+			qDot2 -= beta * (s1 / sNorm)
+			qDot3 -= beta * (s2 / sNorm)
+			qDot4 -= beta * (s3 / sNorm)
+		}
+	}
+
+	return Quaternion{
+		W: q0 + qDot1*dt,
+		X: q1 + qDot2*dt,
+		Y: q2 + qDot3*dt,
+		Z: q3 + qDot4*dt,
+	}.normalize()
+}
+
+func degreesToRadians(degrees float64) float64 {
+	return (degrees * math.Pi) / 180
+}
@@ -0,0 +1,93 @@
+package joycon
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// restingSamples returns n samples taken at the IMU sample rate with the same acceleration and angular velocity
+func restingSamples(n int, accel AxisData, gyro AxisData) []IMUSample {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := make([]IMUSample, n)
+	for i := range samples {
+		samples[i] = IMUSample{
+			Timestamp:     start.Add(time.Duration(i) * imuSampleInterval),
+			Acceleration:  accel,
+			GyroscopeData: gyro,
+		}
+	}
+	return samples
+}
+
+func TestOrientationFollowsGravity(t *testing.T) {
+	tilt := func(degrees float64) (float64, float64) {
+		return math.Sin(degreesToRadians(degrees)), math.Cos(degreesToRadians(degrees))
+	}
+	sin20, cos20 := tilt(20)
+	sin35, cos35 := tilt(35)
+
+	tests := []struct {
+		name      string
+		accel     AxisData
+		wantPitch float64
+		wantRoll  float64
+	}{
+		{name: "flat", accel: AxisData{Z: 1}},
+		{name: "rolled", accel: AxisData{Y: sin20, Z: cos20}, wantRoll: 20},
+		{name: "rolled the other way", accel: AxisData{Y: -sin35, Z: cos35}, wantRoll: -35},
+		{name: "pitched", accel: AxisData{X: sin20, Z: cos20}, wantPitch: -20},
+		{name: "pitched the other way", accel: AxisData{X: -sin35, Z: cos35}, wantPitch: 35},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewOrientationFilter()
+			// The filter starts flat, so it needs a few seconds to settle on a tilt
+			for i, s := range restingSamples(2000, tt.accel, AxisData{}) {
+				o := f.Update(s)
+				if i < 1500 {
+					continue
+				}
+				if math.Abs(o.Pitch-tt.wantPitch) > 0.5 || math.Abs(o.Roll-tt.wantRoll) > 0.5 {
+					t.Fatalf("sample %d: got pitch %.2f and roll %.2f, want %.2f and %.2f",
+						i, o.Pitch, o.Roll, tt.wantPitch, tt.wantRoll)
+				}
+				if math.Abs(o.Yaw) > 0.01 {
+					t.Fatalf("sample %d: yaw drifted to %.2f without any rotation", i, o.Yaw)
+				}
+			}
+		})
+	}
+}
+
+func TestOrientationEstimatesGyroBias(t *testing.T) {
+	bias := AxisData{X: 1.5, Y: -0.8, Z: 0.5}
+	samples := restingSamples(biasSettleSamples+400, AxisData{Z: 1}, bias)
+	f := NewOrientationFilter()
+
+	var o Orientation
+	for _, s := range samples[:biasSettleSamples-1] {
+		o = f.Update(s)
+	}
+	if o.Calibrated {
+		t.Fatal("bias was estimated before the Joycon rested long enough")
+	}
+
+	o = f.Update(samples[biasSettleSamples-1])
+	if !o.Calibrated {
+		t.Fatal("no bias estimate after the Joycon rested")
+	}
+	got := o.GyroBias
+	if math.Abs(got.X-bias.X) > 1e-9 || math.Abs(got.Y-bias.Y) > 1e-9 || math.Abs(got.Z-bias.Z) > 1e-9 {
+		t.Errorf("got bias %+v, want %+v", got, bias)
+	}
+
+	// With the bias subtracted the offset is no longer integrated, so the yaw it caused stops drifting
+	yaw := o.Yaw
+	for _, s := range samples[biasSettleSamples:] {
+		o = f.Update(s)
+	}
+	if math.Abs(o.Yaw-yaw) > 0.01 {
+		t.Errorf("yaw drifted from %.3f to %.3f after the bias was estimated", yaw, o.Yaw)
+	}
+}
@@ -0,0 +1,163 @@
+package joycon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"joyku/internal/subcommand"
+)
+
+const (
+	minReconnectDelay = 500 * time.Millisecond // Delay before the first attempt to reconnect, doubled after every failed attempt
+	maxReconnectDelay = 30 * time.Second       // Longest delay between attempts to reconnect
+	reconnectTimeout  = 5 * time.Second        // How long initializing a reopened Joycon may take
+	stateBufferSize   = 8                      // Number of state changes buffered for StateChanges before new ones are dropped
+)
+
+// ConnectionState is the state of the connection to a Joycon
+type ConnectionState byte
+
+const (
+	StateDisconnected ConnectionState = iota // Not connected yet, or connecting failed
+	StateConnected                           // Connected and reporting its status
+	StateReconnecting                        // Stopped reporting (e.g. it went to sleep or out of range) and is being reopened
+	StateClosed                              // Disconnected with Disconnect, the Joycon can't be used anymore
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "Disconnected"
+	case StateConnected:
+		return "Connected"
+	case StateReconnecting:
+		return "Reconnecting"
+	case StateClosed:
+		return "Closed"
+	default:
+		return "Unknown"
+	}
+}
+
+// StateChange is sent to StateChanges whenever the connection state of a Joycon changes
+type StateChange struct {
+	Joycon *Joycon
+	From   ConnectionState
+	To     ConnectionState
+}
+
+// State returns the current state of the connection to this Joycon
+func (j *Joycon) State() ConnectionState {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.state
+}
+
+// StateChanges exposes a readonly channel of connection state changes. Changes are dropped if the channel is full, and
+// it's closed once the Joycon is closed. The Status channel stays open while the Joycon reconnects.
+func (j *Joycon) StateChanges() <-chan StateChange {
+	return j.stateC
+}
+
+// changeState sets the connection state and publishes the change, j.lock must be held. A closed Joycon stays closed.
+func (j *Joycon) changeState(s ConnectionState) {
+	if j.state == s || j.state == StateClosed {
+		return
+	}
+	change := StateChange{Joycon: j, From: j.state, To: s}
+	j.state = s
+	select {
+	case j.stateC <- change:
+	default:
+	}
+	if s == StateClosed {
+		close(j.stateC)
+	}
+	if j.registry != nil {
+		j.registry.publishState(JoyconStateChanged, j, s)
+	}
+}
+
+// reconnect is called by the report loop once the dispatcher stops reading, which happens when the Joycon goes to
+// sleep, drifts out of range, or stops responding. Instead of giving up on the Joycon its device is reopened, waiting
+// longer after every failed attempt, until it's back or the Joycon is disconnected. It returns the new dispatcher, or
+// nil if the Joycon was disconnected.
+func (j *Joycon) reconnect() *subcommand.Dispatcher {
+	j.lock.Lock()
+	if j.state == StateClosed {
+		j.lock.Unlock()
+		return nil
+	}
+	open := j.open
+	old := j.dispatcher
+	j.changeState(StateReconnecting)
+	j.lock.Unlock()
+	old.Close()
+
+	// A Joycon connected over a transport can't be opened again
+	if open == nil {
+		log.Printf("%s stopped reporting and can not be reopened, disconnecting\n", j.Name)
+		j.Disconnect()
+		return nil
+	}
+
+	log.Printf("%s stopped reporting, reconnecting\n", j.Name)
+	delay := minReconnectDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-j.closeC:
+			return nil
+		case <-time.After(delay):
+		}
+
+		dp, err := j.reopen(open)
+		if err == nil {
+			log.Printf("Reconnected to %s after %d attempt(s)\n", j.Name, attempt)
+			return dp
+		}
+		delay = min(delay*2, maxReconnectDelay)
+		log.Printf("Could not reconnect to %s (attempt %d), trying again in %s: %s\n", j.Name, attempt, delay, err)
+	}
+}
+
+// reopen opens the device of a reconnecting Joycon and initializes it again. The player lights are restored, since
+// the Joycon forgets them when it disconnects.
+func (j *Joycon) reopen(open openFunc) (*subcommand.Dispatcher, error) {
+	d, err := open()
+	if err != nil {
+		return nil, err
+	}
+	dp := subcommand.NewDispatcher(d)
+
+	j.lock.Lock()
+	if j.state == StateClosed {
+		j.lock.Unlock()
+		dp.Close()
+		return nil, fmt.Errorf("the connection to this joycon (%s) has been closed", j.Name)
+	}
+	j.device = d
+	j.dispatcher = dp
+	j.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), reconnectTimeout)
+	defer cancel()
+	if err := j.initialize(ctx); err != nil {
+		dp.Close()
+		return nil, err
+	}
+	// The sticks were released while the Joycon was gone
+	j.stickDirections = [2]StickDirection{}
+
+	j.lock.Lock()
+	j.changeState(StateConnected)
+	lights := j.playerLights
+	j.lock.Unlock()
+	if lights != PlayerLightsOff {
+		if err := j.SetPlayerLights(lights); err != nil {
+			log.Printf("Could not restore the player lights of %s: %s\n", j.Name, err)
+		}
+	}
+	return dp, nil
+}
@@ -0,0 +1,103 @@
+package joycon_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"joyku/pkg/emulator"
+	"joyku/pkg/joycon"
+)
+
+// waitForState reads state changes of jc until it's in the given state
+func waitForState(t *testing.T, jc *joycon.Joycon, want joycon.ConnectionState) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case change, ok := <-jc.StateChanges():
+			if !ok {
+				t.Fatalf("state changes were closed before the Joycon was %s", want)
+			}
+			if change.To == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Joycon is %s, want %s", jc.State(), want)
+		}
+	}
+}
+
+// readStatuses reads every status of jc in the background, since the report loop can't reconnect while it's waiting for
+// a status to be read. The returned channel is closed once the status channel is.
+func readStatuses(jc *joycon.Joycon, received *atomic.Int64) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range jc.Status() {
+			received.Add(1)
+		}
+	}()
+	return done
+}
+
+func TestReconnectAfterDeviceIsLost(t *testing.T) {
+	c := emulator.NewLeft("aa:bb:cc:dd:ee:01")
+	b := emulator.NewBackend(c)
+	jc := joycon.NewRegistry(b).Find(c.Serial)
+	if err := jc.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer jc.Disconnect()
+	var received atomic.Int64
+	statusDone := readStatuses(jc, &received)
+	waitForState(t, jc, joycon.StateConnected)
+
+	b.Remove(c)
+	waitForState(t, jc, joycon.StateReconnecting)
+	b.Add(c)
+	waitForState(t, jc, joycon.StateConnected)
+
+	// The same status channel carries the reports of the reopened device
+	before := received.Load()
+	timeout := time.After(time.Second)
+	for received.Load() == before {
+		select {
+		case <-statusDone:
+			t.Fatal("status channel was closed while reconnecting")
+		case <-timeout:
+			t.Fatal("no status after reconnecting")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestDisconnectStopsReconnecting(t *testing.T) {
+	c := emulator.NewLeft("aa:bb:cc:dd:ee:01")
+	b := &probeBackend{Backend: emulator.NewBackend(c)}
+	jc := joycon.NewRegistry(b).Find(c.Serial)
+	if err := jc.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	var received atomic.Int64
+	statusDone := readStatuses(jc, &received)
+
+	b.Remove(c)
+	waitForState(t, jc, joycon.StateReconnecting)
+	if err := jc.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, jc, joycon.StateClosed)
+	select {
+	case <-statusDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("status channel wasn't closed after disconnecting")
+	}
+
+	// Nothing tries to reopen the device once the Joycon is closed
+	opens := b.openCount()
+	time.Sleep(2 * time.Second)
+	if n := b.openCount(); n != opens {
+		t.Errorf("device was opened %d more times after disconnecting", n-opens)
+	}
+}
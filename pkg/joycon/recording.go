@@ -0,0 +1,270 @@
+package joycon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"sync"
+	"time"
+
+	"joyku/internal/report"
+)
+
+// Recordings hold the raw input reports of a Joycon along with everything needed to parse them again. They start with
+// a header, where all numbers are little endian:
+//
+//	magic "JKRC", version (1 byte)
+//	start time (int64 unix nanoseconds), product id (uint16), controller type (1 byte)
+//	serial and name (1 byte length followed by the string)
+//	body and button color (3 bytes RGB each)
+//	stick and right stick calibration (9 bytes packed like the left stick in SPI flash, then the deadzone)
+//	imu calibration (24 bytes, the same as SPI flash)
+//
+// followed by a record for every input report: the number of microseconds since the previous report (or the start)
+// as a uvarint, then the 49 byte report.
+const recordingVersion = 1
+
+var recordingMagic = []byte("JKRC")
+
+// RecordingInfo describes the Joycon a recording was made from
+type RecordingInfo struct {
+	Start                 time.Time // Time the recording started
+	ProductID             uint16
+	ControllerType        ControllerType
+	Serial                string
+	Name                  string
+	BodyColor             color.RGBA
+	ButtonColor           color.RGBA
+	StickCalibration      StickCalibration
+	RightStickCalibration StickCalibration
+	IMUCalibration        IMUCalibration
+}
+
+// RecordedReport is a raw input report read from a recording
+type RecordedReport struct {
+	Offset time.Duration // Time since the recording started
+	Data   []byte
+}
+
+// recordingInfo returns the info of j for a recording started at the given time
+func (j *Joycon) recordingInfo(start time.Time) RecordingInfo {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return RecordingInfo{
+		Start:                 start,
+		ProductID:             j.ProductID,
+		ControllerType:        j.ControllerType,
+		Serial:                j.Serial,
+		Name:                  j.Name,
+		BodyColor:             rgb(j.BodyColor),
+		ButtonColor:           rgb(j.ButtonColor),
+		StickCalibration:      j.StickCalibration,
+		RightStickCalibration: j.RightStickCalibration,
+		IMUCalibration:        j.IMUCalibration,
+	}
+}
+
+// rgb converts c to the same RGBA the colors are read from SPI flash as, nil is black
+func rgb(c color.Color) color.RGBA {
+	if c == nil {
+		return color.RGBA{A: 100}
+	}
+	r, g, b, _ := c.RGBA()
+	return color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: 100}
+}
+
+func (ri RecordingInfo) marshal() ([]byte, error) {
+	if len(ri.Serial) > 0xFF || len(ri.Name) > 0xFF {
+		return nil, errors.New("serial and name must be at most 255 bytes to be recorded")
+	}
+
+	buf := bytes.NewBuffer(append([]byte{}, recordingMagic...))
+	buf.WriteByte(recordingVersion)
+	binary.Write(buf, binary.LittleEndian, ri.Start.UnixNano())
+	binary.Write(buf, binary.LittleEndian, ri.ProductID)
+	buf.WriteByte(byte(ri.ControllerType))
+	for _, s := range []string{ri.Serial, ri.Name} {
+		buf.WriteByte(byte(len(s)))
+		buf.WriteString(s)
+	}
+	for _, c := range []color.RGBA{ri.BodyColor, ri.ButtonColor} {
+		buf.Write([]byte{c.R, c.G, c.B})
+	}
+	for _, sc := range []StickCalibration{ri.StickCalibration, ri.RightStickCalibration} {
+		buf.Write(marshalLeftStick(sc))
+		buf.WriteByte(sc.Deadzone)
+	}
+	buf.Write(marshalIMUCalibration(ri.IMUCalibration))
+	return buf.Bytes(), nil
+}
+
+// readRecordingInfo reads the header of a recording
+func readRecordingInfo(r io.Reader) (RecordingInfo, error) {
+	// read returns the next n bytes of the header
+	var err error
+	read := func(n int) []byte {
+		buf := make([]byte, n)
+		if err == nil {
+			_, err = io.ReadFull(r, buf)
+		}
+		return buf
+	}
+	readString := func() string {
+		return string(read(int(read(1)[0])))
+	}
+
+	if magic := read(len(recordingMagic)); err == nil && !bytes.Equal(magic, recordingMagic) {
+		return RecordingInfo{}, errors.New("not a joycon recording")
+	}
+	if version := read(1)[0]; err == nil && version != recordingVersion {
+		return RecordingInfo{}, fmt.Errorf("unsupported recording version %d", version)
+	}
+
+	ri := RecordingInfo{}
+	ri.Start = time.Unix(0, int64(binary.LittleEndian.Uint64(read(8))))
+	ri.ProductID = binary.LittleEndian.Uint16(read(2))
+	ri.ControllerType = ControllerType(read(1)[0])
+	ri.Serial = readString()
+	ri.Name = readString()
+	for _, c := range []*color.RGBA{&ri.BodyColor, &ri.ButtonColor} {
+		rgb := read(3)
+		*c = color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 100}
+	}
+	for _, sc := range []*StickCalibration{&ri.StickCalibration, &ri.RightStickCalibration} {
+		*sc = unmarshalLeftStick(read(9))
+		sc.Deadzone = read(1)[0]
+	}
+	ri.IMUCalibration = unmarshalIMUCalibration(read(24))
+	if err != nil {
+		return RecordingInfo{}, fmt.Errorf("could not read recording header: %w", err)
+	}
+	return ri, nil
+}
+
+// Recorder writes the raw input reports of a Joycon to a recording, see Joycon.Record
+type Recorder struct {
+	joycon     *Joycon
+	w          *bufio.Writer
+	start      time.Time
+	lastOffset int64 // Microseconds since start of the last report, offsets are taken from the monotonic clock
+	lock       sync.Mutex
+	stopped    bool  // Set by Stop, reports that are still being recorded are dropped
+	err        error // First error that happened while writing, nothing is written after it
+}
+
+// Record starts writing the input reports of this Joycon to w, until Stop is called on the returned recorder. The
+// Joycon's calibration and colors are written first, so a recording can be replayed exactly with Replay.
+func (j *Joycon) Record(w io.Writer) (*Recorder, error) {
+	if !j.IsConnected() {
+		return nil, ErrNotConnected
+	}
+
+	start := time.Now()
+	header, err := j.recordingInfo(start).marshal()
+	if err != nil {
+		return nil, err
+	}
+	rec := &Recorder{joycon: j, w: bufio.NewWriter(w), start: start}
+	if _, err := rec.w.Write(header); err != nil {
+		return nil, fmt.Errorf("could not write recording header: %w", err)
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.recorder != nil {
+		return nil, fmt.Errorf("%s is already being recorded", j.Name)
+	}
+	j.recorder = rec
+	return rec, nil
+}
+
+// Stop stops recording and flushes the recording to its writer. The first error that happened while recording is
+// returned, the recording ends with the last report written before it.
+func (r *Recorder) Stop() error {
+	j := r.joycon
+	j.lock.Lock()
+	if j.recorder == r {
+		j.recorder = nil
+	}
+	j.lock.Unlock()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stopped = true
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	return r.err
+}
+
+// write records a single input report that was received at the given time
+func (r *Recorder) write(data []byte, received time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.stopped || r.err != nil {
+		return
+	}
+
+	offset := max(received.Sub(r.start).Microseconds(), r.lastOffset)
+	buf := binary.AppendUvarint(nil, uint64(offset-r.lastOffset))
+	r.lastOffset = offset
+
+	padded := make([]byte, report.ReportLengthBytes)
+	copy(padded, data)
+	if _, err := r.w.Write(append(buf, padded...)); err != nil {
+		r.err = fmt.Errorf("could not write recording: %w", err)
+	}
+}
+
+// record writes the input report to the recorder of this Joycon if it's being recorded
+func (j *Joycon) record(data []byte, received time.Time) {
+	j.lock.Lock()
+	rec := j.recorder
+	j.lock.Unlock()
+	if rec != nil {
+		rec.write(data, received)
+	}
+}
+
+// RecordingReader reads the reports of a recording one by one
+type RecordingReader struct {
+	Info   RecordingInfo // Joycon the recording was made from
+	r      *bufio.Reader
+	offset time.Duration
+}
+
+// NewRecordingReader reads the header of the recording in r
+func NewRecordingReader(r io.Reader) (*RecordingReader, error) {
+	br := bufio.NewReader(r)
+	info, err := readRecordingInfo(br)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingReader{Info: info, r: br}, nil
+}
+
+// Next returns the next report of the recording, io.EOF is returned once every report has been read
+func (rr *RecordingReader) Next() (RecordedReport, error) {
+	delta, err := binary.ReadUvarint(rr.r)
+	if err != nil {
+		if err != io.EOF {
+			err = fmt.Errorf("could not read recording: %w", err)
+		}
+		return RecordedReport{}, err
+	}
+	data := make([]byte, report.ReportLengthBytes)
+	if _, err := io.ReadFull(rr.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return RecordedReport{}, fmt.Errorf("could not read recording: %w", err)
+	}
+
+	rr.offset += time.Duration(delta) * time.Microsecond
+	return RecordedReport{Offset: rr.offset, Data: data}, nil
+}
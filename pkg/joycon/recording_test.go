@@ -0,0 +1,76 @@
+package joycon_test
+
+import (
+	"bytes"
+	"testing"
+
+	"joyku/pkg/emulator"
+	"joyku/pkg/joycon"
+)
+
+// Number of statuses recorded from the emulated Joycon
+const recordedStatuses = 20
+
+func TestRecordAndReplay(t *testing.T) {
+	c := emulator.NewRight("00:00:00:00:00:02")
+	s := emulator.NeutralState()
+	s.Buttons = joycon.ButtonA
+	s.StickHorizontal = 0xC00
+	c.SetState(s)
+
+	live := joycon.NewRegistry(emulator.NewBackend(c)).Find(c.Serial)
+	if err := live.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer live.Disconnect()
+
+	var recording bytes.Buffer
+	rec, err := live.Record(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*joycon.JoyconStatus{}
+	for js := range live.Status() {
+		if len(want) == recordedStatuses {
+			break
+		}
+		want = append(want, js)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := joycon.Replay(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Serial != live.Serial || replayed.ControllerType != live.ControllerType {
+		t.Errorf("replayed %s %s, want %s %s", replayed.ControllerType, replayed.Serial, live.ControllerType, live.Serial)
+	}
+	if replayed.StickCalibration != live.StickCalibration || replayed.IMUCalibration != live.IMUCalibration {
+		t.Error("replayed Joycon has a different calibration")
+	}
+
+	got := []*joycon.JoyconStatus{}
+	for js := range replayed.Status() {
+		got = append(got, js)
+	}
+	// A report may be recorded after the last status was read and before the recording was stopped
+	if len(got) != len(want) && len(got) != len(want)+1 {
+		t.Fatalf("replayed %d statuses, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Buttons != w.Buttons || got[i].JoystickData != w.JoystickData || got[i].Acceleration != w.Acceleration {
+			t.Errorf("status %d: got %+v, want %+v", i, got[i].JoystickData, w.JoystickData)
+		}
+	}
+	if state := replayed.State(); state != joycon.StateClosed {
+		t.Errorf("replayed Joycon is %s after the recording ended, want %s", state, joycon.StateClosed)
+	}
+}
+
+func TestReplayInvalidRecording(t *testing.T) {
+	if _, err := joycon.Replay(bytes.NewReader([]byte("not a recording"))); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,382 @@
+package joycon
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	registryEventBufferSize = 16               // Number of events buffered for each subscriber before new ones are dropped
+	probeRetryDelay         = 10 * time.Second // How long a device that couldn't be probed is ignored before probing it again
+)
+
+// RegistryEventKind is the kind of change to a Registry
+type RegistryEventKind byte
+
+const (
+	JoyconAdded        RegistryEventKind = iota // Joycon was found and added to the registry
+	JoyconRemoved                               // Joycon was removed from the registry after being disconnected or detached
+	JoyconStateChanged                          // Connection state of a Joycon in the registry changed
+)
+
+func (k RegistryEventKind) String() string {
+	switch k {
+	case JoyconAdded:
+		return "Added"
+	case JoyconRemoved:
+		return "Removed"
+	case JoyconStateChanged:
+		return "StateChanged"
+	default:
+		return "Unknown"
+	}
+}
+
+// RegistryEvent is sent to the subscribers of a Registry whenever a Joycon is added, removed, or changes state
+type RegistryEvent struct {
+	Kind   RegistryEventKind
+	Joycon *Joycon
+	State  ConnectionState // Connection state of the Joycon when the event happened
+}
+
+// Registry keeps track of the Joycons found through a backend, so the same Joycon is returned every time it's found.
+// It's safe to use from multiple goroutines. Find, FindAll, and the other package functions use DefaultRegistry, but
+// separate registries (e.g. each with their own emulator) can be used side by side.
+type Registry struct {
+	backend         Backend
+	joycons         map[string]*Joycon
+	probes          map[string]probeResult // Controller types of devices with an unexpected product id, by serial
+	lock            sync.Mutex             // Never held along with the lock of a Joycon
+	subscribers     map[chan RegistryEvent]struct{}
+	subscribersLock sync.Mutex // Separate from lock, since events are published while Joycons hold their own lock
+}
+
+// probeResult is the outcome of asking a device which type of controller it is
+type probeResult struct {
+	controllerType ControllerType
+	err            error
+	probed         time.Time
+}
+
+// DefaultRegistry finds Joycons by enumerating HID devices, unless it's given a different backend with SetBackend
+var DefaultRegistry = NewRegistry(hidBackend{})
+
+// NewRegistry returns an empty registry that discovers and connects to Joycons with the given backend
+func NewRegistry(b Backend) *Registry {
+	return &Registry{
+		backend:     b,
+		joycons:     make(map[string]*Joycon),
+		probes:      make(map[string]probeResult),
+		subscribers: make(map[chan RegistryEvent]struct{}),
+	}
+}
+
+// SetBackend replaces the backend used to discover and connect to Joycons. This should be called before any Joycons
+// have been found.
+func (r *Registry) SetBackend(b Backend) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.backend = b
+}
+
+// Backend returns the backend used to discover and connect to Joycons
+func (r *Registry) Backend() Backend {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.backend
+}
+
+// Find returns the Joycon with the given serial number, or nil if no Joycon with that serial is attached. Serial
+// numbers are compared case insensitively, since bluetooth addresses are often written in upper case.
+func (r *Registry) Find(serial string) *Joycon {
+	return r.FindContext(context.Background(), serial)
+}
+
+// FindContext is the same as Find, but ctx bounds how long a device with an unexpected product id is probed for
+func (r *Registry) FindContext(ctx context.Context, serial string) *Joycon {
+	r.lock.Lock()
+	for s, jc := range r.joycons {
+		if strings.EqualFold(serial, s) {
+			r.lock.Unlock()
+			return jc
+		}
+	}
+	r.lock.Unlock()
+
+	infos, _ := r.enumerate()
+	for _, info := range infos {
+		if !strings.EqualFold(serial, info.Serial) {
+			continue
+		}
+		jc, _ := r.lookup(ctx, info)
+		return jc
+	}
+	return nil
+}
+
+// FindAll finds all joycons attached to the system and returns them
+func (r *Registry) FindAll() []*Joycon {
+	return r.FindAllContext(context.Background())
+}
+
+// FindAllContext is the same as FindAll, but ctx bounds how long devices with an unexpected product id are probed for
+func (r *Registry) FindAllContext(ctx context.Context) []*Joycon {
+	joycons := []*Joycon{}
+	infos, _ := r.enumerate()
+	for _, info := range infos {
+		if jc, _ := r.lookup(ctx, info); jc != nil {
+			joycons = append(joycons, jc)
+		}
+	}
+	return joycons
+}
+
+// FindFirstPair finds the first joycon pair and returns them. A joycon pair consists of one left and one right joycon,
+// or a Pro Controller if one is found before a complete pair.
+func (r *Registry) FindFirstPair() Pair {
+	return r.FindFirstPairContext(context.Background())
+}
+
+// FindFirstPairContext is the same as FindFirstPair, but ctx bounds how long devices with an unexpected product id are
+// probed for
+func (r *Registry) FindFirstPairContext(ctx context.Context) Pair {
+	pair := Pair{}
+	for _, joycon := range r.Joycons() {
+		if pair.Complete() {
+			return pair
+		}
+		pair.add(joycon)
+	}
+	if pair.Complete() {
+		return pair
+	}
+
+	infos, _ := r.enumerate()
+	for _, info := range infos {
+		// we already found a pair, skip
+		if pair.Complete() {
+			break
+		}
+		r.lock.Lock()
+		_, ok := r.joycons[info.Serial]
+		r.lock.Unlock()
+		if ok {
+			continue
+		}
+
+		// ignore devices that aren't Joycons
+		jc, err := r.newJoycon(ctx, info)
+		if jc == nil {
+			if err == nil {
+				log.Printf("Received unexpected ProductID value for Joycon: %d, ignoring\n", info.ProductID)
+			}
+			continue
+		}
+
+		r.lock.Lock()
+		// Another caller may have found the same Joycon while it was being probed
+		existing, found := r.joycons[info.Serial]
+		if found {
+			jc = existing
+		}
+		added := pair.add(jc) && !found
+		if added {
+			r.joycons[jc.Serial] = jc
+		}
+		r.lock.Unlock()
+		if added {
+			r.publish(JoyconAdded, jc)
+		}
+	}
+	return pair
+}
+
+// Joycons returns every Joycon in the registry, whether or not it's connected
+func (r *Registry) Joycons() []*Joycon {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	joycons := make([]*Joycon, 0, len(r.joycons))
+	for _, jc := range r.joycons {
+		joycons = append(joycons, jc)
+	}
+	return joycons
+}
+
+// Connected returns every Joycon in the registry that is currently connected, including Joycons that are reconnecting
+func (r *Registry) Connected() []*Joycon {
+	joycons := []*Joycon{}
+	for _, jc := range r.Joycons() {
+		if s := jc.State(); s == StateConnected || s == StateReconnecting {
+			joycons = append(joycons, jc)
+		}
+	}
+	return joycons
+}
+
+// DisconnectAll disconnects every Joycon in the registry, removes them from it, and closes the backend. Each Joycon is
+// exposed to the given function after it has been disconnected, allowing for further cleanup/processing.
+//
+// This function ignores all errors returned by Joycon.Disconnect()
+func (r *Registry) DisconnectAll(closeFunc func(jc *Joycon)) {
+	r.lock.Lock()
+	joycons := r.joycons
+	r.joycons = make(map[string]*Joycon)
+	b := r.backend
+	r.lock.Unlock()
+
+	for _, jc := range joycons {
+		r.publish(JoyconRemoved, jc)
+	}
+	for _, jc := range joycons {
+		jc.Disconnect()
+		if closeFunc != nil {
+			closeFunc(jc)
+		}
+	}
+	b.Close()
+}
+
+// Subscribe returns a channel that receives every event of the registry, and a function that ends the subscription
+// and closes the channel. Events are dropped if the channel is full, so a slow subscriber never holds up the registry.
+func (r *Registry) Subscribe() (<-chan RegistryEvent, func()) {
+	events := make(chan RegistryEvent, registryEventBufferSize)
+	r.subscribersLock.Lock()
+	r.subscribers[events] = struct{}{}
+	r.subscribersLock.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			r.subscribersLock.Lock()
+			defer r.subscribersLock.Unlock()
+			delete(r.subscribers, events)
+			close(events)
+		})
+	}
+}
+
+// publishState sends an event for jc to every subscriber, the state is passed in since jc may be holding its lock
+func (r *Registry) publishState(kind RegistryEventKind, jc *Joycon, state ConnectionState) {
+	r.subscribersLock.Lock()
+	defer r.subscribersLock.Unlock()
+
+	event := RegistryEvent{Kind: kind, Joycon: jc, State: state}
+	for events := range r.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// publish sends an event for jc with its current state to every subscriber. r.lock must not be held, since the state
+// is read with jc's lock.
+func (r *Registry) publish(kind RegistryEventKind, jc *Joycon) {
+	r.publishState(kind, jc, jc.State())
+}
+
+// remove removes jc from the registry, unless it was already replaced by a different Joycon with the same serial
+func (r *Registry) remove(jc *Joycon) {
+	r.lock.Lock()
+	removed := r.joycons[jc.Serial] == jc
+	if removed {
+		delete(r.joycons, jc.Serial)
+	}
+	r.lock.Unlock()
+
+	if removed {
+		r.publish(JoyconRemoved, jc)
+	}
+}
+
+// enumerate returns the devices attached to the system, errors are logged and returned along with the devices that were
+// enumerated before it. The registry isn't locked while enumerating, so devices can be probed without holding up other
+// callers.
+func (r *Registry) enumerate() ([]DeviceInfo, error) {
+	infos := []DeviceInfo{}
+	err := r.Backend().Enumerate(func(info DeviceInfo) error {
+		infos = append(infos, info)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Could not enumerate devices: %s\n", err)
+	}
+	return infos, err
+}
+
+// lookup returns the Joycon in the registry for the given device, adding a new one if it hasn't been found yet. nil is
+// returned if the device isn't a Joycon or Pro Controller, along with an error if that's because it couldn't be probed.
+// r.lock must not be held.
+func (r *Registry) lookup(ctx context.Context, info DeviceInfo) (*Joycon, error) {
+	r.lock.Lock()
+	jc, ok := r.joycons[info.Serial]
+	r.lock.Unlock()
+	if ok {
+		return jc, nil
+	}
+
+	jc, err := r.newJoycon(ctx, info)
+	if jc == nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	// Another caller may have found the same Joycon while it was being probed
+	if existing, ok := r.joycons[info.Serial]; ok {
+		r.lock.Unlock()
+		return existing, nil
+	}
+	r.joycons[info.Serial] = jc
+	r.lock.Unlock()
+
+	r.publish(JoyconAdded, jc)
+	return jc, nil
+}
+
+// newJoycon returns a Joycon of this registry for the given device, or nil if the device isn't a Joycon or Pro
+// Controller. The Joycon isn't added to the registry. r.lock must not be held, since devices with an unexpected product
+// id (e.g. some third party controllers) are asked which type of controller they are.
+func (r *Registry) newJoycon(ctx context.Context, info DeviceInfo) (*Joycon, error) {
+	jc := New(info.ProductID, info.Serial, info.Name)
+	jc.registry = r
+	if jc.ControllerType == ControllerTypeUnknown {
+		ct, err := r.probe(ctx, info)
+		if err != nil {
+			return nil, err
+		}
+		jc.ControllerType = ct
+	}
+
+	if !jc.IsLeft() && !jc.IsRight() && !jc.IsPro() {
+		return nil, nil
+	}
+	return jc, nil
+}
+
+// probe returns the controller type of a device with an unexpected product id. The outcome is cached per serial, so
+// each device is only probed once, or again after probeRetryDelay if probing it failed.
+func (r *Registry) probe(ctx context.Context, info DeviceInfo) (ControllerType, error) {
+	r.lock.Lock()
+	p, ok := r.probes[info.Serial]
+	b := r.backend
+	r.lock.Unlock()
+	if ok && (p.err == nil || time.Since(p.probed) < probeRetryDelay) {
+		return p.controllerType, p.err
+	}
+
+	ct, err := probeControllerType(ctx, b, info)
+	if err != nil {
+		log.Printf("Could not determine the controller type of %s (product id 0x%04X), ignoring: %s\n", info.Name, info.ProductID, err)
+	}
+	// The device isn't to blame if the caller gave up, so it's probed again next time
+	if ctx.Err() == nil {
+		r.lock.Lock()
+		r.probes[info.Serial] = probeResult{controllerType: ct, err: err, probed: time.Now()}
+		r.lock.Unlock()
+	}
+	return ct, err
+}
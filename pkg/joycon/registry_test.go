@@ -0,0 +1,230 @@
+package joycon_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"joyku/pkg/emulator"
+	"joyku/pkg/joycon"
+)
+
+func TestRegistryFind(t *testing.T) {
+	r := joycon.NewRegistry(emulator.NewBackend(emulator.NewLeft("aa:bb:cc:dd:ee:01")))
+
+	jc := r.Find("AA:BB:CC:DD:EE:01")
+	if jc == nil {
+		t.Fatal("expected to find the Joycon")
+	}
+	if !jc.IsLeft() {
+		t.Errorf("got a %s, want a left Joycon", jc.ControllerType)
+	}
+	if again := r.Find("aa:bb:cc:dd:ee:01"); again != jc {
+		t.Error("finding the Joycon again returned a different Joycon")
+	}
+	if missing := r.Find("aa:bb:cc:dd:ee:02"); missing != nil {
+		t.Errorf("got %+v for a serial that isn't attached, want nil", missing)
+	}
+}
+
+func TestRegistriesAreSeparate(t *testing.T) {
+	left := joycon.NewRegistry(emulator.NewBackend(emulator.NewLeft("aa:bb:cc:dd:ee:01")))
+	right := joycon.NewRegistry(emulator.NewBackend(emulator.NewRight("aa:bb:cc:dd:ee:02")))
+
+	if jc := left.Find("aa:bb:cc:dd:ee:02"); jc != nil {
+		t.Error("found a Joycon of a different registry")
+	}
+	if n := len(right.FindAll()); n != 1 {
+		t.Errorf("found %d Joycons, want 1", n)
+	}
+	if n := len(left.Joycons()); n != 0 {
+		t.Errorf("got %d Joycons in an untouched registry, want 0", n)
+	}
+}
+
+func TestRegistryEvents(t *testing.T) {
+	r := joycon.NewRegistry(emulator.NewBackend(emulator.NewRight("aa:bb:cc:dd:ee:02")))
+	events, unsubscribe := r.Subscribe()
+	defer unsubscribe()
+
+	jc := r.Find("aa:bb:cc:dd:ee:02")
+	if err := jc.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := jc.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []joycon.RegistryEvent{
+		{Kind: joycon.JoyconAdded, Joycon: jc, State: joycon.StateDisconnected},
+		{Kind: joycon.JoyconStateChanged, Joycon: jc, State: joycon.StateConnected},
+		{Kind: joycon.JoyconStateChanged, Joycon: jc, State: joycon.StateClosed},
+		{Kind: joycon.JoyconRemoved, Joycon: jc, State: joycon.StateClosed},
+	}
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got != w {
+				t.Errorf("got %s event (%s), want %s event (%s)", got.Kind, got.State, w.Kind, w.State)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event", w.Kind)
+		}
+	}
+	if len(r.Joycons()) != 0 {
+		t.Error("disconnected Joycon is still in the registry")
+	}
+}
+
+// probeBackend counts how often devices are opened, and fails to open them the first failures times
+type probeBackend struct {
+	*emulator.Backend
+	lock     sync.Mutex
+	opens    int
+	failures int
+}
+
+func (b *probeBackend) Open(info joycon.DeviceInfo) (joycon.Transport, error) {
+	b.lock.Lock()
+	b.opens++
+	fail := b.opens <= b.failures
+	b.lock.Unlock()
+	if fail {
+		return nil, errors.New("device is busy")
+	}
+	return b.Backend.Open(info)
+}
+
+func (b *probeBackend) openCount() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.opens
+}
+
+func TestRegistryProbesUnknownProductIDs(t *testing.T) {
+	unknown := emulator.NewRight("aa:bb:cc:dd:ee:03")
+	unknown.ProductID = 0x2017
+	b := &probeBackend{Backend: emulator.NewBackend(emulator.NewLeft("aa:bb:cc:dd:ee:01"), unknown)}
+	r := joycon.NewRegistry(b)
+
+	if n := len(r.FindAll()); n != 2 {
+		t.Fatalf("found %d Joycons, want 2", n)
+	}
+	if jc := r.Find("aa:bb:cc:dd:ee:03"); jc == nil || !jc.IsRight() {
+		t.Errorf("got %+v, want the probed right Joycon", jc)
+	}
+	// Only the device with an unknown product id is opened, and only once
+	if n := b.openCount(); n != 1 {
+		t.Errorf("devices were opened %d times, want 1", n)
+	}
+}
+
+func TestRegistryCachesFailedProbes(t *testing.T) {
+	unknown := emulator.NewRight("aa:bb:cc:dd:ee:03")
+	unknown.ProductID = 0x2017
+	b := &probeBackend{Backend: emulator.NewBackend(unknown), failures: 1}
+	r := joycon.NewRegistry(b)
+
+	for i := 0; i < 3; i++ {
+		if n := len(r.FindAll()); n != 0 {
+			t.Fatalf("found %d Joycons while the device can't be probed, want 0", n)
+		}
+	}
+	if n := b.openCount(); n != 1 {
+		t.Errorf("device was probed %d times, want 1 until it's retried", n)
+	}
+}
+
+func TestRegistryProbeCanceled(t *testing.T) {
+	unknown := emulator.NewRight("aa:bb:cc:dd:ee:03")
+	unknown.ProductID = 0x2017
+	b := &probeBackend{Backend: emulator.NewBackend(unknown)}
+	r := joycon.NewRegistry(b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if jc := r.FindContext(ctx, unknown.Serial); jc != nil {
+		t.Fatal("found a Joycon after the context was canceled")
+	}
+	// Giving up isn't the device's fault, so it's probed again right away
+	if jc := r.Find(unknown.Serial); jc == nil || !jc.IsRight() {
+		t.Errorf("got %+v, want the probed right Joycon", jc)
+	}
+}
+
+// gatedBackend holds up the first Open until release is closed, so the Joycon being opened keeps its lock
+type gatedBackend struct {
+	*emulator.Backend
+	once    sync.Once
+	opened  chan struct{}
+	release chan struct{}
+}
+
+func (b *gatedBackend) Open(info joycon.DeviceInfo) (joycon.Transport, error) {
+	b.once.Do(func() {
+		close(b.opened)
+		<-b.release
+	})
+	return b.Backend.Open(info)
+}
+
+func TestRegistryConnectWhileDisconnectingAll(t *testing.T) {
+	b := &gatedBackend{Backend: emulator.NewBackend(), opened: make(chan struct{}), release: make(chan struct{})}
+	for i := range 8 {
+		b.Add(emulator.NewLeft(fmt.Sprintf("aa:bb:cc:dd:ee:%02X", i)))
+	}
+	r := joycon.NewRegistry(b)
+	joycons := r.FindAll()
+	ctx, cancel := context.WithCancel(context.Background())
+	events := r.Watch(ctx)
+
+	var wg sync.WaitGroup
+	connect := func(jc *joycon.Joycon) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jc.Connect()
+		}()
+	}
+	// The first Joycon is held up while it's opened, so DisconnectAll waits for its state while the others connect
+	connect(joycons[0])
+	<-b.opened
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.DisconnectAll(nil)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	for _, jc := range joycons[1:] {
+		connect(jc)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(b.release)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	timeout := time.After(5 * time.Second)
+wait:
+	for {
+		select {
+		case <-events:
+		case <-done:
+			break wait
+		case <-timeout:
+			t.Fatal("connecting while disconnecting everything deadlocked")
+		}
+	}
+	cancel()
+	for range events {
+	}
+	// Joycons that connected after DisconnectAll are still connected
+	for _, jc := range joycons {
+		jc.Disconnect()
+	}
+}
@@ -0,0 +1,123 @@
+package joycon
+
+import (
+	"io"
+	"log"
+	"time"
+
+	"joyku/internal/report"
+	"joyku/internal/subcommand"
+	"joyku/internal/transport"
+)
+
+// Replay returns a connected Joycon that replays a recording made with Joycon.Record. The recorded reports are parsed
+// at the same pace they were recorded, so the Joycon behaves like a live one: it can be held sideways, given a stick
+// response, joined to a multiplexer, and sent subcommands (which are acknowledged but do nothing). Every replayed
+// status is sent before it disconnects itself at the end of the recording.
+func Replay(r io.Reader) (*Joycon, error) {
+	rr, err := NewRecordingReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	info := rr.Info
+	j := New(info.ProductID, info.Serial, info.Name)
+	j.ControllerType = info.ControllerType
+	j.BodyColor = info.BodyColor
+	j.ButtonColor = info.ButtonColor
+	j.StickCalibration = info.StickCalibration
+	j.RightStickCalibration = info.RightStickCalibration
+	j.IMUCalibration = info.IMUCalibration
+	j.orientation = NewOrientationFilter()
+
+	host, device := transport.NewMemoryPair()
+	j.device = host
+	j.dispatcher = subcommand.NewDispatcher(host)
+	j.lock.Lock()
+	j.changeState(StateConnected)
+	j.lock.Unlock()
+
+	go j.readStatus()
+	go replayReports(j, rr, device)
+	return j, nil
+}
+
+// replayReports writes the recorded reports to the device end of the Joycon's transport at the time they were
+// recorded, and acknowledges every subcommand with the last replayed input state. The Joycon is disconnected once
+// the recording ends.
+func replayReports(j *Joycon, rr *RecordingReader, device transport.Transport) {
+	done := make(chan struct{})
+	defer close(done)
+
+	// Subcommands sent by the Joycon, the channel is closed once the transport is closed
+	requests := make(chan []byte)
+	go func() {
+		defer close(requests)
+		for {
+			buf := make([]byte, report.ReportLengthBytes)
+			if _, err := device.Read(buf); err != nil {
+				return
+			}
+			select {
+			case requests <- buf:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	next, err := rr.Next()
+	if err != nil {
+		finishReplay(j, device, err)
+		return
+	}
+	// Replies contain the input state, so they use the first report until it has been replayed
+	last := next.Data
+	start := time.Now()
+	timer := time.NewTimer(time.Until(start.Add(next.Offset)))
+	defer timer.Stop()
+
+	for {
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				return
+			}
+			// Output report 0x01 contains rumble data and a subcommand, all other reports (e.g. rumble only) are ignored
+			if req[0] != 0x01 {
+				continue
+			}
+			reply := append([]byte{}, last...)
+			reply[0] = report.StandardInputReportWithReplies.Byte()
+			reply[13] = 0x80
+			reply[14] = req[10]
+			clear(reply[15:])
+			if _, err := device.Write(reply); err != nil {
+				return
+			}
+		case <-timer.C:
+			if _, err := device.Write(next.Data); err != nil {
+				return
+			}
+			last = next.Data
+
+			next, err = rr.Next()
+			if err != nil {
+				finishReplay(j, device, err)
+				return
+			}
+			timer.Reset(time.Until(start.Add(next.Offset)))
+		}
+	}
+}
+
+// finishReplay closes the transport of a replayed Joycon once its recording ends or can't be read anymore. The reports
+// that were already replayed are still read, then the Joycon disconnects since its transport can't be opened again.
+func finishReplay(j *Joycon, device transport.Transport, err error) {
+	if err != io.EOF {
+		log.Printf("Stopped replaying %s: %s\n", j.Name, err)
+	} else {
+		log.Printf("Finished replaying %s\n", j.Name)
+	}
+	device.Close()
+}
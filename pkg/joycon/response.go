@@ -0,0 +1,178 @@
+package joycon
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DeadzoneShape determines how the inner deadzone of a stick is applied
+type DeadzoneShape byte
+
+const (
+	DeadzoneRadial       DeadzoneShape = iota // Stick is centered while it's within a circle, values outside it are unchanged
+	DeadzoneAxial                             // Each axis is centered separately, making it easy to push straight along an axis
+	DeadzoneScaledRadial                      // Same as radial, but values are rescaled so they start at zero outside the deadzone
+)
+
+func (s DeadzoneShape) String() string {
+	switch s {
+	case DeadzoneRadial:
+		return "Radial"
+	case DeadzoneAxial:
+		return "Axial"
+	case DeadzoneScaledRadial:
+		return "Scaled Radial"
+	default:
+		return "Invalid"
+	}
+}
+
+// ResponseCurve maps how far the stick is pushed (0-1) to the output value (0-1)
+type ResponseCurve func(float64) float64
+
+// Built-in response curves
+var (
+	// LinearCurve outputs exactly how far the stick is pushed
+	LinearCurve ResponseCurve = func(v float64) float64 { return v }
+	// QuadraticCurve gives finer control near the center of the stick
+	QuadraticCurve ResponseCurve = func(v float64) float64 { return v * v }
+	// CubicCurve gives even finer control near the center of the stick than QuadraticCurve
+	CubicCurve ResponseCurve = func(v float64) float64 { return v * v * v }
+)
+
+// CurvePoint is a point on a custom response curve
+type CurvePoint struct {
+	In  float64 // How far the stick is pushed (0-1)
+	Out float64 // Output value at that point (0-1)
+}
+
+// CustomCurve returns a response curve that linearly interpolates between the given points. The curve always passes
+// through (0, 0) and (1, 1), so only the points in between need to be given.
+func CustomCurve(points []CurvePoint) (ResponseCurve, error) {
+	curve := append([]CurvePoint{}, points...)
+	sort.Slice(curve, func(i, j int) bool {
+		return curve[i].In < curve[j].In
+	})
+	for i, p := range curve {
+		if p.In < 0 || p.In > 1 || p.Out < 0 || p.Out > 1 {
+			return nil, fmt.Errorf("curve point (%g, %g) is out of range, both values must be between 0 and 1", p.In, p.Out)
+		}
+		if i > 0 && p.In == curve[i-1].In {
+			return nil, fmt.Errorf("curve has more than one point at %g", p.In)
+		}
+	}
+	if len(curve) == 0 || curve[0].In > 0 {
+		curve = append([]CurvePoint{{0, 0}}, curve...)
+	}
+	if curve[len(curve)-1].In < 1 {
+		curve = append(curve, CurvePoint{1, 1})
+	}
+
+	return func(v float64) float64 {
+		i := sort.Search(len(curve), func(i int) bool {
+			return curve[i].In >= v
+		})
+		if i == 0 {
+			return curve[0].Out
+		} else if i == len(curve) {
+			return curve[len(curve)-1].Out
+		}
+		lo, hi := curve[i-1], curve[i]
+		return lo.Out + (v-lo.In)/(hi.In-lo.In)*(hi.Out-lo.Out)
+	}, nil
+}
+
+// Largest hysteresis (in degrees) that can be used between direction sectors
+const maxHysteresis = 45
+
+// StickResponse determines how the calibrated position of a stick is turned into its output
+type StickResponse struct {
+	Deadzone      float64          // Inner deadzone (0-1), zero uses the deadzone from the stick's calibration
+	OuterDeadzone float64          // Portion near the edge (0-1) that is treated as fully pushed
+	Shape         DeadzoneShape    // How the inner deadzone is applied
+	Curve         ResponseCurve    // Applied after the deadzones, nil is the same as LinearCurve
+	Sectors       DirectionSectors // Number of directions the stick can point in, zero is the same as EightWay
+	Hysteresis    float64          // Degrees the stick has to move past the edge of its direction before it changes
+}
+
+// DefaultStickResponse uses the deadzone from the stick's calibration and outputs the position of the stick unchanged
+var DefaultStickResponse = StickResponse{Shape: DeadzoneRadial, Curve: LinearCurve, Sectors: EightWay, Hysteresis: 5}
+
+// Validate returns an error if the response has out of range values
+func (r StickResponse) Validate() error {
+	if r.Deadzone < 0 || r.OuterDeadzone < 0 {
+		return errors.New("deadzones can not be negative")
+	}
+	if r.Deadzone+r.OuterDeadzone >= 1 {
+		return fmt.Errorf("inner (%g) and outer (%g) deadzones cover the entire stick", r.Deadzone, r.OuterDeadzone)
+	}
+	if r.Shape > DeadzoneScaledRadial {
+		return fmt.Errorf("invalid deadzone shape: %d", r.Shape)
+	}
+	switch r.Sectors {
+	case 0, FourWay, EightWay, SixteenWay:
+	default:
+		return fmt.Errorf("invalid number of directions %d, expected 4, 8, or 16", r.Sectors)
+	}
+	if r.Hysteresis < 0 || r.Hysteresis > maxHysteresis {
+		return fmt.Errorf("hysteresis must be between 0 and %d degrees", maxHysteresis)
+	}
+	return nil
+}
+
+// apply returns the output for a normalized stick position, deadzone is used if the response doesn't set its own
+func (r StickResponse) apply(x float64, y float64, deadzone float64) (float64, float64) {
+	if r.Deadzone > 0 {
+		deadzone = r.Deadzone
+	}
+	curve := r.Curve
+	if curve == nil {
+		curve = LinearCurve
+	}
+	// Rescale so the outer deadzone counts as fully pushed
+	outer := func(v float64) float64 {
+		return math.Min(v/(1-r.OuterDeadzone), 1)
+	}
+
+	if r.Shape == DeadzoneAxial {
+		axis := func(v float64) float64 {
+			if math.Abs(v) < deadzone {
+				return 0
+			}
+			return math.Copysign(curve(outer(math.Abs(v))), v)
+		}
+		return axis(x), axis(y)
+	}
+
+	magnitude := math.Hypot(x, y)
+	if magnitude < deadzone || magnitude == 0 {
+		return 0, 0
+	}
+	scaled := outer(magnitude)
+	if r.Shape == DeadzoneScaledRadial {
+		scaled = clamp((magnitude - deadzone) / (1 - deadzone - r.OuterDeadzone))
+	}
+	scaled = curve(scaled)
+	return x / magnitude * scaled, y / magnitude * scaled
+}
+
+// SetStickResponse sets how the sticks of this Joycon respond to being pushed
+func (j *Joycon) SetStickResponse(r StickResponse) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.stickResponse = r
+	return nil
+}
+
+// StickResponse returns how the sticks of this Joycon respond to being pushed
+func (j *Joycon) StickResponse() StickResponse {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.stickResponse
+}
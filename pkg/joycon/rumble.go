@@ -0,0 +1,102 @@
+package joycon
+
+import (
+	"context"
+	"time"
+
+	"joyku/internal/subcommand"
+)
+
+// Joycons stop vibrating if they don't receive rumble data for a while, so long frames are resent at this interval
+const rumbleRefreshInterval = 50 * time.Millisecond
+
+// RumbleFrame is a single step of a rumble pattern. Frequencies are in Hz and amplitudes range from 0 (off) to 1.
+type RumbleFrame struct {
+	HighFrequency float64       // Frequency of the high band (81.75Hz-1252Hz)
+	HighAmplitude float64       // Amplitude of the high band
+	LowFrequency  float64       // Frequency of the low band (40.875Hz-626Hz)
+	LowAmplitude  float64       // Amplitude of the low band
+	Duration      time.Duration // How long the frame is played for
+}
+
+// RumblePattern is a timeline of rumble frames played one after the other
+type RumblePattern []RumbleFrame
+
+// Duration returns the total duration of the pattern
+func (p RumblePattern) Duration() time.Duration {
+	var d time.Duration
+	for _, f := range p {
+		d += f.Duration
+	}
+	return d
+}
+
+// RumblePause returns a frame that doesn't vibrate for the given duration
+func RumblePause(d time.Duration) RumbleFrame {
+	return RumbleFrame{HighFrequency: 320, LowFrequency: 160, Duration: d}
+}
+
+// Built-in rumble patterns
+var (
+	// RumbleTick is a short click, useful as feedback for a key press
+	RumbleTick = RumblePattern{
+		{HighFrequency: 400, HighAmplitude: 0.6, LowFrequency: 160, LowAmplitude: 0.2, Duration: 20 * time.Millisecond},
+	}
+	// RumbleBuzz is a strong buzz, useful for errors
+	RumbleBuzz = RumblePattern{
+		{HighFrequency: 320, HighAmplitude: 0.5, LowFrequency: 160, LowAmplitude: 0.8, Duration: 250 * time.Millisecond},
+	}
+	// RumbleHeartbeat is two beats followed by a pause
+	RumbleHeartbeat = RumblePattern{
+		{HighFrequency: 160, HighAmplitude: 0.3, LowFrequency: 80, LowAmplitude: 0.9, Duration: 60 * time.Millisecond},
+		RumblePause(100 * time.Millisecond),
+		{HighFrequency: 160, HighAmplitude: 0.2, LowFrequency: 80, LowAmplitude: 0.6, Duration: 60 * time.Millisecond},
+		RumblePause(500 * time.Millisecond),
+	}
+)
+
+// Rumble plays the given pattern and blocks until it has finished or the context is done. Only one pattern is played
+// at a time, so calls made while another pattern is playing wait for it to finish. The Joycon is always left with
+// rumble turned off.
+func (j *Joycon) Rumble(ctx context.Context, pattern RumblePattern) error {
+	j.rumbleLock.Lock()
+	defer j.rumbleLock.Unlock()
+
+	dp, err := j.connectedDispatcher()
+	if err != nil {
+		return err
+	}
+	d := dp.Device()
+
+	// Make sure the Joycon doesn't keep vibrating if the pattern is interrupted
+	defer subcommand.NewRumbleCommand(d, 320, 0, 160, 0).Send()
+
+	ticker := time.NewTicker(rumbleRefreshInterval)
+	defer ticker.Stop()
+
+	for _, frame := range pattern {
+		rumble := subcommand.NewRumbleCommand(d, frame.HighFrequency, frame.HighAmplitude, frame.LowFrequency, frame.LowAmplitude)
+		if err := rumble.Send(); err != nil {
+			return err
+		}
+
+		ticker.Reset(rumbleRefreshInterval)
+		timer := time.NewTimer(frame.Duration)
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+				break wait
+			case <-ticker.C:
+				if err := rumble.Send(); err != nil {
+					timer.Stop()
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package joycon_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"joyku/internal/report"
+	"joyku/internal/subcommand"
+	"joyku/internal/transport"
+	"joyku/pkg/emulator"
+	"joyku/pkg/joycon"
+)
+
+// serveAck answers every subcommand sent to device with the given ACK byte and no data, until the transport is closed.
+// Subcommands are never answered if ack is zero.
+func serveAck(device transport.Transport, ack byte) {
+	for {
+		req := make([]byte, report.ReportLengthBytes)
+		if _, err := device.Read(req); err != nil {
+			return
+		}
+		if req[0] != 0x01 || ack == 0 {
+			continue
+		}
+
+		reply := make([]byte, report.ReportLengthBytes)
+		reply[0] = report.StandardInputReportWithReplies.Byte()
+		reply[13] = ack
+		reply[14] = req[10]
+		if _, err := device.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+func TestConnectTransportNack(t *testing.T) {
+	host, device := transport.NewMemoryPair()
+	defer device.Close()
+	// Any ACK byte without the ACK bit set is a NACK
+	go serveAck(device, 0x02)
+
+	jc := joycon.New(joycon.RightJoyconProductID, "00:00:00:00:00:01", "Joy-Con (R)")
+	err := jc.ConnectTransport(host)
+
+	var connectErr joycon.ConnectError
+	if !errors.As(err, &connectErr) || connectErr.Step != joycon.StepDeviceInfo {
+		t.Fatalf("got %v, want a ConnectError for %s", err, joycon.StepDeviceInfo)
+	}
+	var nack subcommand.NackError
+	if !errors.As(err, &nack) {
+		t.Errorf("got %v, want a NackError", err)
+	}
+	if jc.IsConnected() {
+		t.Error("Joycon is connected after the handshake failed")
+	}
+}
+
+func TestConnectTransportTimeout(t *testing.T) {
+	host, device := transport.NewMemoryPair()
+	defer device.Close()
+	go serveAck(device, 0)
+
+	jc := joycon.New(joycon.RightJoyconProductID, "00:00:00:00:00:01", "Joy-Con (R)")
+	err := jc.ConnectTransport(host)
+
+	var connectErr joycon.ConnectError
+	if !errors.As(err, &connectErr) || connectErr.Step != joycon.StepDeviceInfo {
+		t.Fatalf("got %v, want a ConnectError for %s", err, joycon.StepDeviceInfo)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestStatusReportsInputs(t *testing.T) {
+	c := emulator.NewRight("00:00:00:00:00:01")
+	state := emulator.NeutralState()
+	state.Buttons = joycon.ButtonA
+	c.SetState(state)
+	host, device := transport.NewMemoryPair()
+	defer device.Close()
+	go c.Serve(device)
+
+	jc := joycon.New(c.ProductID, c.Serial, c.Name)
+	if err := jc.ConnectTransport(host); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replies to the handshake may be read before the first full mode report
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case js := <-jc.Status():
+			if js.ButtonA {
+				return
+			}
+		case <-timeout:
+			t.Fatal("A wasn't reported as held")
+		}
+	}
+}
+
+func TestStatusEndsWhenDeviceIsClosed(t *testing.T) {
+	c := emulator.NewRight("00:00:00:00:00:01")
+	host, device := transport.NewMemoryPair()
+	go c.Serve(device)
+
+	jc := joycon.New(c.ProductID, c.Serial, c.Name)
+	if err := jc.ConnectTransport(host); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-jc.Status():
+	case <-time.After(time.Second):
+		t.Fatal("no status before the device was closed")
+	}
+
+	device.Close()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-jc.Status():
+			if ok {
+				continue
+			}
+			// A transport given to ConnectTransport can't be opened again, so there's nothing to reconnect to
+			if s := jc.State(); s != joycon.StateClosed {
+				t.Errorf("got state %s, want %s", s, joycon.StateClosed)
+			}
+			return
+		case <-timeout:
+			t.Fatal("status channel wasn't closed after the device was closed")
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package joycon
+
+import (
+	"context"
+	"time"
+)
+
+// How often Watch enumerates the devices attached to the system
+const watchInterval = time.Second
+
+// DeviceEventKind is the kind of change Watch saw
+type DeviceEventKind byte
+
+const (
+	DeviceAdded   DeviceEventKind = iota // Joycon was attached to the system
+	DeviceRemoved                        // Joycon was detached from the system
+)
+
+func (k DeviceEventKind) String() string {
+	switch k {
+	case DeviceAdded:
+		return "Added"
+	case DeviceRemoved:
+		return "Removed"
+	default:
+		return "Unknown"
+	}
+}
+
+// DeviceEvent is sent by Watch when a Joycon is attached to or detached from the system
+type DeviceEvent struct {
+	Kind   DeviceEventKind
+	Joycon *Joycon // Joycon that was attached or detached, it still has to be connected after being attached unless it's reconnecting
+}
+
+// Watch sends an event whenever a Joycon is attached to or detached from the system, by enumerating the attached
+// devices every second and comparing them to the last enumeration. Joycons that are already attached are sent as
+// added when watching starts. The Joycons are the same ones returned by Find and FindAll. A Joycon that is detached
+// while it's connected is kept, since it reconnects on its own once it's attached again (see State), otherwise it's
+// forgotten so it's found again as a new Joycon. The channel is closed once ctx is done.
+func Watch(ctx context.Context) <-chan DeviceEvent {
+	return DefaultRegistry.Watch(ctx)
+}
+
+// Watch is the same as the package level Watch, but finds Joycons with this registry
+func (r *Registry) Watch(ctx context.Context) <-chan DeviceEvent {
+	events := make(chan DeviceEvent)
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		// Devices seen in the last enumeration, devices that aren't Joycons are kept as nil so they're only probed once
+		attached := make(map[string]*Joycon)
+		for {
+			for _, event := range r.watchEnumerate(ctx, attached) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return events
+}
+
+// watchEnumerate enumerates the attached devices and returns the changes since the devices in attached, which is
+// updated to match. Devices that couldn't be probed aren't added to attached, so they're tried again.
+func (r *Registry) watchEnumerate(ctx context.Context, attached map[string]*Joycon) []DeviceEvent {
+	events := []DeviceEvent{}
+	seen := make(map[string]bool)
+	infos, err := r.enumerate()
+	for _, info := range infos {
+		seen[info.Serial] = true
+		if _, ok := attached[info.Serial]; ok {
+			continue
+		}
+
+		jc, err := r.lookup(ctx, info)
+		if err != nil {
+			continue
+		}
+		attached[info.Serial] = jc
+		if jc != nil {
+			events = append(events, DeviceEvent{Kind: DeviceAdded, Joycon: jc})
+		}
+	}
+	// Devices that weren't enumerated may still be attached
+	if err != nil {
+		return events
+	}
+
+	for serial, jc := range attached {
+		if seen[serial] {
+			continue
+		}
+		delete(attached, serial)
+		if jc == nil {
+			continue
+		}
+		if jc.State() == StateDisconnected {
+			r.remove(jc)
+		}
+		events = append(events, DeviceEvent{Kind: DeviceRemoved, Joycon: jc})
+	}
+	return events
+}
@@ -0,0 +1,100 @@
+package joycon_test
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"joyku/pkg/emulator"
+	"joyku/pkg/joycon"
+)
+
+// nextDeviceEvent returns the next event sent by Watch, which enumerates every second
+func nextDeviceEvent(t *testing.T, events <-chan joycon.DeviceEvent) joycon.DeviceEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("events were closed")
+		}
+		return event
+	case <-time.After(3 * time.Second):
+		t.Fatal("no event")
+	}
+	return joycon.DeviceEvent{}
+}
+
+// expectDeviceEvent fails the test unless the next event sent by Watch is of the given kind for the given serial
+func expectDeviceEvent(
+	t *testing.T, events <-chan joycon.DeviceEvent, kind joycon.DeviceEventKind, serial string,
+) *joycon.Joycon {
+	t.Helper()
+	event := nextDeviceEvent(t, events)
+	if event.Kind != kind || event.Joycon.Serial != serial {
+		t.Fatalf("got %s event for %s, want %s event for %s", event.Kind, event.Joycon.Serial, kind, serial)
+	}
+	return event.Joycon
+}
+
+func TestWatch(t *testing.T) {
+	left := emulator.NewLeft("aa:bb:cc:dd:ee:01")
+	right := emulator.NewRight("aa:bb:cc:dd:ee:02")
+	b := emulator.NewBackend(left)
+	r := joycon.NewRegistry(b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := r.Watch(ctx)
+
+	// Joycons that are already attached are added when watching starts
+	jc := expectDeviceEvent(t, events, joycon.DeviceAdded, left.Serial)
+	if found := r.Find(left.Serial); found != jc {
+		t.Error("Find returned a different Joycon than Watch")
+	}
+
+	b.Add(right)
+	added := expectDeviceEvent(t, events, joycon.DeviceAdded, right.Serial)
+
+	// A detached Joycon that isn't connected is forgotten, so it's a new Joycon once it's attached again
+	b.Remove(right)
+	expectDeviceEvent(t, events, joycon.DeviceRemoved, right.Serial)
+	if slices.Contains(r.Joycons(), added) {
+		t.Error("detached Joycon is still in the registry")
+	}
+	b.Add(right)
+	if again := expectDeviceEvent(t, events, joycon.DeviceAdded, right.Serial); again == added {
+		t.Error("Joycon that was attached again is the forgotten one")
+	}
+
+	// A detached Joycon that is connected is kept while it reconnects
+	if err := jc.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer jc.Disconnect()
+	var received atomic.Int64
+	readStatuses(jc, &received)
+	b.Remove(left)
+	expectDeviceEvent(t, events, joycon.DeviceRemoved, left.Serial)
+	if !slices.Contains(r.Joycons(), jc) {
+		t.Error("reconnecting Joycon was removed from the registry")
+	}
+	b.Add(left)
+	if again := expectDeviceEvent(t, events, joycon.DeviceAdded, left.Serial); again != jc {
+		t.Error("reconnecting Joycon was added as a new Joycon")
+	}
+	waitForState(t, jc, joycon.StateConnected)
+
+	cancel()
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("events weren't closed after the context was canceled")
+		}
+	}
+}
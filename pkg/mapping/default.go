@@ -0,0 +1,78 @@
+package mapping
+
+import (
+	"joyku/pkg/joycon"
+	"joyku/pkg/roku"
+)
+
+// DefaultProfiles returns the profiles used when no profile file is provided. Both Joycons navigate with the stick, and
+// the buttons in the same position as A and B on the right Joycon are used for Select and Back. Pro Controllers and
+// combined Joycons can also navigate with the d-pad.
+func DefaultProfiles() []*Profile {
+	arrows := []Binding{
+		{Input: Input{Direction: joycon.StickUp}, Keys: []roku.Keypress{roku.KeyUp}},
+		{Input: Input{Direction: joycon.StickRight}, Keys: []roku.Keypress{roku.KeyRight}},
+		{Input: Input{Direction: joycon.StickDown}, Keys: []roku.Keypress{roku.KeyDown}},
+		{Input: Input{Direction: joycon.StickLeft}, Keys: []roku.Keypress{roku.KeyLeft}},
+	}
+
+	left := &Profile{
+		Name:            "Default (left)",
+		Controller:      LeftController,
+		StickRepeat:     defaultStickRepeat,
+		StickRepeatFast: defaultStickRepeatFast,
+		Stick:           joycon.DefaultStickResponse,
+		Timings:         joycon.DefaultButtonTimings,
+		Bindings: append([]Binding{
+			{Input: Input{Buttons: joycon.ButtonRight}, Keys: []roku.Keypress{roku.KeySelect}},
+			{Input: Input{Buttons: joycon.ButtonDown}, Keys: []roku.Keypress{roku.KeyBack}},
+			{Input: Input{Buttons: joycon.ButtonCapture}, Keys: []roku.Keypress{roku.KeyHome}},
+		}, arrows...),
+	}
+	right := &Profile{
+		Name:            "Default (right)",
+		Controller:      RightController,
+		StickRepeat:     defaultStickRepeat,
+		StickRepeatFast: defaultStickRepeatFast,
+		Stick:           joycon.DefaultStickResponse,
+		Timings:         joycon.DefaultButtonTimings,
+		Bindings: append([]Binding{
+			{Input: Input{Buttons: joycon.ButtonA}, Keys: []roku.Keypress{roku.KeySelect}},
+			{Input: Input{Buttons: joycon.ButtonB}, Keys: []roku.Keypress{roku.KeyBack}},
+			{Input: Input{Buttons: joycon.ButtonHome}, Keys: []roku.Keypress{roku.KeyHome}},
+		}, arrows...),
+	}
+	pro := &Profile{
+		Name:            "Default (pro)",
+		Controller:      ProController,
+		StickRepeat:     defaultStickRepeat,
+		StickRepeatFast: defaultStickRepeatFast,
+		Stick:           joycon.DefaultStickResponse,
+		Timings:         joycon.DefaultButtonTimings,
+		Bindings: append([]Binding{
+			{Input: Input{Buttons: joycon.ButtonA}, Keys: []roku.Keypress{roku.KeySelect}},
+			{Input: Input{Buttons: joycon.ButtonB}, Keys: []roku.Keypress{roku.KeyBack}},
+			{Input: Input{Buttons: joycon.ButtonHome}, Keys: []roku.Keypress{roku.KeyHome}},
+			{Input: Input{Buttons: joycon.ButtonPlus}, Keys: []roku.Keypress{roku.KeyPlay}},
+			{Input: Input{Buttons: joycon.ButtonUp}, Keys: []roku.Keypress{roku.KeyUp}},
+			{Input: Input{Buttons: joycon.ButtonRight}, Keys: []roku.Keypress{roku.KeyRight}},
+			{Input: Input{Buttons: joycon.ButtonDown}, Keys: []roku.Keypress{roku.KeyDown}},
+			{Input: Input{Buttons: joycon.ButtonLeft}, Keys: []roku.Keypress{roku.KeyLeft}},
+		}, arrows...),
+	}
+	// Combined Joycons have the same layout as a Pro Controller
+	combined := &Profile{
+		Name:            "Default (combined)",
+		Controller:      CombinedController,
+		StickRepeat:     defaultStickRepeat,
+		StickRepeatFast: defaultStickRepeatFast,
+		Stick:           joycon.DefaultStickResponse,
+		Timings:         joycon.DefaultButtonTimings,
+		Bindings:        append([]Binding{}, pro.Bindings...),
+	}
+	left.sortBindings()
+	right.sortBindings()
+	pro.sortBindings()
+	combined.sortBindings()
+	return []*Profile{left, right, pro, combined}
+}
@@ -0,0 +1,156 @@
+package mapping
+
+import (
+	"context"
+	"joyku/pkg/joycon"
+	"joyku/pkg/roku"
+	"log"
+	"sync"
+	"time"
+)
+
+// KeySender sends keys to a roku device. This is implemented by *roku.RokuDevice.
+type KeySender interface {
+	SendKeypress(key roku.Keypress) error
+}
+
+// controllerState is the input state of a single Joycon
+type controllerState struct {
+	detector   *joycon.ButtonEventDetector // Detects button transitions using the timings from the Joycon's profile
+	buttons    joycon.Button               // Buttons pressed in the previous status
+	directions [2]joycon.StickDirection    // Direction of each stick in the previous status, in the order of joycon.Stick
+	fired      map[int]time.Time           // Last time each stick binding (by index) fired
+}
+
+// Mapper translates Joycon statuses into roku keys using a set of profiles. Button bindings fire on button events
+// (e.g. when a button is pressed or long pressed) rather than on every status, so holding a button sends its keys once.
+// Stick bindings fire when the stick moves into their direction and repeat while it is held there, faster the further
+// the stick is pushed.
+type Mapper struct {
+	Feedback func(serial string) // Called by Run after keys were sent for a Joycon (e.g. to rumble it), can be nil
+
+	profiles []*Profile
+	states   map[string]*controllerState
+	lock     sync.Mutex
+}
+
+// NewMapper returns a mapper that uses the first matching profile for each Joycon
+func NewMapper(profiles []*Profile) *Mapper {
+	return &Mapper{
+		profiles: profiles,
+		states:   make(map[string]*controllerState),
+	}
+}
+
+// Map returns the keys that should be sent for the given status
+func (m *Mapper) Map(js *joycon.JoyconStatus) []roku.Keypress {
+	profile := SelectProfile(m.profiles, js.ProductID)
+	if profile == nil {
+		return nil
+	}
+
+	now := js.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	state, ok := m.states[js.Serial]
+	if !ok {
+		state = &controllerState{
+			detector: profile.newDetector(),
+			fired:    make(map[int]time.Time),
+		}
+		m.states[js.Serial] = state
+	}
+
+	keys := []roku.Keypress{}
+	fired := make(map[int]bool)
+	directions := stickDirections(js)
+
+	// Each button event is handled by the most specific binding it matches (e.g. ZL+ZR before ZL)
+	for _, e := range state.detector.Update(js) {
+		held := js.Buttons | e.Button
+		for i, b := range profile.Bindings {
+			if b.Input.Direction != joycon.InvalidStickDirection || b.Trigger != e.Kind || !b.Input.Buttons.Has(e.Button) {
+				continue
+			}
+			if !inputActive(b.Input, held, directions) {
+				continue
+			}
+			if !fired[i] {
+				fired[i] = true
+				keys = append(keys, b.Keys...)
+			}
+			break
+		}
+	}
+
+	// Stick bindings are level triggered, only the most specific active binding of each stick fires (e.g. R+stick:up
+	// before stick:up)
+	handled := [2]bool{}
+	for i, b := range profile.Bindings {
+		if b.Input.Direction == joycon.InvalidStickDirection || handled[b.Input.Stick] || !inputActive(b.Input, js.Buttons, directions) {
+			continue
+		}
+		handled[b.Input.Stick] = true
+
+		fire := !inputActive(b.Input, state.buttons, state.directions)
+		if !fire && profile.StickRepeat > 0 {
+			fire = now.Sub(state.fired[i]) >= profile.stickRepeat(b.Input.Stick.Data(js).Magnitude)
+		}
+		if fire {
+			state.fired[i] = now
+			keys = append(keys, b.Keys...)
+		}
+	}
+
+	state.buttons = js.Buttons
+	state.directions = directions
+	return keys
+}
+
+// stickDirections returns the direction of each stick in the given status, in the order of joycon.Stick
+func stickDirections(js *joycon.JoyconStatus) [2]joycon.StickDirection {
+	return [2]joycon.StickDirection{joycon.MainStick.Data(js).Direction, joycon.RightStick.Data(js).Direction}
+}
+
+func inputActive(input Input, buttons joycon.Button, directions [2]joycon.StickDirection) bool {
+	if !buttons.Has(input.Buttons) {
+		return false
+	}
+	return input.Direction == joycon.InvalidStickDirection || input.Direction == directions[input.Stick]
+}
+
+// Run maps every status received from statuses and sends the resulting keys until statuses is closed or the context
+// is done. Errors while sending keys are logged and do not stop the loop.
+func (m *Mapper) Run(ctx context.Context, statuses <-chan *joycon.JoyconStatus, sender KeySender) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case js, ok := <-statuses:
+			if !ok {
+				return
+			}
+			keys := m.Map(js)
+			if len(keys) == 0 {
+				// Nothing fired, so a key the roku is holding down is released
+				if err := sender.SendKeypress(roku.None); err != nil {
+					log.Printf("Could not release key on roku device: %s\n", err)
+				}
+				continue
+			}
+			for _, key := range keys {
+				if err := sender.SendKeypress(key); err != nil {
+					log.Printf("Could not send %s to roku device: %s\n", key, err)
+				}
+			}
+			if m.Feedback != nil {
+				m.Feedback(js.Serial)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package mapping
+
+import (
+	"testing"
+	"time"
+
+	"joyku/pkg/joycon"
+	"joyku/pkg/roku"
+)
+
+func TestMapRightStick(t *testing.T) {
+	profile := &Profile{
+		Controller:      ProController,
+		StickRepeat:     defaultStickRepeat,
+		StickRepeatFast: defaultStickRepeatFast,
+		Timings:         joycon.DefaultButtonTimings,
+	}
+	for _, in := range []struct {
+		input string
+		key   roku.Keypress
+	}{{"stick:up", roku.KeyUp}, {"rstick:up", roku.KeyVolumeUp}} {
+		input, err := ParseInput(in.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		profile.Bindings = append(profile.Bindings, Binding{Input: input, Keys: []roku.Keypress{in.key}})
+	}
+	m := NewMapper([]*Profile{profile})
+
+	start := time.Now()
+	status := func(offset time.Duration, left, right joycon.StickDirection) *joycon.JoyconStatus {
+		return &joycon.JoyconStatus{
+			Serial:            "00:00:00:00:00:01",
+			ProductID:         joycon.ProController,
+			Timestamp:         start.Add(offset),
+			JoystickData:      joycon.StickData{Direction: left},
+			RightJoystickData: joycon.StickData{Direction: right},
+		}
+	}
+
+	tests := []struct {
+		status *joycon.JoyconStatus
+		want   []roku.Keypress
+	}{
+		{status(0, joycon.NoStickDirection, joycon.StickUp), []roku.Keypress{roku.KeyVolumeUp}},
+		// Each stick fires on its own, pushing the left stick doesn't hold up the right one
+		{status(10*time.Millisecond, joycon.StickUp, joycon.StickUp), []roku.Keypress{roku.KeyUp}},
+		{status(20*time.Millisecond, joycon.StickUp, joycon.NoStickDirection), []roku.Keypress{}},
+		{status(30*time.Millisecond, joycon.NoStickDirection, joycon.StickUp), []roku.Keypress{roku.KeyVolumeUp}},
+	}
+	for i, tt := range tests {
+		got := m.Map(tt.status)
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("status %d: got %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestRightStickNeedsTwoSticks(t *testing.T) {
+	pc := profileConfig{
+		Controller: "right",
+		Bindings:   []bindingConfig{{Input: "rstick:up", Keys: []string{"Up"}}},
+	}
+	if _, err := newProfile(pc); err == nil {
+		t.Error("expected a right stick binding on a right Joycon to be rejected")
+	}
+}
@@ -0,0 +1,474 @@
+package mapping
+
+import (
+	"fmt"
+	"joyku/pkg/joycon"
+	"joyku/pkg/roku"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Prefixes used in binding inputs for stick directions (e.g. "stick:up")
+const (
+	stickInputPrefix      = "stick:"  // The stick of a Joycon or the left stick of a Pro Controller or combined Joycons
+	rightStickInputPrefix = "rstick:" // The right stick of a Pro Controller or combined Joycons
+)
+
+// Default time between repeated key presses while the stick is held in a direction
+const (
+	defaultStickRepeat     = 250 * time.Millisecond // Used when the stick is barely pushed
+	defaultStickRepeatFast = 75 * time.Millisecond  // Used when the stick is pushed all the way
+)
+
+// ControllerKind determines which Joycons a profile applies to
+type ControllerKind string
+
+const (
+	AnyController      ControllerKind = "any"
+	LeftController     ControllerKind = "left"
+	RightController    ControllerKind = "right"
+	ProController      ControllerKind = "pro"
+	CombinedController ControllerKind = "combined"
+)
+
+// Matches returns true if a Joycon with the given product id is of this kind
+func (c ControllerKind) Matches(productID uint16) bool {
+	switch c {
+	case LeftController:
+		return productID == joycon.LeftJoyconProductID
+	case RightController:
+		return productID == joycon.RightJoyconProductID
+	case ProController:
+		return productID == joycon.ProController
+	case CombinedController:
+		return productID == joycon.CombinedProductID
+	default:
+		return true
+	}
+}
+
+// Input is the Joycon input that triggers a binding. Every button must be pressed and, if set, the stick must be
+// pointing in the given direction.
+type Input struct {
+	Buttons   joycon.Button
+	Direction joycon.StickDirection
+	Stick     joycon.Stick // Stick that must point in Direction
+}
+
+func (i Input) String() string {
+	parts := []string{}
+	if i.Buttons != joycon.NoButton {
+		parts = append(parts, i.Buttons.String())
+	}
+	if i.Direction != joycon.InvalidStickDirection {
+		prefix := stickInputPrefix
+		if i.Stick == joycon.RightStick {
+			prefix = rightStickInputPrefix
+		}
+		parts = append(parts, prefix+strings.ReplaceAll(i.Direction.String(), " ", ""))
+	}
+	return strings.Join(parts, "+")
+}
+
+// specificity is the number of buttons and directions that make up this input
+func (i Input) specificity() int {
+	n := 0
+	for _, b := range joycon.Buttons {
+		if i.Buttons.Has(b) {
+			n++
+		}
+	}
+	if i.Direction != joycon.InvalidStickDirection {
+		n++
+	}
+	return n
+}
+
+// Binding maps an input to a sequence of roku keys
+type Binding struct {
+	Input   Input
+	Trigger joycon.ButtonEventKind // Button event that fires the binding - stick bindings fire while the stick is held
+	Keys    []roku.Keypress
+}
+
+// Profile is a named set of bindings for a kind of Joycon
+type Profile struct {
+	Name            string
+	Controller      ControllerKind
+	Hold            joycon.HoldMode                        // How a single Joycon using this profile is held
+	StickRepeat     time.Duration                          // Time between repeated keys while the stick is barely pushed, zero disables repeating
+	StickRepeatFast time.Duration                          // Time between repeated keys while the stick is pushed all the way
+	Stick           joycon.StickResponse                   // How the sticks of Joycons using this profile respond to being pushed
+	Timings         joycon.ButtonTimings                   // Timings used for button events
+	ButtonTimings   map[joycon.Button]joycon.ButtonTimings // Timings for individual buttons
+	Bindings        []Binding                              // Bindings ordered from most to least specific input
+}
+
+// newDetector returns a button event detector that uses the timings from this profile
+func (p *Profile) newDetector() *joycon.ButtonEventDetector {
+	d := joycon.NewButtonEventDetector()
+	d.Default = p.Timings
+	for b, t := range p.ButtonTimings {
+		d.Timings[b] = t
+	}
+	return d
+}
+
+// stickRepeat returns the time between repeated keys while the stick is pushed by the given magnitude (0-1)
+func (p *Profile) stickRepeat(magnitude float64) time.Duration {
+	magnitude = math.Max(0, math.Min(magnitude, 1))
+	return p.StickRepeat - time.Duration(float64(p.StickRepeat-p.StickRepeatFast)*magnitude)
+}
+
+type bindingConfig struct {
+	Input string   `mapstructure:"input"`
+	On    string   `mapstructure:"on"`
+	Keys  []string `mapstructure:"keys"`
+}
+
+type timingsConfig struct {
+	LongPress      *time.Duration `mapstructure:"long_press"`
+	RepeatDelay    *time.Duration `mapstructure:"repeat_delay"`
+	RepeatInterval *time.Duration `mapstructure:"repeat_interval"`
+	DoubleTap      *time.Duration `mapstructure:"double_tap"`
+}
+
+// apply returns the given timings with every configured value replaced
+func (tc timingsConfig) apply(t joycon.ButtonTimings) joycon.ButtonTimings {
+	if tc.LongPress != nil {
+		t.LongPress = *tc.LongPress
+	}
+	if tc.RepeatDelay != nil {
+		t.RepeatDelay = *tc.RepeatDelay
+	}
+	if tc.RepeatInterval != nil {
+		t.RepeatInterval = *tc.RepeatInterval
+	}
+	if tc.DoubleTap != nil {
+		t.DoubleTap = *tc.DoubleTap
+	}
+	return t
+}
+
+type stickConfig struct {
+	Deadzone      float64      `mapstructure:"deadzone"`
+	OuterDeadzone float64      `mapstructure:"outer_deadzone"`
+	Shape         string       `mapstructure:"shape"`
+	Curve         string       `mapstructure:"curve"`
+	Points        [][2]float64 `mapstructure:"points"`
+	Sectors       int          `mapstructure:"sectors"`
+	Hysteresis    *float64     `mapstructure:"hysteresis"`
+}
+
+// response returns the stick response with the configured values
+func (sc stickConfig) response() (joycon.StickResponse, error) {
+	r := joycon.DefaultStickResponse
+	r.Deadzone = sc.Deadzone
+	r.OuterDeadzone = sc.OuterDeadzone
+	if sc.Sectors != 0 {
+		r.Sectors = joycon.DirectionSectors(sc.Sectors)
+	}
+	if sc.Hysteresis != nil {
+		r.Hysteresis = *sc.Hysteresis
+	}
+
+	switch strings.ToLower(strings.TrimSpace(sc.Shape)) {
+	case "", "radial":
+		r.Shape = joycon.DeadzoneRadial
+	case "axial":
+		r.Shape = joycon.DeadzoneAxial
+	case "scaled_radial":
+		r.Shape = joycon.DeadzoneScaledRadial
+	default:
+		return r, fmt.Errorf("unknown deadzone shape %q, expected radial, axial, or scaled_radial", sc.Shape)
+	}
+
+	curve := strings.ToLower(strings.TrimSpace(sc.Curve))
+	if curve != "custom" && len(sc.Points) > 0 {
+		return r, fmt.Errorf("curve points can only be used with a custom curve")
+	}
+	switch curve {
+	case "", "linear":
+		r.Curve = joycon.LinearCurve
+	case "quadratic":
+		r.Curve = joycon.QuadraticCurve
+	case "cubic":
+		r.Curve = joycon.CubicCurve
+	case "custom":
+		points := make([]joycon.CurvePoint, 0, len(sc.Points))
+		for _, p := range sc.Points {
+			points = append(points, joycon.CurvePoint{In: p[0], Out: p[1]})
+		}
+		var err error
+		if r.Curve, err = joycon.CustomCurve(points); err != nil {
+			return r, err
+		}
+	default:
+		return r, fmt.Errorf("unknown curve %q, expected linear, quadratic, cubic, or custom", sc.Curve)
+	}
+	return r, r.Validate()
+}
+
+type profileConfig struct {
+	Name        string                   `mapstructure:"name"`
+	Controller  string                   `mapstructure:"controller"`
+	Hold        string                   `mapstructure:"hold"`
+	StickRepeat *time.Duration           `mapstructure:"stick_repeat"`
+	RepeatFast  *time.Duration           `mapstructure:"stick_repeat_fast"`
+	Stick       stickConfig              `mapstructure:"stick"`
+	Timings     map[string]timingsConfig `mapstructure:"timings"`
+	Bindings    []bindingConfig          `mapstructure:"bindings"`
+}
+
+type fileConfig struct {
+	Profiles []profileConfig `mapstructure:"profiles"`
+}
+
+// LoadProfiles loads the profiles in the given file. The format of the file (YAML or TOML) is determined by its
+// extension.
+//
+//	profiles:
+//	  - name: Right remote
+//	    controller: right # left, right, pro, combined, or any
+//	    hold: sideways_left # vertical, sideways_left, or sideways_right - only for left and right Joycons
+//	    stick_repeat: 200ms # time between repeats when the stick is barely pushed
+//	    stick_repeat_fast: 50ms # time between repeats when the stick is pushed all the way
+//	    stick:
+//	      deadzone: 0.15 # 0-1, uses the deadzone from the stick calibration if not set
+//	      outer_deadzone: 0.05
+//	      shape: scaled_radial # radial, axial, or scaled_radial
+//	      curve: custom # linear, quadratic, cubic, or custom
+//	      points: [[0.5, 0.25]] # (input, output) points of a custom curve between (0, 0) and (1, 1)
+//	      sectors: 8 # number of stick directions: 4, 8, or 16
+//	      hysteresis: 5 # degrees the stick must move past the edge of a direction before it changes
+//	    bindings:
+//	      - input: A
+//	        keys: [Select]
+//	      - input: stick:up
+//	        keys: [Up]
+//	      - input: rstick:up # right stick, only for pro and combined controllers
+//	        keys: [VolumeUp]
+//	      - input: A
+//	        on: long_press # press, release, long_press, repeat, or double_tap
+//	        keys: [Home]
+//	      - input: ZL+ZR
+//	        keys: [Home, Down, Select]
+//	    timings: # default applies to every button, individual buttons can be overridden by name
+//	      default: {long_press: 500ms, repeat_delay: 500ms, repeat_interval: 100ms, double_tap: 300ms}
+//	      A: {long_press: 800ms}
+func LoadProfiles(path string) ([]*Profile, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("could not read mapping profiles: %w", err)
+	}
+
+	fc := fileConfig{}
+	if err := v.Unmarshal(&fc); err != nil {
+		return nil, fmt.Errorf("could not parse mapping profiles: %w", err)
+	}
+	if len(fc.Profiles) == 0 {
+		return nil, fmt.Errorf("no profiles found in %s", path)
+	}
+
+	profiles := make([]*Profile, 0, len(fc.Profiles))
+	for i, pc := range fc.Profiles {
+		p, err := newProfile(pc)
+		if err != nil {
+			return nil, fmt.Errorf("profile %d (%s): %w", i, pc.Name, err)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+func newProfile(pc profileConfig) (*Profile, error) {
+	p := &Profile{
+		Name:            pc.Name,
+		Controller:      ControllerKind(strings.ToLower(pc.Controller)),
+		StickRepeat:     defaultStickRepeat,
+		StickRepeatFast: defaultStickRepeatFast,
+		ButtonTimings:   make(map[joycon.Button]joycon.ButtonTimings),
+	}
+	switch p.Controller {
+	case "":
+		p.Controller = AnyController
+	case AnyController, LeftController, RightController, ProController, CombinedController:
+	default:
+		return nil, fmt.Errorf("unknown controller %q, expected left, right, pro, combined, or any", pc.Controller)
+	}
+	hold, err := parseHold(pc.Hold)
+	if err != nil {
+		return nil, err
+	}
+	if hold != joycon.HoldVertical && p.Controller != LeftController && p.Controller != RightController {
+		return nil, fmt.Errorf("only left and right controllers can be held sideways")
+	}
+	p.Hold = hold
+	if pc.StickRepeat != nil {
+		p.StickRepeat = *pc.StickRepeat
+	}
+	p.StickRepeatFast = min(p.StickRepeatFast, p.StickRepeat)
+	if pc.RepeatFast != nil {
+		p.StickRepeatFast = *pc.RepeatFast
+	}
+	if p.StickRepeatFast > p.StickRepeat {
+		return nil, fmt.Errorf("stick_repeat_fast (%s) can not be slower than stick_repeat (%s)", p.StickRepeatFast, p.StickRepeat)
+	}
+	if p.Stick, err = pc.Stick.response(); err != nil {
+		return nil, fmt.Errorf("invalid stick: %w", err)
+	}
+
+	// Timings are keyed by button name and viper lowercases keys, so the default timings must be applied first
+	p.Timings = pc.Timings["default"].apply(joycon.DefaultButtonTimings)
+	for name, tc := range pc.Timings {
+		if name == "default" {
+			continue
+		}
+		b, err := joycon.ParseButton(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timings: %w", err)
+		}
+		p.ButtonTimings[b] = tc.apply(p.Timings)
+	}
+
+	for _, bc := range pc.Bindings {
+		input, err := ParseInput(bc.Input)
+		if err != nil {
+			return nil, err
+		}
+		if len(bc.Keys) == 0 {
+			return nil, fmt.Errorf("binding for %s has no keys", bc.Input)
+		}
+		trigger, err := parseTrigger(bc.On)
+		if err != nil {
+			return nil, err
+		}
+		if input.Direction != joycon.InvalidStickDirection && trigger != joycon.EventDown {
+			return nil, fmt.Errorf("binding for %s can only be triggered by a press", bc.Input)
+		}
+		if input.Stick == joycon.RightStick && (p.Controller == LeftController || p.Controller == RightController) {
+			return nil, fmt.Errorf("binding for %s uses the right stick, which only pro and combined controllers have", bc.Input)
+		}
+
+		b := Binding{Input: input, Trigger: trigger}
+		for _, k := range bc.Keys {
+			key, err := roku.ParseKeypress(k)
+			if err != nil {
+				return nil, err
+			}
+			b.Keys = append(b.Keys, key)
+		}
+		p.Bindings = append(p.Bindings, b)
+	}
+	p.sortBindings()
+	return p, nil
+}
+
+// sortBindings orders bindings so chords are checked before the buttons that make them up
+func (p *Profile) sortBindings() {
+	sort.SliceStable(p.Bindings, func(i, j int) bool {
+		return p.Bindings[i].Input.specificity() > p.Bindings[j].Input.specificity()
+	})
+}
+
+// ParseInput parses a binding input. An input is made of buttons and at most one stick direction joined with "+"
+// (e.g. "A", "ZL+ZR", "stick:up", "R+stick:left", "rstick:down").
+func ParseInput(s string) (Input, error) {
+	input := Input{}
+	for _, part := range strings.Split(s, "+") {
+		part = strings.TrimSpace(part)
+		if stick, name, ok := cutStickPrefix(part); ok {
+			if input.Direction != joycon.InvalidStickDirection {
+				return Input{}, fmt.Errorf("input %q has more than one stick direction", s)
+			}
+			dir, err := parseDirection(name)
+			if err != nil {
+				return Input{}, err
+			}
+			input.Direction = dir
+			input.Stick = stick
+			continue
+		}
+
+		b, err := joycon.ParseButton(part)
+		if err != nil {
+			return Input{}, err
+		}
+		input.Buttons |= b
+	}
+	if input.Buttons == joycon.NoButton && input.Direction == joycon.InvalidStickDirection {
+		return Input{}, fmt.Errorf("empty input")
+	}
+	return input, nil
+}
+
+// cutStickPrefix returns the stick and direction name of an input part with a stick prefix (e.g. "rstick:up"), ok is
+// false if the part isn't a stick direction
+func cutStickPrefix(part string) (stick joycon.Stick, name string, ok bool) {
+	for _, p := range []struct {
+		prefix string
+		stick  joycon.Stick
+	}{{stickInputPrefix, joycon.MainStick}, {rightStickInputPrefix, joycon.RightStick}} {
+		if len(part) > len(p.prefix) && strings.EqualFold(part[:len(p.prefix)], p.prefix) {
+			return p.stick, part[len(p.prefix):], true
+		}
+	}
+	return joycon.MainStick, "", false
+}
+
+// parseTrigger parses the name of the button event that fires a binding. An empty name is the same as "press".
+func parseTrigger(s string) (joycon.ButtonEventKind, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "press", "down":
+		return joycon.EventDown, nil
+	case "release", "up":
+		return joycon.EventUp, nil
+	case "long_press", "long":
+		return joycon.EventLongPress, nil
+	case "repeat":
+		return joycon.EventRepeat, nil
+	case "double_tap", "double":
+		return joycon.EventDoubleTap, nil
+	default:
+		return joycon.EventDown, fmt.Errorf("unknown trigger %q, expected press, release, long_press, repeat, or double_tap", s)
+	}
+}
+
+// parseHold parses the way a single Joycon is held
+func parseHold(s string) (joycon.HoldMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "vertical":
+		return joycon.HoldVertical, nil
+	case "sideways_left", "sideways":
+		return joycon.HoldSidewaysLeft, nil
+	case "sideways_right":
+		return joycon.HoldSidewaysRight, nil
+	default:
+		return joycon.HoldVertical, fmt.Errorf("unknown hold %q, expected vertical, sideways_left, or sideways_right", s)
+	}
+}
+
+// parseDirection parses a stick direction name, ignoring case and spaces (e.g. "upperright")
+func parseDirection(s string) (joycon.StickDirection, error) {
+	for dir := joycon.StickUp; dir <= joycon.StickUpUpperLeft; dir++ {
+		if strings.EqualFold(strings.ReplaceAll(dir.String(), " ", ""), strings.ReplaceAll(s, " ", "")) {
+			return dir, nil
+		}
+	}
+	return joycon.InvalidStickDirection, fmt.Errorf("unknown stick direction: %q", s)
+}
+
+// SelectProfile returns the first profile that applies to a Joycon with the given product id, or nil if there are none
+func SelectProfile(profiles []*Profile, productID uint16) *Profile {
+	for _, p := range profiles {
+		if p.Controller.Matches(productID) {
+			return p
+		}
+	}
+	return nil
+}
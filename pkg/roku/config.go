@@ -1,6 +1,7 @@
 package roku
 
 import (
+	"errors"
 	"os"
 	"path"
 
@@ -12,8 +13,9 @@ type RokuConfig struct {
 	Port int    `mapstructure:"ROKU_PORT"`
 }
 
-// NewRokuConfig attempts to create a RokuConfig struct from the local roku.env file. If the config file could not be parsed,
-// nil is returned alongside an error.
+// NewRokuConfig attempts to create a RokuConfig struct from the local roku.env file and environment. The roku.env file is
+// optional, and if no ip is configured the Ip field is left empty so the device can be found with Discover instead. If the
+// config file could not be parsed, nil is returned alongside an error.
 func NewRokuConfig() (*RokuConfig, error) {
 	rc := &RokuConfig{}
 
@@ -27,11 +29,14 @@ func NewRokuConfig() (*RokuConfig, error) {
 	viper.SetConfigType("env")
 	viper.AutomaticEnv()
 
-	viper.SetDefault("ROKU_IP", "127.0.0.1")
+	viper.SetDefault("ROKU_IP", "")
 	viper.SetDefault("ROKU_PORT", "8060")
 
 	if err := viper.ReadInConfig(); err != nil {
-		return nil, err
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return nil, err
+		}
 	}
 	if err := viper.Unmarshal(&rc); err != nil {
 		return nil, err
@@ -0,0 +1,192 @@
+package roku
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ssdpAddress          = "239.255.255.250:1900" // SSDP multicast address
+	rokuSearchTarget     = "roku:ecp"             // SSDP search target that only roku devices respond to
+	defaultDiscoveryTime = 3 * time.Second        // How long to wait for responses if the context has no deadline
+	searchAttempts       = 2                      // Number of search requests sent, in case one is lost
+	defaultECPPort       = 8060                   // Port used for ECP when a LOCATION header doesn't contain one
+)
+
+// ErrNoDevices is returned by FindDevice when discovery did not find any roku devices
+var ErrNoDevices = errors.New("no roku devices were found")
+
+var searchRequest = []byte("M-SEARCH * HTTP/1.1\r\n" +
+	"Host: " + ssdpAddress + "\r\n" +
+	"Man: \"ssdp:discover\"\r\n" +
+	"ST: " + rokuSearchTarget + "\r\n\r\n")
+
+// Discover searches the local network for roku devices using SSDP and returns every device that responded before the
+// context was done. If the context has no deadline, responses are collected for 3 seconds. Each device is queried with
+// QueryDevice as soon as it responds, so a slow device doesn't hold up the others; devices that could not be queried
+// before the context was done are skipped.
+func Discover(ctx context.Context) ([]*RokuDevice, error) {
+	listenCtx := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		listenCtx, cancel = context.WithTimeout(ctx, defaultDiscoveryTime)
+		defer cancel()
+	}
+
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("could not open ssdp socket: %w", err)
+	}
+	defer conn.Close()
+
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < searchAttempts; i++ {
+		if _, err := conn.WriteTo(searchRequest, addr); err != nil {
+			return nil, fmt.Errorf("could not send ssdp search: %w", err)
+		}
+	}
+
+	// Unblock reads once the context is done
+	go func() {
+		<-listenCtx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	// Every device that responded, in the order they responded
+	type candidate struct {
+		location string
+		device   *RokuDevice
+		err      error // Set once the device was queried
+	}
+	candidates := []*candidate{}
+	var wg sync.WaitGroup
+	var listenErr error
+
+	seen := map[string]bool{}
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if listenCtx.Err() == nil {
+				listenErr = fmt.Errorf("could not read ssdp response: %w", err)
+			}
+			break
+		}
+
+		location, err := parseSearchResponse(buf[:n])
+		if err != nil {
+			log.Printf("Ignoring invalid ssdp response: %s\n", err)
+			continue
+		}
+		if seen[location] {
+			continue
+		}
+		seen[location] = true
+
+		ip, port, err := parseLocation(location)
+		if err != nil {
+			log.Printf("Ignoring roku device with invalid location %q: %s\n", location, err)
+			continue
+		}
+		c := &candidate{location: location, device: NewDevice(ip, port)}
+		candidates = append(candidates, c)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.err = QueryDevice(ctx, c.device)
+		}()
+	}
+	wg.Wait()
+	if listenErr != nil {
+		return nil, listenErr
+	}
+
+	devices := []*RokuDevice{}
+	for _, c := range candidates {
+		if c.err != nil {
+			log.Printf("Could not query roku device at %s: %s\n", c.location, c.err)
+			continue
+		}
+		devices = append(devices, c.device)
+	}
+	return devices, nil
+}
+
+// FindDevice returns the roku device at the ip in the given config. If no ip is configured, the first device found with
+// Discover is returned instead.
+func FindDevice(ctx context.Context, cfg *RokuConfig) (*RokuDevice, error) {
+	if cfg.Ip != "" {
+		device := NewDevice(cfg.Ip, cfg.Port)
+		if err := QueryDevice(ctx, device); err != nil {
+			return nil, err
+		}
+		return device, nil
+	}
+
+	devices, err := Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, ErrNoDevices
+	}
+	if len(devices) > 1 {
+		log.Printf("Found %d roku devices, using %s\n", len(devices), devices[0].Name)
+	}
+	return devices[0], nil
+}
+
+// parseSearchResponse parses an SSDP search response and returns its LOCATION header
+func parseSearchResponse(data []byte) (string, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	if st := resp.Header.Get("ST"); st != "" && st != rokuSearchTarget {
+		return "", fmt.Errorf("unexpected search target: %s", st)
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("missing LOCATION header")
+	}
+	return location, nil
+}
+
+// parseLocation returns the ip and port from a LOCATION header value (e.g. http://192.168.1.2:8060/)
+func parseLocation(location string) (string, int, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", 0, err
+	}
+	if u.Hostname() == "" {
+		return "", 0, fmt.Errorf("missing host")
+	}
+
+	port := defaultECPPort
+	if p := u.Port(); p != "" {
+		port, err = strconv.Atoi(p)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid port: %w", err)
+		}
+	}
+	return u.Hostname(), port, nil
+}
@@ -1,6 +1,8 @@
 package roku
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -36,10 +38,34 @@ const (
 	KeyPowerOff      Keypress = "PowerOff"   // May not be supported by all devices
 )
 
+// Keys contains every named key supported by ECP
+var Keys = []Keypress{
+	KeyHome, KeyRev, KeyFwd, KeyPlay, KeySelect, KeyLeft, KeyRight, KeyDown, KeyUp, KeyBack, KeyInstantReplay, KeyInfo,
+	KeyBackspace, KeySearch, KeyEnter, KeyVolumeUp, KeyVolumeDown, KeyVolumeMute, KeyInputTuner, KeyInputHDMI1,
+	KeyInputHDMI2, KeyInputHDMI3, KeyInputHDMI4, KeyInputAV1, KeyPowerOn, KeyPowerOff,
+}
+
+// Prefix used by ECP for keys that send a single character (e.g. "Lit_a")
+const literalKeyPrefix = "Lit_"
+
 func (k Keypress) String() string {
 	return string(k)
 }
 
+// ParseKeypress parses the name of a key (case insensitive). Literal character keys (e.g. "Lit_a") are also accepted.
+func ParseKeypress(s string) (Keypress, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, literalKeyPrefix) && len(s) > len(literalKeyPrefix) {
+		return Keypress(s), nil
+	}
+	for _, key := range Keys {
+		if strings.EqualFold(s, key.String()) {
+			return key, nil
+		}
+	}
+	return None, fmt.Errorf("unknown roku key: %q", s)
+}
+
 type ECPCommand string
 
 const (
@@ -1,13 +1,23 @@
 package roku
 
 import (
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 )
 
+const (
+	maxECPAttempts  = 3                      // Number of times an ECP command is attempted before giving up
+	ecpRetryBackoff = 100 * time.Millisecond // Time to wait before retrying an ECP command, multiplied by the attempt number
+)
+
 type RokuDevice struct {
 	Name        string `xml:"friendly-device-name"`
 	Serial      string `xml:"serial-number"`
@@ -44,9 +54,27 @@ func NewDeviceWithTimeout(ip string, port int, timeout time.Duration) *RokuDevic
 	}
 }
 
-// QueryDevice retrieves device information and updates the given device with the retrieved info
-func QueryDevice(device *RokuDevice) error {
-	resp, err := device.httpClient.Get(fmt.Sprintf("http://%s:%d/query/device-info", device.ip, device.port))
+// PlayerNumber returns a number from 1 to 8 derived from the serial number of this device. The same device always has
+// the same number, so it can be shown on a Joycon's player lights to tell which device the Joycon controls.
+func (r *RokuDevice) PlayerNumber() int {
+	id := r.Serial
+	if id == "" {
+		id = r.ip
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32()%8) + 1
+}
+
+// QueryDevice retrieves device information and updates the given device with the retrieved info. The query is given up
+// once ctx is done, or after the device's timeout.
+func QueryDevice(ctx context.Context, device *RokuDevice) error {
+	endpoint := fmt.Sprintf("http://%s:%d/query/device-info", device.ip, device.port)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("could not create device info request: %w", err)
+	}
+	resp, err := device.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("could not retrieve device info: %w", err)
 	}
@@ -64,45 +92,81 @@ func QueryDevice(device *RokuDevice) error {
 	return nil
 }
 
-func (r *RokuDevice) SendKeypress(key Keypress) {
+// SendKeypress sends the given key to the roku device. Repeatedly sending the same key for longer than 150ms is treated as
+// holding the key down, which is released once a different key is sent. Sending None releases any held key, so callers
+// should send it once the key is no longer pressed.
+func (r *RokuDevice) SendKeypress(key Keypress) error {
 	now := time.Now()
 
+	var err error
 	if r.keyState.previousKey == key {
 		if !r.keyState.keyTime.IsZero() && now.Sub(r.keyState.keyTime).Milliseconds() > 150 {
 			if !r.keyState.holding {
 				// we only need to enter a hold event once for a key
 				r.keyState.holding = true
-				r.sendECPCommand(Hold, key)
+				err = r.sendECPCommand(Hold, key)
 			}
 		} else {
 			// do not update time since this is the same key
-			r.sendECPCommand(Press, key)
+			err = r.sendECPCommand(Press, key)
 		}
 	} else {
 		if r.keyState.holding {
-			r.sendECPCommand(Release, r.keyState.previousKey)
-		} else {
-			r.sendECPCommand(Press, key)
+			err = r.sendECPCommand(Release, r.keyState.previousKey)
+		}
+		if err == nil {
+			err = r.sendECPCommand(Press, key)
 		}
 		// reset
 		r.keyState.previousKey = key
 		r.keyState.keyTime = now
 		r.keyState.holding = false
 	}
+	return err
 }
 
-// SendKeypress sends a keypress command to the roku device
+// sendECPCommand sends an ECP command for the given key to the roku device. Transient failures (connections that could
+// not be made and 5xx or 429 responses) are retried up to maxECPAttempts times before an error is returned.
 func (r *RokuDevice) sendECPCommand(ecp ECPCommand, key Keypress) error {
 	// Ignore empty key presses
 	if key == None {
 		return nil
 	}
 
-	var err error = nil
-	// _, err := r.httpClient.Post(fmt.Sprintf("http://%s:%d/%s/%s", r.ip, r.port, ecp, key), "xml", http.NoBody)
+	endpoint := fmt.Sprintf("http://%s:%d/%s/%s", r.ip, r.port, ecp, url.PathEscape(key.String()))
+
+	var err error
+	for attempt := 1; attempt <= maxECPAttempts; attempt++ {
+		var retry bool
+		retry, err = r.postECP(endpoint)
+		if err == nil {
+			return nil
+		}
+		if !retry {
+			break
+		}
+		if attempt < maxECPAttempts {
+			time.Sleep(ecpRetryBackoff * time.Duration(attempt))
+		}
+	}
+	return fmt.Errorf("could not send %s %s to %s device: %w", ecp, key, r.Name, err)
+}
+
+// postECP sends a single ECP request and returns whether or not the request should be retried if it failed
+func (r *RokuDevice) postECP(endpoint string) (bool, error) {
+	resp, err := r.httpClient.Post(endpoint, "text/plain", http.NoBody)
 	if err != nil {
-		return fmt.Errorf("could not send keypress to %s device: %w", r.Name, err)
+		// Only retry if the connection couldn't be made, otherwise the roku may have already received the request (e.g.
+		// the response timed out) and a keypress would be sent twice
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial", err
 	}
-	fmt.Printf("Command: %s, Key: %s\n", ecp, key)
-	return nil
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status code: %s", resp.Status)
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
 }
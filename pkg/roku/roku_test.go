@@ -0,0 +1,100 @@
+package roku
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestDevice returns a device that sends its commands to the given server
+func newTestDevice(t *testing.T, server *httptest.Server, timeout time.Duration) *RokuDevice {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDeviceWithTimeout(u.Hostname(), port, timeout)
+}
+
+func TestSendKeypressRetriesServerErrors(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	if err := newTestDevice(t, server, time.Second).SendKeypress(KeySelect); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+}
+
+func TestSendKeypressDoesNotRetryTimeouts(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	// The roku received the keypress even though the response timed out, so sending it again would press it twice
+	if err := newTestDevice(t, server, 50*time.Millisecond).SendKeypress(KeySelect); err == nil {
+		t.Fatal("expected the timeout to be returned")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestSendKeypressRetriesRefusedConnections(t *testing.T) {
+	// Find a port that nothing is listening on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	start := time.Now()
+	if err := NewDevice("127.0.0.1", port).SendKeypress(KeySelect); err == nil {
+		t.Fatal("expected an error for a refused connection")
+	}
+	// Every attempt after the first waits for the backoff
+	if elapsed := time.Since(start); elapsed < ecpRetryBackoff*3 {
+		t.Errorf("gave up after %s, want %d attempts", elapsed, maxECPAttempts)
+	}
+}
+
+func TestQueryDeviceHonorsContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := QueryDevice(ctx, newTestDevice(t, server, 10*time.Second))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("query took %s after the context was done", elapsed)
+	}
+}